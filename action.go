@@ -1,9 +1,36 @@
 package box
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// 错误分类
+const (
+	ErrorClassTimeout     = "timeout"      // 超时
+	ErrorClassCanceled    = "canceled"     // 主动取消
+	ErrorClassHttp4xx     = "http_4xx"     // http 4xx
+	ErrorClassHttp5xx     = "http_5xx"     // http 5xx
+	ErrorClassConnRefused = "conn_refused" // 连接被拒绝
+	ErrorClassConnReset   = "conn_reset"   // 连接被重置或提前关闭
+	ErrorClassDns         = "dns"          // 域名解析失败
+	ErrorClassTls         = "tls"          // tls握手或证书错误
+	ErrorClassAssert      = "assert"       // 返回内容不符合预期
+	ErrorClassPanic       = "panic"        // 动作panic
+	ErrorClassOther       = "error"        // 其它错误
+)
+
+// 错误分类器: 返回空时使用默认分类GetErrorClass
+type ErrorClassifier func(err error) (class string)
+
 // 一个执行函数 step: 执行位置0起始, batch: 执行批次,第几次执行
 type ActionOneFn func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error)
 
@@ -14,6 +41,24 @@ type ActionOne struct {
 	FnBefore ActionOneFn // 执行函数
 	FnAfter  ActionOneFn // 执行函数
 	Interval time.Time   // 执行间隔
+	Limiter  *Limiter    // 限流, 可与其它动作共用
+}
+
+// 动作错误: 携带动作状态, 如超时可标记为ActionStatusFreeze
+type ActionError struct {
+	Status int   // 动作状态
+	Err    error // 原始错误
+}
+
+// 思考时间: 执行前等待, 用于模拟用户操作间隔, 不计入动作耗时; 场景在等待限流之前思考, 思考中不占用限流名额
+type ActionThink struct {
+	Action               // 原动作
+	Think  time.Duration // 执行前等待时长
+}
+
+// 有思考时间的动作, 见ActionThink
+type ActionThinking interface {
+	GetThink() time.Duration // 执行前的思考时间
 }
 
 // 动作印记
@@ -25,6 +70,151 @@ type ActionOnePrint struct {
 	Action *ActionOne // 父级动作
 }
 
+// 创建带状态的动作错误
+func NewActionError(status int, err error) *ActionError {
+	return &ActionError{Status: status, Err: err}
+}
+
+//
+func (e *ActionError) Error() string {
+	return e.Err.Error()
+}
+
+//
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// 断言错误: 返回内容不符合预期, 如提取不到变量
+type ErrorAssert struct {
+	Text string // 错误文本
+}
+
+// 创建断言错误
+func NewErrorAssert(format string, a ...interface{}) *ErrorAssert {
+	return &ErrorAssert{Text: fmt.Sprintf(format, a...)}
+}
+
+//
+func (e *ErrorAssert) Error() string {
+	return e.Text
+}
+
+// 动作执行中panic, 由场景恢复后作为动作错误
+type ErrorPanic struct {
+	Value interface{} // panic的值
+	Where string      // panic位置
+}
+
+//
+func (e *ErrorPanic) Error() string {
+	return fmt.Sprintf(`panic: %v`, e.Value)
+}
+
+// 为动作加上思考时间
+func NewActionThink(a Action, think time.Duration) *ActionThink {
+	return &ActionThink{Action: a, Think: think}
+}
+
+// 执行前的思考时间
+func (d *ActionThink) GetThink() time.Duration {
+	return d.Think
+}
+
+// 原动作的限流
+func (d *ActionThink) GetLimiter() *Limiter {
+	if a, ok := d.Action.(ActionLimit); ok {
+		return a.GetLimiter()
+	}
+	return nil
+}
+
+// 关闭原动作持有的资源, 见io.Closer
+func (d *ActionThink) Close() (err error) {
+	if c, ok := d.Action.(io.Closer); ok {
+		err = c.Close()
+	}
+	return
+}
+
+// 取错误对应的动作状态
+func GetActionErrorStatus(err error) (ret int) {
+	if err == nil {
+		return ActionStatusNormal
+	}
+	var e *ActionError
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return ActionStatusWarn
+}
+
+// 取错误分类, 用于按类计数; 跨进程传递后只剩文本的错误按文本识别
+func GetErrorClass(err error) (ret string) {
+	var (
+		eHttp   *ErrorHttpStatus
+		eNet    net.Error
+		eDns    *net.DNSError
+		eAssert *ErrorAssert
+		ePanic  *ErrorPanic
+		eTls    tls.RecordHeaderError
+		eCert   *tls.CertificateVerificationError
+		eAuth   x509.UnknownAuthorityError
+		eHost   x509.HostnameError
+		eInv    x509.CertificateInvalidError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &ePanic):
+		return ErrorClassPanic
+	case errors.As(err, &eAssert):
+		return ErrorClassAssert
+	case errors.As(err, &eHttp):
+		if eHttp.StatusCode >= 500 {
+			return ErrorClassHttp5xx
+		}
+		if eHttp.StatusCode >= 400 {
+			return ErrorClassHttp4xx
+		}
+		return fmt.Sprintf(`http_%dxx`, eHttp.StatusCode/100)
+	case errors.As(err, &eDns):
+		return ErrorClassDns
+	case errors.As(err, &eTls), errors.As(err, &eCert), errors.As(err, &eAuth), errors.As(err, &eHost), errors.As(err, &eInv):
+		return ErrorClassTls
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassConnReset
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &eNet) && eNet.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	}
+	switch GetActionErrorStatus(err) {
+	case ActionStatusFreeze:
+		return ErrorClassTimeout
+	case ActionStatusClose:
+		return ErrorClassCanceled
+	}
+	text := err.Error()
+	switch {
+	case strings.HasPrefix(text, "panic: "):
+		return ErrorClassPanic
+	case strings.Contains(text, "connection refused"):
+		return ErrorClassConnRefused
+	case strings.Contains(text, "connection reset"), strings.Contains(text, "broken pipe"):
+		return ErrorClassConnReset
+	case strings.Contains(text, "no such host"):
+		return ErrorClassDns
+	case strings.Contains(text, "tls: "), strings.Contains(text, "x509: "):
+		return ErrorClassTls
+	case strings.Contains(text, "timeout"), strings.Contains(text, "deadline exceeded"):
+		return ErrorClassTimeout
+	}
+	return ErrorClassOther
+}
+
 //
 func (d *ActionOne) Run(u *Robot, step, batch int) (ret interface{}, err error) {
 	if d.Fn != nil {
@@ -51,6 +241,11 @@ func (d *ActionOne) RunAfter(u *Robot, step, batch int) (err error) {
 	return
 }
 
+//
+func (d *ActionOne) GetLimiter() *Limiter {
+	return d.Limiter
+}
+
 //
 func (d *ActionOne) GetName() (ret string) {
 	return d.Name
@@ -0,0 +1,245 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 内置动作类型
+const (
+	PlanActionHttp = "http" // http请求
+)
+
+const (
+	actionHttpStoreClient = "box-http-client" // 机器人私有存储: http客户端
+)
+
+// http请求动作, 方法/地址/头部/内容均为模板, 见ActionTemplate
+type ActionHttp struct {
+	Name    string            `json:"name" yaml:"name"`       // 动作命名
+	Method  string            `json:"method" yaml:"method"`   // 请求方法, 默认GET
+	Url     string            `json:"url" yaml:"url"`         // 请求地址
+	Header  map[string]string `json:"header" yaml:"header"`   // 请求头
+	Body    string            `json:"body" yaml:"body"`       // 请求内容
+	Extract map[string]string `json:"extract" yaml:"extract"` // 从json返回中提取变量: 变量名->路径, 如 token: data.token
+	Expect  []int             `json:"expect" yaml:"expect"`   // 视为成功的状态码, 默认小于400即成功
+	Timeout int64             `json:"timeout" yaml:"timeout"` // 请求超时,单位毫秒, 0:不超时
+	// 其它提取方式
+	ExtractHeader map[string]string `json:"extractHeader" yaml:"extractHeader"` // 从返回头提取变量: 变量名->头部名
+	ExtractRegexp map[string]string `json:"extractRegexp" yaml:"extractRegexp"` // 从返回内容按正则提取变量: 变量名->正则, 取第一个分组
+	//
+	Transport http.RoundTripper `json:"-" yaml:"-"` // 共用的传输层, 默认http.DefaultTransport
+	//
+	tplMethod  *ActionTemplate
+	tplUrl     *ActionTemplate
+	tplBody    *ActionTemplate
+	tplHeader  map[string]*ActionTemplate
+	regExtract map[string]*regexp.Regexp
+}
+
+// http请求结果
+type ActionHttpResult struct {
+	StatusCode int         // 状态码
+	Header     http.Header // 返回头
+	Body       []byte      // 返回内容
+}
+
+// http状态码错误
+type ErrorHttpStatus struct {
+	StatusCode int    // 状态码
+	Method     string // 请求方法
+	Url        string // 请求地址
+}
+
+func init() {
+	RegisterAction(PlanActionHttp, func(act *PlanAction) (ret Action, err error) {
+		d := new(ActionHttp)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionHttp(d)
+	})
+}
+
+// 创建http请求动作, 编译模板
+func NewActionHttp(s *ActionHttp) (d *ActionHttp, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionHttp)
+	}
+	if len(d.Url) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("url")
+	}
+	if len(d.Method) == 0 {
+		d.Method = http.MethodGet
+	}
+	if d.tplMethod, err = NewActionTemplate(d.Method); err != nil {
+		return
+	}
+	if d.tplUrl, err = NewActionTemplate(d.Url); err != nil {
+		return
+	}
+	if d.tplBody, err = NewActionTemplate(d.Body); err != nil {
+		return
+	}
+	d.tplHeader = map[string]*ActionTemplate{}
+	for k, v := range d.Header {
+		if d.tplHeader[k], err = NewActionTemplate(v); err != nil {
+			return
+		}
+	}
+	d.regExtract = map[string]*regexp.Regexp{}
+	for k, v := range d.ExtractRegexp {
+		if d.regExtract[k], err = regexp.Compile(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+//
+func (e *ErrorHttpStatus) Error() string {
+	return fmt.Sprintf("http status %d %s %s", e.StatusCode, e.Method, e.Url)
+}
+
+// 执行请求
+func (d *ActionHttp) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		method, url, body string
+		req               *http.Request
+		resp              *http.Response
+		result            = new(ActionHttpResult)
+	)
+	if method, err = d.tplMethod.Render(u, step, batch); err != nil {
+		return
+	}
+	if url, err = d.tplUrl.Render(u, step, batch); err != nil {
+		return
+	}
+	if body, err = d.tplBody.Render(u, step, batch); err != nil {
+		return
+	}
+
+	// 请求
+	ctx := u.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	if req, err = http.NewRequest(strings.ToUpper(method), url, strings.NewReader(body)); err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	for k, tpl := range d.tplHeader {
+		var v string
+		if v, err = tpl.Render(u, step, batch); err != nil {
+			return
+		}
+		req.Header.Set(k, v)
+	}
+	if resp, err = d.GetClient(u).Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Header = resp.Header
+	if result.Body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	ret = result
+
+	// 状态码
+	if d.isExpect(resp.StatusCode) == false {
+		err = &ErrorHttpStatus{StatusCode: resp.StatusCode, Method: req.Method, Url: url}
+		return
+	}
+
+	// 提取变量
+	if len(d.Extract) > 0 {
+		var data interface{}
+		if err = json.Unmarshal(result.Body, &data); err != nil {
+			err = fmt.Errorf(`extract from %s: %v`, url, err)
+			return
+		}
+		for key, path := range d.Extract {
+			v, ok := PubJsonPath(data, path)
+			if !ok {
+				err = NewErrorAssert(`extract "%s" from %s: path "%s" not found`, key, url, path)
+				return
+			}
+			u.SetVar(key, v)
+		}
+	}
+	for key, name := range d.ExtractHeader {
+		v := resp.Header.Get(name)
+		if len(v) == 0 {
+			err = NewErrorAssert(`extract "%s" from %s: header "%s" not found`, key, url, name)
+			return
+		}
+		u.SetVar(key, v)
+	}
+	for key, reg := range d.regExtract {
+		m := reg.FindSubmatch(result.Body)
+		if len(m) == 0 {
+			err = NewErrorAssert(`extract "%s" from %s: regexp "%s" not match`, key, url, reg)
+			return
+		}
+		if len(m) > 1 {
+			u.SetVar(key, string(m[1]))
+		} else {
+			u.SetVar(key, string(m[0]))
+		}
+	}
+	return
+}
+
+//
+func (d *ActionHttp) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionHttp) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionHttp) GetName() (ret string) {
+	return d.Name
+}
+
+// 取机器人的http客户端, 每个机器人独立保存cookie
+func (d *ActionHttp) GetClient(u *Robot) (ret *http.Client) {
+	return u.GetStore(actionHttpStoreClient, func() interface{} {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar, Transport: d.Transport}
+	}).(*http.Client)
+}
+
+// 是否为期望的状态码
+func (d *ActionHttp) isExpect(code int) bool {
+	if len(d.Expect) == 0 {
+		return code < http.StatusBadRequest
+	}
+	for _, c := range d.Expect {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试http动作: 模板,cookie,变量提取与状态码
+func Test_ActionHttp(t *testing.T) {
+	as := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: r.URL.Query().Get("u")})
+			fmt.Fprintf(w, `{"data":{"token":"t-%s"}}`, r.URL.Query().Get("u"))
+		case "/me":
+			c, err := r.Cookie("sid")
+			if err != nil || r.Header.Get("Authorization") != "t-"+c.Value {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"name":"%s"}`, c.Value)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	scene := NewScene(nil)
+	robot := NewRobot(&Robot{Name: "robot", Scene: scene, Serial: 7})
+	login, err := NewActionHttp(&ActionHttp{
+		Name:    "login",
+		Url:     srv.URL + "/login?u={{.Robot.Serial}}",
+		Extract: map[string]string{"token": "data.token"},
+	})
+	as.Nil(err)
+	me, err := NewActionHttp(&ActionHttp{
+		Name:    "me",
+		Url:     srv.URL + "/me",
+		Header:  map[string]string{"Authorization": "{{.Var.token}}"},
+		Extract: map[string]string{"name": "name"},
+	})
+	as.Nil(err)
+	missing, err := NewActionHttp(&ActionHttp{Name: "missing", Url: srv.URL + "/missing"})
+	as.Nil(err)
+
+	_, err = login.Run(robot, 0, 0)
+	as.Nil(err)
+	as.Equal("t-7", robot.GetVar("token"))
+	ret, err := me.Run(robot, 1, 0)
+	as.Nil(err)
+	as.Equal(http.StatusOK, ret.(*ActionHttpResult).StatusCode)
+	as.Equal("7", robot.GetVar("name"))
+
+	// 状态码
+	_, err = missing.Run(robot, 2, 0)
+	as.IsType(&ErrorHttpStatus{}, err)
+	missing.Expect = []int{http.StatusNotFound}
+	_, err = missing.Run(robot, 2, 0)
+	as.Nil(err)
+
+	// 其它机器人没有cookie
+	other := NewRobot(&Robot{Name: "robot", Scene: scene, Vars: map[string]interface{}{"token": "t-7"}})
+	_, err = me.Run(other, 1, 0)
+	as.NotNil(err)
+}
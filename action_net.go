@@ -0,0 +1,393 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// 内置动作类型
+const (
+	PlanActionTcp = "tcp" // tcp二进制协议
+	PlanActionUdp = "udp" // udp二进制协议
+)
+
+// 分帧方式
+const (
+	NetFramerNone      = ""          // 不读取回复
+	NetFramerLength    = "length"    // 长度前缀
+	NetFramerDelimiter = "delimiter" // 分隔符结尾
+	NetFramerFixed     = "fixed"     // 固定长度
+)
+
+const (
+	actionNetStoreConn = "box-net-conn-" // 机器人私有存储: 连接, 后接连接名
+	actionNetFrameMax  = 16 << 20        // 长度前缀允许的最大帧
+	actionNetUdpMax    = 64 << 10        // udp最大报文
+)
+
+// 消息编码函数, 设置后代替Message模板
+type ActionNetEncoder func(u *Robot, step, batch int) (ret []byte, err error)
+
+// 回复校验函数, 返回错误即动作失败
+type ActionNetDecoder func(u *Robot, step, batch int, reply []byte) (err error)
+
+// 分帧: 从连接中读取一条完整回复
+type NetFramer interface {
+	ReadFrame(r *bufio.Reader) (ret []byte, err error)
+}
+
+// 长度前缀分帧
+type NetFramerLen struct {
+	Size    int  // 长度字段字节数: 1|2|4|8, 默认4
+	Little  bool // true: 小端序
+	Include bool // true: 长度包含长度字段本身
+}
+
+// 分隔符分帧, 回复包含分隔符
+type NetFramerDelim struct {
+	Delim []byte // 分隔符, 默认\n
+}
+
+// 固定长度分帧
+type NetFramerFix struct {
+	Size int // 帧长度
+}
+
+// tcp/udp动作: 每个机器人拨号并保持连接(机器人关闭时断开), 写入消息后按分帧读取回复
+type ActionNet struct {
+	Name    string `json:"name" yaml:"name"`       // 动作命名
+	Network string `json:"network" yaml:"network"` // tcp|udp
+	Conn    string `json:"conn" yaml:"conn"`       // 连接名, 同名动作共用连接, 默认按地址
+	Addr    string `json:"addr" yaml:"addr"`       // 地址模板 host:port
+	Message string `json:"message" yaml:"message"` // 消息模板
+	Hex     bool   `json:"hex" yaml:"hex"`         // true: 消息渲染后按十六进制解码, 可含空格
+	Timeout int64  `json:"timeout" yaml:"timeout"` // 连接与读写超时,单位毫秒, 0:不超时
+	Close   bool   `json:"close" yaml:"close"`     // true: 收到回复后断开, 下次重新连接
+	// 分帧
+	Framer       string `json:"framer" yaml:"framer"`             // none|length|delimiter|fixed
+	FramerSize   int    `json:"framerSize" yaml:"framerSize"`     // length:长度字段字节数 fixed:帧长度
+	FramerLittle bool   `json:"framerLittle" yaml:"framerLittle"` // length: 小端序
+	FramerInc    bool   `json:"framerInc" yaml:"framerInc"`       // length: 长度包含长度字段
+	FramerDelim  string `json:"framerDelim" yaml:"framerDelim"`   // delimiter: 分隔符, 默认\n
+	//
+	Encoder     ActionNetEncoder `json:"-" yaml:"-"` // 自定义编码
+	Decoder     ActionNetDecoder `json:"-" yaml:"-"` // 自定义校验
+	FramerCodec NetFramer        `json:"-" yaml:"-"` // 自定义分帧, 设置后忽略Framer
+	//
+	tplAddr    *ActionTemplate
+	tplMessage *ActionTemplate
+}
+
+// tcp/udp执行结果
+type ActionNetResult struct {
+	Reply         []byte        // 回复
+	TimeConnect   time.Duration // 建立连接耗时, 复用连接时为0
+	TimeFirstByte time.Duration // 写入后收到首字节耗时
+}
+
+// 机器人持有的连接
+type actionNetConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func init() {
+	for _, network := range []string{PlanActionTcp, PlanActionUdp} {
+		network := network
+		RegisterAction(network, func(act *PlanAction) (ret Action, err error) {
+			d := new(ActionNet)
+			if err = act.Decode(d); err != nil {
+				return
+			}
+			d.Name = act.Name
+			d.Network = network
+			return NewActionNet(d)
+		})
+	}
+}
+
+// 创建tcp/udp动作
+func NewActionNet(s *ActionNet) (d *ActionNet, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionNet)
+	}
+	if len(d.Network) == 0 {
+		d.Network = PlanActionTcp
+	}
+	if d.Network != PlanActionTcp && d.Network != PlanActionUdp {
+		return nil, contrib.ErrParamInvalid.SetVars("network")
+	}
+	if len(d.Addr) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("addr")
+	}
+	if d.FramerCodec == nil {
+		switch d.Framer {
+		case NetFramerNone:
+		case NetFramerLength:
+			d.FramerCodec = &NetFramerLen{Size: d.FramerSize, Little: d.FramerLittle, Include: d.FramerInc}
+		case NetFramerDelimiter:
+			d.FramerCodec = &NetFramerDelim{Delim: []byte(d.FramerDelim)}
+		case NetFramerFixed:
+			if d.FramerSize <= 0 {
+				return nil, contrib.ErrParamInvalid.SetVars("framerSize")
+			}
+			d.FramerCodec = &NetFramerFix{Size: d.FramerSize}
+		default:
+			return nil, contrib.ErrParamInvalid.SetVars("framer")
+		}
+	}
+	if d.tplAddr, err = NewActionTemplate(d.Addr); err != nil {
+		return
+	}
+	if d.tplMessage, err = NewActionTemplate(d.Message); err != nil {
+		return
+	}
+	return
+}
+
+// 写入消息并读取回复
+func (d *ActionNet) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		msg    []byte
+		conn   *actionNetConn
+		result = new(ActionNetResult)
+	)
+	defer func() {
+		// 超时标记为暂停
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			err = NewActionError(ActionStatusFreeze, err)
+		}
+	}()
+	if msg, err = d.encode(u, step, batch); err != nil {
+		return
+	}
+	if conn, err = d.getConn(u, step, batch, result); err != nil {
+		return
+	}
+	ret = result
+	if d.Close {
+		defer d.closeConn(u, conn)
+	}
+	if d.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(time.Duration(d.Timeout) * time.Millisecond))
+	}
+
+	// 写入
+	start := time.Now()
+	if _, err = conn.Write(msg); err != nil {
+		d.closeConn(u, conn)
+		return
+	}
+	if d.FramerCodec == nil {
+		return
+	}
+
+	// 首字节
+	if _, err = conn.r.Peek(1); err != nil {
+		d.closeConn(u, conn)
+		return
+	}
+	result.TimeFirstByte = time.Since(start)
+
+	// 完整回复
+	if d.Network == PlanActionUdp {
+		// 一个报文即一条回复
+		buf := make([]byte, actionNetUdpMax)
+		var n int
+		n, err = conn.r.Read(buf)
+		result.Reply = buf[:n]
+		if err == nil {
+			result.Reply, err = d.FramerCodec.ReadFrame(bufio.NewReader(bytes.NewReader(result.Reply)))
+		}
+	} else {
+		result.Reply, err = d.FramerCodec.ReadFrame(conn.r)
+	}
+	if err != nil {
+		d.closeConn(u, conn)
+		return
+	}
+	if d.Decoder != nil {
+		err = d.Decoder(u, step, batch, result.Reply)
+	}
+	return
+}
+
+//
+func (d *ActionNet) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionNet) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionNet) GetName() (ret string) {
+	return d.Name
+}
+
+// 编码消息
+func (d *ActionNet) encode(u *Robot, step, batch int) (ret []byte, err error) {
+	if d.Encoder != nil {
+		return d.Encoder(u, step, batch)
+	}
+	var s string
+	if s, err = d.tplMessage.Render(u, step, batch); err != nil {
+		return
+	}
+	if d.Hex {
+		return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	}
+	return []byte(s), nil
+}
+
+// 取机器人的连接, 不存在时拨号并记录连接耗时
+func (d *ActionNet) getConn(u *Robot, step, batch int, result *ActionNetResult) (ret *actionNetConn, err error) {
+	var (
+		addr string
+		key  string
+		ok   bool
+	)
+	if addr, err = d.tplAddr.Render(u, step, batch); err != nil {
+		return
+	}
+	if key = d.Conn; len(key) == 0 {
+		key = d.Network + "://" + addr
+	}
+	key = actionNetStoreConn + key
+	if ret, ok = u.GetStore(key, nil).(*actionNetConn); ok {
+		return
+	}
+	ctx := u.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	var (
+		conn  net.Conn
+		start = time.Now()
+	)
+	if conn, err = (&net.Dialer{}).DialContext(ctx, d.Network, addr); err != nil {
+		return
+	}
+	result.TimeConnect = time.Since(start)
+	ret = &actionNetConn{Conn: conn}
+	if d.Network == PlanActionUdp {
+		ret.r = bufio.NewReaderSize(conn, actionNetUdpMax)
+	} else {
+		ret.r = bufio.NewReader(conn)
+	}
+	u.SetStore(key, ret)
+	return
+}
+
+// 断开连接, 出错后连接状态不可知, 下次重连
+func (d *ActionNet) closeConn(u *Robot, conn *actionNetConn) {
+	conn.Close()
+	u.lockVars.Lock()
+	for k, v := range u.store {
+		if v == conn {
+			delete(u.store, k)
+		}
+	}
+	u.lockVars.Unlock()
+}
+
+//
+func (d *ActionNetResult) GetTimeConnect() time.Duration {
+	return d.TimeConnect
+}
+
+//
+func (d *ActionNetResult) GetTimeFirstByte() time.Duration {
+	return d.TimeFirstByte
+}
+
+// 读取长度前缀帧, 返回内容不含长度字段
+func (d *NetFramerLen) ReadFrame(r *bufio.Reader) (ret []byte, err error) {
+	var (
+		size   = d.Size
+		head   []byte
+		length uint64
+		order  binary.ByteOrder = binary.BigEndian
+	)
+	if size == 0 {
+		size = 4
+	}
+	if d.Little {
+		order = binary.LittleEndian
+	}
+	head = make([]byte, size)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return
+	}
+	switch size {
+	case 1:
+		length = uint64(head[0])
+	case 2:
+		length = uint64(order.Uint16(head))
+	case 4:
+		length = uint64(order.Uint32(head))
+	case 8:
+		length = order.Uint64(head)
+	default:
+		return nil, contrib.ErrParamInvalid.SetVars("framerSize")
+	}
+	if d.Include {
+		if length < uint64(size) {
+			return nil, fmt.Errorf(`frame length %d < %d`, length, size)
+		}
+		length -= uint64(size)
+	}
+	if length > actionNetFrameMax {
+		return nil, fmt.Errorf(`frame length %d out of range`, length)
+	}
+	ret = make([]byte, length)
+	_, err = io.ReadFull(r, ret)
+	return
+}
+
+// 读取到分隔符
+func (d *NetFramerDelim) ReadFrame(r *bufio.Reader) (ret []byte, err error) {
+	delim := d.Delim
+	if len(delim) == 0 {
+		delim = []byte("\n")
+	}
+	for {
+		var b []byte
+		if b, err = r.ReadBytes(delim[len(delim)-1]); err != nil {
+			return
+		}
+		ret = append(ret, b...)
+		if bytes.HasSuffix(ret, delim) {
+			return
+		}
+		if len(ret) > actionNetFrameMax {
+			return nil, fmt.Errorf(`frame length %d out of range`, len(ret))
+		}
+	}
+}
+
+// 读取固定长度
+func (d *NetFramerFix) ReadFrame(r *bufio.Reader) (ret []byte, err error) {
+	ret = make([]byte, d.Size)
+	_, err = io.ReadFull(r, ret)
+	return
+}
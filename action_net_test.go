@@ -0,0 +1,107 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 测试tcp长度前缀与udp报文
+func Test_ActionNet(t *testing.T) {
+	as := require.New(t)
+
+	// tcp: 2字节长度前缀, 回复原内容
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	as.Nil(err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					head := make([]byte, 2)
+					if _, err := io.ReadFull(r, head); err != nil {
+						return
+					}
+					body := make([]byte, binary.BigEndian.Uint16(head))
+					io.ReadFull(r, body)
+					time.Sleep(time.Millisecond * 20)
+					conn.Write(append(head, body...))
+				}
+			}()
+		}
+	}()
+	tcp, err := NewActionNet(&ActionNet{
+		Name:       "tcp",
+		Addr:       lis.Addr().String(),
+		Message:    "00 05 {{printf \"%x\" \"hello\"}}",
+		Hex:        true,
+		Framer:     NetFramerLength,
+		FramerSize: 2,
+		Timeout:    1000,
+	})
+	as.Nil(err)
+	robot := NewRobot(&Robot{Name: "robot"})
+	ret, err := tcp.Run(robot, 0, 0)
+	as.Nil(err)
+	r := ret.(*ActionNetResult)
+	as.Equal("hello", string(r.Reply))
+	as.True(r.TimeConnect > 0)
+	as.True(r.TimeFirstByte >= time.Millisecond*20)
+	ret, err = tcp.Run(robot, 1, 0)
+	as.Nil(err)
+	as.Zero(ret.(*ActionNetResult).TimeConnect) // 复用连接
+
+	// udp: 回显
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	as.Nil(err)
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte("re:"), buf[:n]...), addr)
+		}
+	}()
+	udp, err := NewActionNet(&ActionNet{
+		Name:    "udp",
+		Network: PlanActionUdp,
+		Addr:    pc.LocalAddr().String(),
+		Encoder: func(u *Robot, step, batch int) ([]byte, error) {
+			return []byte{'p', byte('0' + step)}, nil
+		},
+		Framer:     NetFramerFixed,
+		FramerSize: 5,
+		Timeout:    1000,
+	})
+	as.Nil(err)
+	ret, err = udp.Run(robot, 1, 0)
+	as.Nil(err)
+	as.Equal("re:p1", string(ret.(*ActionNetResult).Reply))
+
+	// udp: 不分帧时只写不读
+	udpNone, err := NewActionNet(&ActionNet{
+		Name:    "udpNone",
+		Network: PlanActionUdp,
+		Addr:    pc.LocalAddr().String(),
+		Message: "ping",
+	})
+	as.Nil(err)
+	ret, err = udpNone.Run(robot, 1, 0)
+	as.Nil(err)
+	as.Nil(ret.(*ActionNetResult).Reply)
+	as.Nil(robot.Close())
+}
@@ -0,0 +1,137 @@
+package box
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 动作模板中可用的函数, 可在注册动作前追加; 随机函数在机器人有Rand时由其生成, 种子相同时渲染结果相同
+var ActionTemplateFuncs = template.FuncMap{
+	"randCode":    PubRandomCode,     // 随机字符串 {{randCode 8}}
+	"randCodeNum": PubRandomCodeNum,  // 随机数字串 {{randCodeNum 6}}
+	"randInt":     actionTemplateInt, // 随机整数[0,n) {{randInt 100}}
+	"uuid":        actionTemplateUuid,
+	"unix":        func() int64 { return time.Now().Unix() },
+	"unixMilli":   func() int64 { return time.Now().UnixNano() / int64(time.Millisecond) },
+	"json":        func(v interface{}) string { return PubJsonMust(v) },
+	"quote":       strconv.Quote,
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+}
+
+// 动作模板: 引用机器人变量 {{.Var.token}}, 机器人 {{.Robot.Serial}}, 执行位置 {{.Step}} {{.Batch}}, 可复现的随机数 {{.Robot.Rand.Intn 100}}
+type ActionTemplate struct {
+	Text string // 模板原文
+	//
+	tpl    *template.Template
+	random bool // 使用了随机函数
+}
+
+// 模板数据
+type ActionTemplateData struct {
+	Robot *Robot                 // 机器人
+	Var   map[string]interface{} // 机器人变量副本
+	Step  int                    // 执行位置
+	Batch int                    // 执行批次
+}
+
+// 编译模板, 原文为空时渲染为空
+func NewActionTemplate(text string) (d *ActionTemplate, err error) {
+	d = &ActionTemplate{Text: text}
+	if strings.Contains(text, "{{") {
+		if d.tpl, err = template.New("").Funcs(ActionTemplateFuncs).Parse(text); err != nil {
+			return nil, err
+		}
+		for name := range actionTemplateRandFuncs(nil) {
+			if strings.Contains(text, name) {
+				d.random = true
+			}
+		}
+	}
+	return
+}
+
+// 渲染模板
+func (d *ActionTemplate) Render(u *Robot, step, batch int) (ret string, err error) {
+	if d == nil {
+		return
+	}
+	if d.tpl == nil {
+		return d.Text, nil
+	}
+	tpl := d.tpl
+	if d.random && u.Rand != nil {
+		// 随机函数改由机器人的随机数生成
+		if tpl, err = d.tpl.Clone(); err != nil {
+			return
+		}
+		tpl.Funcs(actionTemplateRandFuncs(u))
+	}
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, &ActionTemplateData{
+		Robot: u,
+		Var:   u.GetVars(),
+		Step:  step,
+		Batch: batch,
+	}); err != nil {
+		return
+	}
+	ret = buf.String()
+	return
+}
+
+//
+func actionTemplateInt(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	r, _ := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	return int(r.Int64())
+}
+
+// 由机器人的随机数生成的随机函数, 只在本机器人的动作中调用
+func actionTemplateRandFuncs(u *Robot) template.FuncMap {
+	code := func(charset string, length int) string {
+		b := make([]byte, length)
+		for i := range b {
+			b[i] = charset[u.Rand.Intn(len(charset))]
+		}
+		return string(b)
+	}
+	return template.FuncMap{
+		"randCode":    func(length int) string { return code(randCharset, length) },
+		"randCodeNum": func(length int) string { return code(randCharsetNum, length) },
+		"randInt": func(n int) int {
+			if n <= 0 {
+				return 0
+			}
+			return u.Rand.Intn(n)
+		},
+		"uuid": func() string {
+			b := make([]byte, 16)
+			u.Rand.Read(b)
+			return actionTemplateUuidText(b)
+		},
+	}
+}
+
+//
+func actionTemplateUuid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return actionTemplateUuidText(b)
+}
+
+// 由16字节生成v4格式的uuid
+func actionTemplateUuidText(b []byte) string {
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
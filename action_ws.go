@@ -0,0 +1,519 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"github.com/gorilla/websocket"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置动作类型
+const (
+	PlanActionWsConnect = "ws-connect" // 建立websocket连接
+	PlanActionWsSend    = "ws-send"    // 发送消息, 可等待匹配的回复
+	PlanActionWsExpect  = "ws-expect"  // 等待匹配的消息
+)
+
+const (
+	actionWsStoreConn   = "box-ws-conn-" // 机器人私有存储: 连接, 后接连接名
+	actionWsConnDefault = "default"      // 默认连接名
+	actionWsInboxMax    = 1024           // 未匹配消息的缓存上限, 超出丢弃最早的
+)
+
+var (
+	// websocket默认等待回复时间
+	DefaultActionWsTimeout = time.Second * 10
+)
+
+// 建立websocket连接, 连接保存在机器人上, 机器人关闭时断开
+type ActionWsConnect struct {
+	Name    string            `json:"name" yaml:"name"`       // 动作命名
+	Conn    string            `json:"conn" yaml:"conn"`       // 连接名, 同一机器人可保持多个连接, 默认default
+	Url     string            `json:"url" yaml:"url"`         // 地址模板 ws://host/path
+	Header  map[string]string `json:"header" yaml:"header"`   // 握手请求头模板
+	Timeout int64             `json:"timeout" yaml:"timeout"` // 握手超时,单位毫秒
+	//
+	Dialer *websocket.Dialer `json:"-" yaml:"-"` // 默认websocket.DefaultDialer
+	//
+	tplUrl    *ActionTemplate
+	tplHeader map[string]*ActionTemplate
+}
+
+// 消息匹配条件, 均为模板, 全部满足才算匹配; 未设置任何条件时匹配任意消息
+type ActionWsMatch struct {
+	Contains string            `json:"contains" yaml:"contains"` // 包含文本
+	Regexp   string            `json:"regexp" yaml:"regexp"`     // 正则匹配
+	Json     map[string]string `json:"json" yaml:"json"`         // json路径->期望值
+	//
+	tplContains *ActionTemplate
+	tplJson     map[string]*ActionTemplate
+	reg         *regexp.Regexp
+}
+
+// 发送消息; 设置Match或Correlate时等待回复, 耗时即往返时延
+type ActionWsSend struct {
+	Name      string            `json:"name" yaml:"name"`           // 动作命名
+	Conn      string            `json:"conn" yaml:"conn"`           // 连接名
+	Message   string            `json:"message" yaml:"message"`     // 消息模板
+	Binary    bool              `json:"binary" yaml:"binary"`       // true: 以二进制帧发送
+	Correlate string            `json:"correlate" yaml:"correlate"` // 关联路径: 回复中该json路径的值与发送消息中的相同才算匹配, 如 id
+	Match     *ActionWsMatch    `json:"match" yaml:"match"`         // 回复匹配条件
+	Extract   map[string]string `json:"extract" yaml:"extract"`     // 从json回复中提取变量
+	Timeout   int64             `json:"timeout" yaml:"timeout"`     // 等待回复超时,单位毫秒
+	//
+	tplMessage *ActionTemplate
+}
+
+// 等待匹配的消息
+type ActionWsExpect struct {
+	Name    string            `json:"name" yaml:"name"`       // 动作命名
+	Conn    string            `json:"conn" yaml:"conn"`       // 连接名
+	Match   *ActionWsMatch    `json:"match" yaml:"match"`     // 匹配条件
+	Extract map[string]string `json:"extract" yaml:"extract"` // 从json消息中提取变量
+	Timeout int64             `json:"timeout" yaml:"timeout"` // 等待超时,单位毫秒
+}
+
+// 机器人持有的websocket连接, 后台读取消息放入收件箱
+type actionWsConn struct {
+	conn   *websocket.Conn
+	lockW  sync.Mutex    // 写锁
+	lock   sync.Mutex    // 收件箱锁
+	inbox  [][]byte      // 未匹配的消息
+	notify chan struct{} // 收到新消息时关闭并替换
+	err    error         // 读取错误, 连接已断开
+}
+
+func init() {
+	RegisterAction(PlanActionWsConnect, func(act *PlanAction) (ret Action, err error) {
+		d := new(ActionWsConnect)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionWsConnect(d)
+	})
+	RegisterAction(PlanActionWsSend, func(act *PlanAction) (ret Action, err error) {
+		d := new(ActionWsSend)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionWsSend(d)
+	})
+	RegisterAction(PlanActionWsExpect, func(act *PlanAction) (ret Action, err error) {
+		d := new(ActionWsExpect)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionWsExpect(d)
+	})
+}
+
+// 创建连接动作
+func NewActionWsConnect(s *ActionWsConnect) (d *ActionWsConnect, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionWsConnect)
+	}
+	if len(d.Url) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("url")
+	}
+	if d.tplUrl, err = NewActionTemplate(d.Url); err != nil {
+		return
+	}
+	d.tplHeader = map[string]*ActionTemplate{}
+	for k, v := range d.Header {
+		if d.tplHeader[k], err = NewActionTemplate(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 创建发送动作
+func NewActionWsSend(s *ActionWsSend) (d *ActionWsSend, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionWsSend)
+	}
+	if d.tplMessage, err = NewActionTemplate(d.Message); err != nil {
+		return
+	}
+	if d.Match == nil && (len(d.Correlate) > 0 || len(d.Extract) > 0) {
+		d.Match = new(ActionWsMatch)
+	}
+	if d.Match != nil {
+		err = d.Match.compile()
+	}
+	return
+}
+
+// 创建等待动作
+func NewActionWsExpect(s *ActionWsExpect) (d *ActionWsExpect, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionWsExpect)
+	}
+	if d.Match == nil {
+		d.Match = new(ActionWsMatch)
+	}
+	err = d.Match.compile()
+	return
+}
+
+// 建立连接, 已有同名连接时先断开
+func (d *ActionWsConnect) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		url    string
+		header = http.Header{}
+		conn   *websocket.Conn
+		resp   *http.Response
+	)
+	if url, err = d.tplUrl.Render(u, step, batch); err != nil {
+		return
+	}
+	for k, tpl := range d.tplHeader {
+		var v string
+		if v, err = tpl.Render(u, step, batch); err != nil {
+			return
+		}
+		header.Set(k, v)
+	}
+	ctx := u.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	if conn, resp, err = dialer.DialContext(ctx, url, header); err != nil {
+		if resp != nil {
+			err = &ErrorHttpStatus{StatusCode: resp.StatusCode, Method: http.MethodGet, Url: url}
+		}
+		return
+	}
+	key := actionWsStoreConn + actionWsConnName(d.Conn)
+	if old, ok := u.GetStore(key, nil).(*actionWsConn); ok {
+		old.Close()
+	}
+	u.SetStore(key, newActionWsConn(conn))
+	return
+}
+
+//
+func (d *ActionWsConnect) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsConnect) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsConnect) GetName() (ret string) {
+	return d.Name
+}
+
+// 发送消息并等待回复
+func (d *ActionWsSend) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		conn *actionWsConn
+		msg  string
+	)
+	if conn, err = actionWsGetConn(u, d.Conn); err != nil {
+		return
+	}
+	if msg, err = d.tplMessage.Render(u, step, batch); err != nil {
+		return
+	}
+	// 关联值
+	var correlate interface{}
+	if len(d.Correlate) > 0 {
+		var ok bool
+		if correlate, ok = PubJsonPathBytes([]byte(msg), d.Correlate); !ok {
+			err = NewErrorAssert(`correlate path "%s" not found in message`, d.Correlate)
+			return
+		}
+	}
+	msgType := websocket.TextMessage
+	if d.Binary {
+		msgType = websocket.BinaryMessage
+	}
+	if err = conn.Write(msgType, []byte(msg)); err != nil {
+		return
+	}
+	if d.Match == nil {
+		return
+	}
+
+	// 等待回复
+	var match func(b []byte) bool
+	if match, err = d.Match.matcher(u, step, batch); err != nil {
+		return
+	}
+	if len(d.Correlate) > 0 {
+		_match := match
+		match = func(b []byte) bool {
+			v, ok := PubJsonPathBytes(b, d.Correlate)
+			return ok && fmt.Sprint(v) == fmt.Sprint(correlate) && _match(b)
+		}
+	}
+	var reply []byte
+	if reply, err = conn.Wait(u.Context, actionWsTimeout(d.Timeout), match); err != nil {
+		return
+	}
+	ret = string(reply)
+	err = actionWsExtract(u, reply, d.Extract)
+	return
+}
+
+//
+func (d *ActionWsSend) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsSend) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsSend) GetName() (ret string) {
+	return d.Name
+}
+
+// 等待消息
+func (d *ActionWsExpect) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		conn  *actionWsConn
+		match func(b []byte) bool
+		reply []byte
+	)
+	if conn, err = actionWsGetConn(u, d.Conn); err != nil {
+		return
+	}
+	if match, err = d.Match.matcher(u, step, batch); err != nil {
+		return
+	}
+	if reply, err = conn.Wait(u.Context, actionWsTimeout(d.Timeout), match); err != nil {
+		return
+	}
+	ret = string(reply)
+	err = actionWsExtract(u, reply, d.Extract)
+	return
+}
+
+//
+func (d *ActionWsExpect) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsExpect) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionWsExpect) GetName() (ret string) {
+	return d.Name
+}
+
+// 编译匹配条件
+func (d *ActionWsMatch) compile() (err error) {
+	if d.tplContains, err = NewActionTemplate(d.Contains); err != nil {
+		return
+	}
+	if len(d.Regexp) > 0 {
+		if d.reg, err = regexp.Compile(d.Regexp); err != nil {
+			return
+		}
+	}
+	d.tplJson = map[string]*ActionTemplate{}
+	for k, v := range d.Json {
+		if d.tplJson[k], err = NewActionTemplate(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 渲染匹配条件, 返回匹配函数
+func (d *ActionWsMatch) matcher(u *Robot, step, batch int) (ret func(b []byte) bool, err error) {
+	var (
+		contains string
+		values   = map[string]string{}
+	)
+	if contains, err = d.tplContains.Render(u, step, batch); err != nil {
+		return
+	}
+	for k, tpl := range d.tplJson {
+		if values[k], err = tpl.Render(u, step, batch); err != nil {
+			return
+		}
+	}
+	ret = func(b []byte) bool {
+		if len(contains) > 0 && !strings.Contains(string(b), contains) {
+			return false
+		}
+		if d.reg != nil && !d.reg.Match(b) {
+			return false
+		}
+		if len(values) > 0 {
+			var data interface{}
+			if json.Unmarshal(b, &data) != nil {
+				return false
+			}
+			for path, want := range values {
+				if v, ok := PubJsonPath(data, path); !ok || fmt.Sprint(v) != want {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return
+}
+
+//
+func newActionWsConn(conn *websocket.Conn) (d *actionWsConn) {
+	d = &actionWsConn{conn: conn, notify: make(chan struct{})}
+	go d.read()
+	return
+}
+
+// 后台读取消息
+func (d *actionWsConn) read() {
+	for {
+		_, b, err := d.conn.ReadMessage()
+		d.lock.Lock()
+		if err != nil {
+			d.err = err
+		} else {
+			d.inbox = append(d.inbox, b)
+			if len(d.inbox) > actionWsInboxMax {
+				d.inbox = d.inbox[len(d.inbox)-actionWsInboxMax:]
+			}
+		}
+		close(d.notify)
+		d.notify = make(chan struct{})
+		d.lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 发送
+func (d *actionWsConn) Write(msgType int, b []byte) (err error) {
+	d.lockW.Lock()
+	err = d.conn.WriteMessage(msgType, b)
+	d.lockW.Unlock()
+	return
+}
+
+// 等待第一个匹配的消息, 并从收件箱中取出
+func (d *actionWsConn) Wait(ctx context.Context, timeout time.Duration, match func(b []byte) bool) (ret []byte, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		d.lock.Lock()
+		for i, b := range d.inbox {
+			if match(b) {
+				d.inbox = append(d.inbox[:i], d.inbox[i+1:]...)
+				d.lock.Unlock()
+				return b, nil
+			}
+		}
+		if d.err != nil {
+			err = d.err
+			d.lock.Unlock()
+			return
+		}
+		notify := d.notify
+		d.lock.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, NewActionError(ActionStatusFreeze, contrib.ErrTimeout.SetVars("websocket reply"))
+		case <-ctx.Done():
+			return nil, NewActionError(ActionStatusClose, ctx.Err())
+		}
+	}
+}
+
+// 断开连接, 机器人关闭时调用
+func (d *actionWsConn) Close() (err error) {
+	d.lockW.Lock()
+	d.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	d.lockW.Unlock()
+	return d.conn.Close()
+}
+
+// 取机器人的连接
+func actionWsGetConn(u *Robot, name string) (ret *actionWsConn, err error) {
+	name = actionWsConnName(name)
+	var ok bool
+	if ret, ok = u.GetStore(actionWsStoreConn+name, nil).(*actionWsConn); !ok {
+		err = fmt.Errorf(`websocket "%s" not connected`, name)
+	}
+	return
+}
+
+//
+func actionWsConnName(name string) string {
+	if len(name) == 0 {
+		return actionWsConnDefault
+	}
+	return name
+}
+
+//
+func actionWsTimeout(timeout int64) time.Duration {
+	if timeout > 0 {
+		return time.Duration(timeout) * time.Millisecond
+	}
+	return DefaultActionWsTimeout
+}
+
+// 从json消息中提取变量
+func actionWsExtract(u *Robot, b []byte, extract map[string]string) (err error) {
+	if len(extract) == 0 {
+		return
+	}
+	var data interface{}
+	if err = json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf(`extract from websocket: %v`, err)
+	}
+	for key, path := range extract {
+		v, ok := PubJsonPath(data, path)
+		if !ok {
+			return NewErrorAssert(`extract "%s" from websocket: path "%s" not found`, key, path)
+		}
+		u.SetVar(key, v)
+	}
+	return
+}
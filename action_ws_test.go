@@ -0,0 +1,93 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"github.com/gorilla/websocket"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试websocket连接,往返匹配与关闭
+func Test_ActionWs(t *testing.T) {
+	as := require.New(t)
+	var closed int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"welcome","user":"`+r.URL.Query().Get("u")+`"}`))
+		for {
+			_, b, err := conn.ReadMessage()
+			if err != nil {
+				atomic.AddInt32(&closed, 1)
+				return
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(b, &msg)
+			// 先回复一条无关消息, 再延时回复
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"noise"}`))
+			time.Sleep(time.Millisecond * 20)
+			msg["type"] = "reply"
+			b, _ = json.Marshal(msg)
+			conn.WriteMessage(websocket.TextMessage, b)
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	connect, err := NewActionWsConnect(&ActionWsConnect{Name: "connect", Url: url + "/?u={{.Robot.Serial}}"})
+	as.Nil(err)
+	welcome, err := NewActionWsExpect(&ActionWsExpect{
+		Name:    "welcome",
+		Match:   &ActionWsMatch{Json: map[string]string{"type": "welcome"}},
+		Extract: map[string]string{"user": "user"},
+	})
+	as.Nil(err)
+	send, err := NewActionWsSend(&ActionWsSend{
+		Name:      "send",
+		Message:   `{"id":"{{uuid}}","text":"hi {{.Var.user}}"}`,
+		Correlate: "id",
+		Match:     &ActionWsMatch{Json: map[string]string{"type": "reply"}},
+		Extract:   map[string]string{"text": "text"},
+	})
+	as.Nil(err)
+
+	robot := NewRobot(&Robot{Name: "robot", Serial: 3})
+	_, err = send.Run(robot, 0, 0)
+	as.NotNil(err) // 未连接
+
+	_, err = connect.Run(robot, 0, 0)
+	as.Nil(err)
+	_, err = welcome.Run(robot, 1, 0)
+	as.Nil(err)
+	as.Equal("3", robot.GetVar("user"))
+	start := time.Now()
+	ret, err := send.Run(robot, 2, 0)
+	as.Nil(err)
+	as.True(time.Since(start) >= time.Millisecond*20)
+	as.Contains(ret, `"reply"`)
+	as.Equal("hi 3", robot.GetVar("text"))
+
+	// 等待超时
+	timeout, err := NewActionWsExpect(&ActionWsExpect{Name: "timeout", Timeout: 50,
+		Match: &ActionWsMatch{Contains: "never"}})
+	as.Nil(err)
+	_, err = timeout.Run(robot, 3, 0)
+	as.Equal(ActionStatusFreeze, GetActionErrorStatus(err))
+
+	// 机器人关闭时断开
+	as.Nil(robot.Close())
+	for i := 0; i < 100 && atomic.LoadInt32(&closed) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	as.EqualValues(1, atomic.LoadInt32(&closed))
+}
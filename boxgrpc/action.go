@@ -0,0 +1,356 @@
+// Package boxgrpc 提供gRPC动作, 通过描述文件或服务端反射调用, 无需生成客户端代码
+package boxgrpc
+
+import (
+	"github.com/suboat/go-box"
+	"github.com/suboat/go-contrib"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 动作类型
+const (
+	PlanActionGrpc = "grpc" // gRPC调用
+)
+
+const (
+	actionGrpcStoreConn = "box-grpc-conn-" // 机器人私有存储: 连接, 后接服务地址
+)
+
+// gRPC动作: 请求与元数据均为模板, 见box.ActionTemplate
+type ActionGrpc struct {
+	Name       string            `json:"name" yaml:"name"`             // 动作命名
+	Target     string            `json:"target" yaml:"target"`         // 服务地址 host:port
+	Method     string            `json:"method" yaml:"method"`         // 方法全名 package.Service/Method
+	Descriptor string            `json:"descriptor" yaml:"descriptor"` // 描述文件(protoc --include_imports --descriptor_set_out), 为空时使用服务端反射
+	Request    string            `json:"request" yaml:"request"`       // json请求模板
+	Requests   []string          `json:"requests" yaml:"requests"`     // 客户端流的json请求模板, 依次发送; 设置后忽略Request
+	Metadata   map[string]string `json:"metadata" yaml:"metadata"`     // 请求元数据
+	Extract    map[string]string `json:"extract" yaml:"extract"`       // 从最后一个json返回中提取变量: 变量名->路径
+	Timeout    int64             `json:"timeout" yaml:"timeout"`       // 调用超时,单位毫秒, 0:不超时
+	Tls        bool              `json:"tls" yaml:"tls"`               // true: 使用tls连接
+	Share      bool              `json:"share" yaml:"share"`           // true: 机器人共用连接池 false: 每个机器人一个连接
+	PoolSize   int               `json:"poolSize" yaml:"poolSize"`     // 共用连接池大小, 默认1
+	//
+	Options []grpc.DialOption `json:"-" yaml:"-"` // 附加连接参数
+	//
+	method      protoreflect.MethodDescriptor // 方法描述
+	methodLock  sync.Mutex                    //
+	tplRequests []*box.ActionTemplate         //
+	tplMetadata map[string]*box.ActionTemplate
+	pool        []*grpc.ClientConn // 共用连接池
+	poolLock    sync.Mutex         //
+	poolNext    uint32             // 轮询位置
+}
+
+// gRPC调用结果
+type ActionGrpcResult struct {
+	Code      codes.Code // 状态码
+	Responses []string   // json格式的返回, 服务端流时有多个
+}
+
+func init() {
+	box.RegisterAction(PlanActionGrpc, func(act *box.PlanAction) (ret box.Action, err error) {
+		d := new(ActionGrpc)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionGrpc(d)
+	})
+}
+
+// 创建gRPC动作, 指定描述文件时立即解析方法
+func NewActionGrpc(s *ActionGrpc) (d *ActionGrpc, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionGrpc)
+	}
+	if len(d.Target) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("target")
+	}
+	if len(d.Method) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("method")
+	}
+	if d.PoolSize <= 0 {
+		d.PoolSize = 1
+	}
+	requests := d.Requests
+	if len(requests) == 0 {
+		requests = []string{d.Request}
+	}
+	for _, r := range requests {
+		var tpl *box.ActionTemplate
+		if tpl, err = box.NewActionTemplate(r); err != nil {
+			return
+		}
+		d.tplRequests = append(d.tplRequests, tpl)
+	}
+	d.tplMetadata = map[string]*box.ActionTemplate{}
+	for k, v := range d.Metadata {
+		if d.tplMetadata[k], err = box.NewActionTemplate(v); err != nil {
+			return
+		}
+	}
+	if len(d.Descriptor) > 0 {
+		var files *descriptorFiles
+		if files, err = loadDescriptorSet(d.Descriptor); err != nil {
+			return
+		}
+		if d.method, err = files.findMethod(d.Method); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 执行调用
+func (d *ActionGrpc) Run(u *box.Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		conn   *grpc.ClientConn
+		method protoreflect.MethodDescriptor
+		result = new(ActionGrpcResult)
+		reqs   []*dynamicpb.Message
+		resps  []*dynamicpb.Message
+	)
+	if conn, err = d.GetConn(u); err != nil {
+		return
+	}
+	if method, err = d.getMethod(conn); err != nil {
+		return
+	}
+
+	// 请求
+	for _, tpl := range d.tplRequests {
+		var s string
+		if s, err = tpl.Render(u, step, batch); err != nil {
+			return
+		}
+		msg := dynamicpb.NewMessage(method.Input())
+		if len(strings.TrimSpace(s)) > 0 {
+			if err = protojson.Unmarshal([]byte(s), msg); err != nil {
+				err = fmt.Errorf(`request %s: %v`, d.Method, err)
+				return
+			}
+		}
+		reqs = append(reqs, msg)
+	}
+	ctx := u.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	if len(d.tplMetadata) > 0 {
+		md := metadata.MD{}
+		for k, tpl := range d.tplMetadata {
+			var v string
+			if v, err = tpl.Render(u, step, batch); err != nil {
+				return
+			}
+			md.Set(k, v)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	// 调用
+	resps, err = invoke(ctx, conn, method, reqs)
+	result.Code = status.Code(err)
+	for _, msg := range resps {
+		b, _ := protojson.Marshal(msg)
+		result.Responses = append(result.Responses, string(b))
+	}
+	ret = result
+	if err != nil {
+		err = errorStatus(err)
+		return
+	}
+
+	// 提取变量
+	if len(d.Extract) > 0 {
+		if len(result.Responses) == 0 {
+			err = fmt.Errorf(`extract from %s: no response`, d.Method)
+			return
+		}
+		last := []byte(result.Responses[len(result.Responses)-1])
+		for key, path := range d.Extract {
+			v, ok := box.PubJsonPathBytes(last, path)
+			if !ok {
+				err = fmt.Errorf(`extract "%s" from %s: path "%s" not found`, key, d.Method, path)
+				return
+			}
+			u.SetVar(key, v)
+		}
+	}
+	return
+}
+
+//
+func (d *ActionGrpc) RunBefore(u *box.Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionGrpc) RunAfter(u *box.Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionGrpc) GetName() (ret string) {
+	return d.Name
+}
+
+// 取连接: 共用连接池轮询, 或机器人独占连接(机器人关闭时断开)
+func (d *ActionGrpc) GetConn(u *box.Robot) (ret *grpc.ClientConn, err error) {
+	if d.Share {
+		d.poolLock.Lock()
+		for len(d.pool) < d.PoolSize {
+			var conn *grpc.ClientConn
+			if conn, err = d.dial(); err != nil {
+				d.poolLock.Unlock()
+				return
+			}
+			d.pool = append(d.pool, conn)
+		}
+		d.poolLock.Unlock()
+		ret = d.pool[int(atomic.AddUint32(&d.poolNext, 1))%len(d.pool)]
+		return
+	}
+	val := u.GetStore(actionGrpcStoreConn+d.Target, func() interface{} {
+		conn, _err := d.dial()
+		if _err != nil {
+			return _err
+		}
+		return conn
+	})
+	switch v := val.(type) {
+	case *grpc.ClientConn:
+		ret = v
+	case error:
+		// 连接失败不缓存
+		u.SetStore(actionGrpcStoreConn+d.Target, nil)
+		err = v
+	}
+	return
+}
+
+// 关闭共用连接池, 按计划生成的场景执行结束后自动关闭
+func (d *ActionGrpc) Close() (err error) {
+	d.poolLock.Lock()
+	for _, conn := range d.pool {
+		if _err := conn.Close(); _err != nil && err == nil {
+			err = _err
+		}
+	}
+	d.pool = nil
+	d.poolLock.Unlock()
+	return
+}
+
+// 建立连接
+func (d *ActionGrpc) dial() (ret *grpc.ClientConn, err error) {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if d.Tls {
+		opts[0] = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	}
+	opts = append(opts, d.Options...)
+	return grpc.NewClient(d.Target, opts...)
+}
+
+// 取方法描述, 未指定描述文件时通过服务端反射解析
+func (d *ActionGrpc) getMethod(conn *grpc.ClientConn) (ret protoreflect.MethodDescriptor, err error) {
+	d.methodLock.Lock()
+	defer d.methodLock.Unlock()
+	if d.method == nil {
+		var files *descriptorFiles
+		if files, err = loadReflection(conn, d.Method); err != nil {
+			return
+		}
+		if d.method, err = files.findMethod(d.Method); err != nil {
+			return
+		}
+	}
+	return d.method, nil
+}
+
+// 调用方法, 按方法描述选择一元或流式调用
+func invoke(ctx context.Context, conn *grpc.ClientConn, method protoreflect.MethodDescriptor,
+	reqs []*dynamicpb.Message) (ret []*dynamicpb.Message, err error) {
+	path := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	if !method.IsStreamingClient() && !method.IsStreamingServer() {
+		resp := dynamicpb.NewMessage(method.Output())
+		if err = conn.Invoke(ctx, path, reqs[0], resp); err != nil {
+			return
+		}
+		return []*dynamicpb.Message{resp}, nil
+	}
+
+	// 流式
+	var stream grpc.ClientStream
+	desc := &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ClientStreams: method.IsStreamingClient(),
+		ServerStreams: method.IsStreamingServer(),
+	}
+	if stream, err = conn.NewStream(ctx, desc, path); err != nil {
+		return
+	}
+	if !desc.ClientStreams {
+		reqs = reqs[:1]
+	}
+	for _, req := range reqs {
+		if err = stream.SendMsg(req); err != nil {
+			if err == io.EOF {
+				// 服务端已结束, 错误在RecvMsg中返回
+				break
+			}
+			return
+		}
+	}
+	if err = stream.CloseSend(); err != nil {
+		return
+	}
+	for {
+		resp := dynamicpb.NewMessage(method.Output())
+		if err = stream.RecvMsg(resp); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		ret = append(ret, resp)
+	}
+}
+
+// 将gRPC状态码映射为动作状态
+func errorStatus(err error) error {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return box.NewActionError(box.ActionStatusFreeze, err)
+	case codes.Canceled:
+		return box.NewActionError(box.ActionStatusClose, err)
+	default:
+		return box.NewActionError(box.ActionStatusWarn, err)
+	}
+}
@@ -0,0 +1,123 @@
+package boxgrpc
+
+import (
+	"github.com/suboat/go-box"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func testServer(t *testing.T) (addr string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("demo", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// 测试服务端反射调用与状态码映射
+func Test_ActionGrpcReflection(t *testing.T) {
+	as := require.New(t)
+	addr := testServer(t)
+	robot := box.NewRobot(&box.Robot{Name: "robot", Vars: map[string]interface{}{"svc": "demo"}})
+	defer robot.Close()
+
+	act, err := NewActionGrpc(&ActionGrpc{
+		Name:    "check",
+		Target:  addr,
+		Method:  "grpc.health.v1.Health/Check",
+		Request: `{"service":"{{.Var.svc}}"}`,
+		Extract: map[string]string{"status": "status"},
+	})
+	as.Nil(err)
+	ret, err := act.Run(robot, 0, 0)
+	as.Nil(err)
+	as.Equal(codes.OK, ret.(*ActionGrpcResult).Code)
+	as.Equal("SERVING", robot.GetVar("status"))
+
+	// 未知服务: NotFound
+	robot.SetVar("svc", "unknown")
+	ret, err = act.Run(robot, 0, 0)
+	as.NotNil(err)
+	as.Equal(codes.NotFound, ret.(*ActionGrpcResult).Code)
+	as.Equal(box.ActionStatusWarn, box.GetActionErrorStatus(err))
+}
+
+// 测试描述文件与共用连接池
+func Test_ActionGrpcDescriptor(t *testing.T) {
+	as := require.New(t)
+	addr := testServer(t)
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	b, err := proto.Marshal(set)
+	as.Nil(err)
+	descPath := filepath.Join(t.TempDir(), "health.pb")
+	as.Nil(ioutil.WriteFile(descPath, b, 0666))
+
+	act, err := NewActionGrpc(&ActionGrpc{
+		Name:       "check",
+		Target:     addr,
+		Method:     "grpc.health.v1.Health.Check",
+		Descriptor: descPath,
+		Request:    `{"service":"demo"}`,
+		Share:      true,
+		PoolSize:   2,
+	})
+	as.Nil(err)
+	defer act.Close()
+	for i := 0; i < 3; i++ {
+		_, err = act.Run(box.NewRobot(&box.Robot{Name: "robot", Serial: i}), 0, 0)
+		as.Nil(err)
+	}
+	as.Len(act.pool, 2)
+
+	// 按计划执行: 场景结束后关闭共用连接池
+	plan, err := box.ParsePlan([]byte(`
+name: grpc
+category: capacity
+capacity:
+  numInit: 2
+  batchMax: 1
+robot:
+  actions:
+    - name: check
+      type: grpc
+      target: ` + addr + `
+      method: grpc.health.v1.Health/Check
+      descriptor: ` + descPath + `
+      request: '{"service":"demo"}'
+      share: true
+      inFlight: 2
+      think: 1
+`))
+	as.Nil(err)
+	scene, err := plan.NewScene()
+	as.Nil(err)
+	data, err := plan.Run(scene, nil)
+	as.Nil(err)
+	as.Zero(data[0].FailRate)
+	think := scene.DefaultRobot.ActionArray[0].(*box.ActionThink)
+	as.Nil(think.Action.(*box.ActionLimited).Action.(*ActionGrpc).pool)
+
+	// 方法不存在
+	_, err = NewActionGrpc(&ActionGrpc{Target: addr, Method: "grpc.health.v1.Health/Nope", Descriptor: descPath})
+	as.NotNil(err)
+}
@@ -0,0 +1,145 @@
+package boxgrpc
+
+import (
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var (
+	// 服务端反射的超时时间
+	DefaultReflectionTimeout = time.Second * 10
+)
+
+// 描述文件集合
+type descriptorFiles struct {
+	files *protoregistry.Files
+}
+
+// 读取描述文件
+func loadDescriptorSet(descPath string) (ret *descriptorFiles, err error) {
+	var (
+		b   []byte
+		set = new(descriptorpb.FileDescriptorSet)
+	)
+	if b, err = ioutil.ReadFile(descPath); err != nil {
+		return
+	}
+	if err = proto.Unmarshal(b, set); err != nil {
+		err = fmt.Errorf(`descriptor "%s": %v`, descPath, err)
+		return
+	}
+	return newDescriptorFiles(set)
+}
+
+// 通过服务端反射读取方法所在服务的描述, 并补齐依赖
+func loadReflection(conn *grpc.ClientConn, method string) (ret *descriptorFiles, err error) {
+	var (
+		service, _ = splitMethod(method)
+		set        = new(descriptorpb.FileDescriptorSet)
+		seen       = map[string]bool{}
+		stream     rpb.ServerReflection_ServerReflectionInfoClient
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReflectionTimeout)
+	defer cancel()
+	if stream, err = rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx); err != nil {
+		return
+	}
+	defer stream.CloseSend()
+
+	// 请求并收集描述
+	fetch := func(req *rpb.ServerReflectionRequest) (names []string, err error) {
+		var resp *rpb.ServerReflectionResponse
+		if err = stream.Send(req); err != nil {
+			return
+		}
+		if resp, err = stream.Recv(); err != nil {
+			return
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf(`reflection: %s`, e.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err = proto.Unmarshal(b, fd); err != nil {
+				return
+			}
+			if seen[fd.GetName()] {
+				continue
+			}
+			seen[fd.GetName()] = true
+			set.File = append(set.File, fd)
+			names = append(names, fd.GetDependency()...)
+		}
+		return
+	}
+	deps, err := fetch(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	for err == nil && len(deps) > 0 {
+		name := deps[0]
+		deps = deps[1:]
+		if seen[name] {
+			continue
+		}
+		var more []string
+		if more, err = fetch(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		}); err == nil {
+			deps = append(deps, more...)
+		}
+	}
+	if err != nil {
+		return
+	}
+	return newDescriptorFiles(set)
+}
+
+// 由描述集合建立索引
+func newDescriptorFiles(set *descriptorpb.FileDescriptorSet) (ret *descriptorFiles, err error) {
+	ret = new(descriptorFiles)
+	if ret.files, err = protodesc.NewFiles(set); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 按全名查找方法
+func (d *descriptorFiles) findMethod(method string) (ret protoreflect.MethodDescriptor, err error) {
+	service, name := splitMethod(method)
+	desc, err := d.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf(`service "%s": %v`, service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf(`"%s" is not a service`, service)
+	}
+	if ret = sd.Methods().ByName(protoreflect.Name(name)); ret == nil {
+		return nil, fmt.Errorf(`method "%s" not found in "%s"`, name, service)
+	}
+	return
+}
+
+// 拆分方法全名: package.Service/Method 或 package.Service.Method
+func splitMethod(method string) (service, name string) {
+	method = strings.TrimPrefix(method, "/")
+	i := strings.LastIndex(method, "/")
+	if i < 0 {
+		i = strings.LastIndex(method, ".")
+	}
+	if i < 0 {
+		return method, ""
+	}
+	return method[:i], method[i+1:]
+}
@@ -0,0 +1,256 @@
+// Package boxtest 提供模拟目标服务, 用于离线测试场景
+//
+// 每个路由可配置延时分布, 错误率, 容量上限(超出后排队)与逐步劣化, 随机数可指定种子以复现结果.
+package boxtest
+
+import (
+	"github.com/suboat/go-box"
+
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// 延时分布
+type Latency interface {
+	Next(r *rand.Rand) time.Duration
+}
+
+// 固定延时
+type LatencyFixed time.Duration
+
+// 均匀分布延时 [Min, Max)
+type LatencyUniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// 正态分布延时, 小于0时取0
+type LatencyNormal struct {
+	Mean time.Duration
+	Std  time.Duration
+}
+
+// 指数分布延时, 长尾
+type LatencyExp struct {
+	Mean time.Duration
+}
+
+// 一个模拟路由
+type Route struct {
+	Method  string  // 请求方法, 为空时不限
+	Path    string  // 请求路径, 精确匹配
+	Latency Latency // 延时分布, 为空时不延时
+	Status  int     // 正常返回的状态码, 默认200
+	Body    string  // 正常返回内容
+	// 错误
+	ErrorRate   float64 // 错误率 0-1
+	ErrorStatus int     // 错误状态码, 默认500
+	// 容量: 在途请求超出Capacity时排队等待, 排队超出QueueMax时直接返回503
+	Capacity int // 最大在途请求数, 0:不限
+	QueueMax int // 最大排队数, 0:不限
+	// 劣化
+	LoadDelay    time.Duration // 每个在途请求额外增加的延时, 模拟负载升高变慢
+	DegradeEvery int           // 每处理N个请求, 基础延时增加DegradeStep, 模拟缓慢劣化
+	DegradeStep  time.Duration //
+	//
+	Handler http.HandlerFunc // 延时与错误判定后交由该函数返回, 设置后忽略Status与Body
+	//
+	slot  chan struct{} // 容量令牌
+	stat  RouteStat     //
+	queue int           // 当前排队数
+}
+
+// 路由统计
+type RouteStat struct {
+	Requests    int64 // 请求数
+	Errors      int64 // 注入的错误数
+	Rejects     int64 // 排队已满被拒绝数
+	Queued      int64 // 曾排队的请求数
+	Inflight    int64 // 当前在途请求
+	InflightMax int64 // 最大在途请求
+}
+
+// 模拟服务
+type Server struct {
+	*httptest.Server
+	Seed int64 // 随机种子, 0:按时间
+	//
+	routes []*Route
+	rand   *rand.Rand
+	lock   sync.Mutex
+}
+
+// 创建并启动模拟服务
+func NewServer(seed int64, routes ...*Route) (d *Server) {
+	d = &Server{Seed: seed}
+	if d.Seed == 0 {
+		d.Seed = time.Now().UnixNano()
+	}
+	d.rand = rand.New(rand.NewSource(d.Seed))
+	for _, r := range routes {
+		d.AddRoute(r)
+	}
+	d.Server = httptest.NewServer(d)
+	return
+}
+
+// 添加路由
+func (d *Server) AddRoute(r *Route) {
+	d.lock.Lock()
+	if r.Capacity > 0 {
+		r.slot = make(chan struct{}, r.Capacity)
+	}
+	d.routes = append(d.routes, r)
+	d.lock.Unlock()
+}
+
+// 取路由统计
+func (d *Server) Stat(path string) (ret RouteStat) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, r := range d.routes {
+		if r.Path == path {
+			ret = r.stat
+			return
+		}
+	}
+	return
+}
+
+// 生成访问该服务的http动作
+func (d *Server) ActionHttp(name, method, path string) (ret *box.ActionHttp) {
+	ret, _ = box.NewActionHttp(&box.ActionHttp{
+		Name:   name,
+		Method: method,
+		Url:    d.URL + path,
+	})
+	return
+}
+
+// 处理请求
+func (d *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	route := d.match(req)
+	if route == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// 排队
+	d.lock.Lock()
+	route.stat.Requests += 1
+	if route.slot != nil && len(route.slot) >= route.Capacity {
+		if route.QueueMax > 0 && route.queue >= route.QueueMax {
+			route.stat.Rejects += 1
+			d.lock.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		route.stat.Queued += 1
+	}
+	route.queue += 1
+	d.lock.Unlock()
+	if route.slot != nil {
+		select {
+		case route.slot <- struct{}{}:
+		case <-req.Context().Done():
+			d.lock.Lock()
+			route.queue -= 1
+			d.lock.Unlock()
+			return
+		}
+		defer func() { <-route.slot }()
+	}
+
+	// 抽取延时与错误
+	d.lock.Lock()
+	route.queue -= 1
+	route.stat.Inflight += 1
+	if route.stat.Inflight > route.stat.InflightMax {
+		route.stat.InflightMax = route.stat.Inflight
+	}
+	var delay time.Duration
+	if route.Latency != nil {
+		delay = route.Latency.Next(d.rand)
+	}
+	delay += route.LoadDelay * time.Duration(route.stat.Inflight-1)
+	if route.DegradeEvery > 0 {
+		delay += route.DegradeStep * time.Duration(route.stat.Requests/int64(route.DegradeEvery))
+	}
+	isError := route.ErrorRate > 0 && d.rand.Float64() < route.ErrorRate
+	if isError {
+		route.stat.Errors += 1
+	}
+	d.lock.Unlock()
+	defer func() {
+		d.lock.Lock()
+		route.stat.Inflight -= 1
+		d.lock.Unlock()
+	}()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	// 返回
+	if isError {
+		status := route.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":"injected"}`)
+		return
+	}
+	if route.Handler != nil {
+		route.Handler(w, req)
+		return
+	}
+	if route.Status > 0 {
+		w.WriteHeader(route.Status)
+	}
+	fmt.Fprint(w, route.Body)
+}
+
+// 匹配路由
+func (d *Server) match(req *http.Request) (ret *Route) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, r := range d.routes {
+		if r.Path == req.URL.Path && (len(r.Method) == 0 || r.Method == req.Method) {
+			return r
+		}
+	}
+	return
+}
+
+//
+func (d LatencyFixed) Next(r *rand.Rand) time.Duration {
+	return time.Duration(d)
+}
+
+//
+func (d *LatencyUniform) Next(r *rand.Rand) time.Duration {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + time.Duration(r.Int63n(int64(d.Max-d.Min)))
+}
+
+//
+func (d *LatencyNormal) Next(r *rand.Rand) time.Duration {
+	return time.Duration(math.Max(0, r.NormFloat64()*float64(d.Std)+float64(d.Mean)))
+}
+
+//
+func (d *LatencyExp) Next(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(d.Mean))
+}
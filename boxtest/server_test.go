@@ -0,0 +1,76 @@
+package boxtest
+
+import (
+	"github.com/suboat/go-box"
+
+	"github.com/stretchr/testify/require"
+
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试错误率可复现
+func Test_ServerErrorRate(t *testing.T) {
+	as := require.New(t)
+	count := func() int64 {
+		srv := NewServer(7, &Route{Path: "/a", ErrorRate: 0.3})
+		defer srv.Close()
+		for i := 0; i < 100; i++ {
+			resp, err := http.Get(srv.URL + "/a")
+			as.Nil(err)
+			resp.Body.Close()
+		}
+		return srv.Stat("/a").Errors
+	}
+	n := count()
+	as.True(n > 10 && n < 50)
+	as.Equal(n, count())
+}
+
+// 测试容量排队
+func Test_ServerCapacity(t *testing.T) {
+	as := require.New(t)
+	srv := NewServer(1, &Route{Path: "/a", Latency: LatencyFixed(time.Millisecond * 30), Capacity: 1})
+	defer srv.Close()
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL + "/a")
+			as.Nil(err)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	as.True(time.Since(start) >= time.Millisecond*90)
+	stat := srv.Stat("/a")
+	as.EqualValues(3, stat.Requests)
+	as.EqualValues(1, stat.InflightMax)
+	as.True(stat.Queued >= 1)
+}
+
+// 测试容量测试在目标排队变慢时因性能下降退出
+func Test_ServerSceneFailPerf(t *testing.T) {
+	as := require.New(t)
+	srv := NewServer(1, &Route{Path: "/a", Latency: LatencyFixed(time.Millisecond * 20), Capacity: 2})
+	defer srv.Close()
+
+	robot := box.NewRobot(&box.Robot{Name: "robot"})
+	as.Nil(robot.AddAction(srv.ActionHttp("a", http.MethodGet, "/a")))
+	scene := box.NewScene(&box.Scene{DefaultRobot: robot})
+	scene.Log.SetLevel(3)
+	ret, err := scene.RunCapacity(&box.FormCapacity{
+		FailPerf:     0.5,
+		BatchMax:     5,
+		NumInit:      2,
+		NumStep:      8,
+		PeriodAction: 1,
+	}, nil)
+	as.Nil(err)
+	as.Len(ret, 2)
+	as.Equal(box.SceneStatusFailPerf, ret[1].Status)
+}
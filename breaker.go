@@ -0,0 +1,36 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultBreakerWindow   = time.Second * 10 // 熔断按时间统计的窗口
+	DefaultBreakerBuckets  = 10               // 按时间统计时窗口分为几片, 每片过期后整片移出
+	DefaultBreakerMinCount = 20               // 窗口内至少有多少个动作才判断
+)
+
+// 熔断: 在一轮执行中按滑动窗口统计动作错误率, 达到阀值时停止发起新的动作, 余下的动作记为跳过,
+// 本轮统计后场景以SceneStatusBreak结束, 原因见ResultScene.Reason
+type Breaker struct {
+	FailRate float64       // 错误率阀值 0~1, 达到即熔断; 不大于0时不熔断
+	Window   time.Duration // 按最近多长时间统计, 默认DefaultBreakerWindow
+	Count    int           // 按最近多少个动作统计, 设置后不按时间
+	MinCount int           // 窗口内至少有多少个动作才判断, 默认DefaultBreakerMinCount
+	//
+	recent  []bool          // 按次数: 最近的动作是否失败, 环形
+	pos     int             // 按次数: 下一个写入位置
+	total   int             // 按次数: 窗口内的动作数
+	fail    int             // 按次数: 窗口内的失败数
+	buckets []breakerBucket // 按时间: 各时间片的计数, 环形
+	lock    sync.Mutex      //
+}
+
+// 一个时间片的计数
+type breakerBucket struct {
+	slot  int64 // 时间片序号
+	count int   // 动作数
+	fail  int   // 失败数
+}
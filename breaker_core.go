@@ -0,0 +1,101 @@
+package box
+
+import (
+	"fmt"
+	"time"
+)
+
+// 创建熔断: 最近window内的错误率达到failRate时熔断, window为0时取DefaultBreakerWindow
+func NewBreaker(failRate float64, window time.Duration) *Breaker {
+	return &Breaker{FailRate: failRate, Window: window}
+}
+
+// 清空窗口
+func (d *Breaker) reset() {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	d.recent, d.pos, d.total, d.fail = nil, 0, 0, 0
+	d.buckets = nil
+	d.lock.Unlock()
+}
+
+// 计入一个动作, 返回窗口内的错误率, 动作数与是否达到阀值
+func (d *Breaker) add(now time.Time, fail bool) (rate float64, total int, trip bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var failNum int
+	if d.Count > 0 {
+		// 按次数
+		if len(d.recent) != d.Count {
+			d.recent, d.pos, d.total, d.fail = make([]bool, d.Count), 0, 0, 0
+		}
+		if d.total == d.Count {
+			if d.recent[d.pos] {
+				d.fail -= 1
+			}
+		} else {
+			d.total += 1
+		}
+		d.recent[d.pos] = fail
+		if fail {
+			d.fail += 1
+		}
+		d.pos = (d.pos + 1) % d.Count
+		total, failNum = d.total, d.fail
+	} else {
+		// 按时间
+		num := DefaultBreakerBuckets
+		if num < 1 {
+			num = 1
+		}
+		window := d.Window
+		if window <= 0 {
+			window = DefaultBreakerWindow
+		}
+		width := int64(window) / int64(num)
+		if width < 1 {
+			width = 1
+		}
+		if len(d.buckets) != num {
+			d.buckets = make([]breakerBucket, num)
+		}
+		slot := now.UnixNano() / width
+		b := &d.buckets[slot%int64(num)]
+		if b.slot != slot {
+			*b = breakerBucket{slot: slot}
+		}
+		b.count += 1
+		if fail {
+			b.fail += 1
+		}
+		for _, b := range d.buckets {
+			if b.slot > slot-int64(num) && b.slot <= slot {
+				total += b.count
+				failNum += b.fail
+			}
+		}
+	}
+	if total > 0 {
+		rate = float64(failNum) / float64(total)
+	}
+	minCount := d.MinCount
+	if minCount <= 0 {
+		minCount = DefaultBreakerMinCount
+	}
+	trip = d.FailRate > 0 && total >= minCount && rate >= d.FailRate
+	return
+}
+
+// 计入一个执行了的动作, 错误率达到阀值时熔断
+func (s *Scene) checkBreaker(now time.Time, fail bool) {
+	rate, total, trip := s.Breaker.add(now, fail)
+	if !trip {
+		return
+	}
+	reason := fmt.Sprintf(`breaker: fail rate %.2f%% of last %d actions >= %.2f%%`, rate*100, total, s.Breaker.FailRate*100)
+	if s.stop(SceneStatusBreak, reason) {
+		s.Log.Warnf(`[scene-breaker] %s`, reason)
+	}
+}
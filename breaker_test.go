@@ -0,0 +1,118 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 测试熔断: 按最近的动作数或时间窗口统计错误率, 达到阀值时停止余下的动作并结束场景
+func Test_Breaker(t *testing.T) {
+	as := require.New(t)
+
+	// 按次数: 达到最少动作数后判断, 窗口外的结果移出
+	b := &Breaker{FailRate: 0.5, Count: 4, MinCount: 4}
+	now := time.Unix(1600000000, 0)
+	for _, fail := range []bool{true, true, false} {
+		_, _, trip := b.add(now, fail)
+		as.False(trip)
+	}
+	rate, total, trip := b.add(now, false)
+	as.Equal(0.5, rate)
+	as.Equal(4, total)
+	as.True(trip)
+	rate, total, trip = b.add(now, false)
+	as.Equal(0.25, rate)
+	as.Equal(4, total)
+	as.False(trip)
+
+	// 按时间: 过期的时间片不再计入
+	b = &Breaker{FailRate: 0.5, Window: time.Second, MinCount: 2}
+	b.add(now, true)
+	_, _, trip = b.add(now.Add(time.Millisecond*500), true)
+	as.True(trip)
+	rate, total, trip = b.add(now.Add(time.Millisecond*1400), false)
+	as.Equal(0.5, rate)
+	as.Equal(2, total)
+	as.True(trip)
+	rate, total, trip = b.add(now.Add(time.Second*3), false)
+	as.Equal(float64(0), rate)
+	as.Equal(1, total)
+	as.False(trip)
+	b.reset()
+	_, total, _ = b.add(now, false)
+	as.Equal(1, total)
+	var none *Breaker
+	none.reset()
+
+	// 场景: 熔断后余下的机器人不再执行, 本轮后结束
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "fail",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			return nil, fmt.Errorf("unavailable")
+		},
+	})))
+	scene := NewScene(&Scene{Name: "breaker", DefaultRobot: robot, Breaker: NewBreaker(0.5, 0)})
+	scene.Log.SetLevel(1)
+	data, err := scene.RunCapacity(&FormCapacity{NumInit: 100, NumStep: 100, BatchMax: 3, PeriodAction: 2000, PeriodScene: 3000}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+	r := data[0]
+	as.Equal(SceneStatusBreak, r.Status)
+	as.Equal("breaker: fail rate 100.00% of last 20 actions >= 50.00%", r.Reason)
+	as.True(r.TimeRun < time.Second*2, r.TimeRun)
+	a := r.ActionArray[0]
+	as.True(a.Count >= DefaultBreakerMinCount, a.Count)
+	as.True(a.Skip > 0, a.Skip)
+	as.Equal(100, a.Count+a.Skip)
+	as.Equal("breaker", progressStatus(r.Status))
+
+	// 等待限流的机器人在熔断后不再执行
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "fail",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			return nil, fmt.Errorf("unavailable")
+		},
+	})))
+	scene = NewScene(&Scene{
+		Name:         "breaker",
+		DefaultRobot: robot,
+		Breaker:      &Breaker{FailRate: 0.5, Count: 3, MinCount: 3},
+		Limiter:      NewLimiter(5, 1),
+	})
+	scene.Log.SetLevel(1)
+	data, err = scene.RunSurge(&FormSurge{NumInit: 50, BatchMax: 1}, nil)
+	as.Nil(err)
+	r = data[0]
+	as.Equal(SceneStatusBreak, r.Status)
+	as.True(r.TimeRun < time.Second*2, r.TimeRun)
+	a = r.ActionArray[0]
+	as.True(a.Count <= 4, a.Count)
+	as.Equal(50, a.Count+a.Skip)
+	as.Equal(0, scene.Limiter.GetInFlight())
+
+	// 计划中的熔断, 熔断视为不通过
+	plan, err := ParsePlan([]byte(`
+name: breaker
+category: surge
+surge: {numInit: 1}
+breaker: {failRate: 0.2, window: 5000, minCount: 10}
+robot:
+  actions:
+    - name: wait
+      type: sleep
+      duration: 1
+`))
+	as.Nil(err)
+	s, err := plan.NewScene()
+	as.Nil(err)
+	as.Equal(&Breaker{FailRate: 0.2, Window: time.Second * 5, MinCount: 10}, s.Breaker)
+	err = plan.Check(data)
+	as.NotNil(err)
+	as.Contains(err.Error(), "breaker: fail rate")
+	as.Equal(ReportVerdictFail, plan.NewReport(data).Verdict)
+}
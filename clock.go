@@ -0,0 +1,43 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 时钟: 场景中的取时与等待经由时钟, 见Scene.Clock
+type Clock interface {
+	Now() time.Time        // 当前时间
+	Sleep(d time.Duration) // 等待
+}
+
+// 真实时钟
+type ClockReal struct{}
+
+// 虚拟时钟: Sleep等到虚拟时间到达后返回, 不真实等待; 时间只由Advance推进,
+// 或由NewClockFake创建时, 在经Add登记的协程全部处于Sleep时自动推进到最早的等待, 与调度快慢无关.
+// 场景使用时自行登记主协程与各机器人协程; 动作中另起的协程在Sleep前须Add(1), 结束时Add(-1).
+// 用于测试: 分钟级的场景在毫秒内执行完, 且时间可预期
+type ClockFake struct {
+	now     time.Time      // 虚拟时间
+	waiters []*clockWaiter // 等待中
+	members int            // 登记的协程数
+	auto    bool           // 自动推进
+	closed  bool           // 已关闭: Sleep立即返回
+	lock    sync.Mutex     //
+}
+
+// 一个等待
+type clockWaiter struct {
+	at   time.Time     // 唤醒时间
+	done chan struct{} // 唤醒时关闭
+}
+
+// 名额: 等待名额的协程不参与虚拟时钟的推进; 释放时将名额连同登记直接转交给最早的等待者,
+// 被唤醒的协程在释放者离开前已登记, 虚拟时间的推进与调度快慢无关
+type clockSem struct {
+	size  int             // 名额数
+	used  int             // 已占用
+	queue []chan struct{} // 等待者, 转交时关闭
+	lock  sync.Mutex      //
+}
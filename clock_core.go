@@ -0,0 +1,202 @@
+package box
+
+import (
+	"time"
+)
+
+//
+func (ClockReal) Now() time.Time {
+	return time.Now()
+}
+
+//
+func (ClockReal) Sleep(d time.Duration) {
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// 创建从start开始的虚拟时钟, 登记的协程全部等待时自动推进; 用完后Close
+func NewClockFake(start time.Time) (d *ClockFake) {
+	return &ClockFake{now: start, auto: true}
+}
+
+// 当前虚拟时间
+func (d *ClockFake) Now() time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.now
+}
+
+// 等到虚拟时间过去dur
+func (d *ClockFake) Sleep(dur time.Duration) {
+	if dur <= 0 {
+		return
+	}
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	w := &clockWaiter{at: d.now.Add(dur), done: make(chan struct{})}
+	d.waiters = append(d.waiters, w)
+	d.check()
+	d.lock.Unlock()
+	<-w.done
+}
+
+// 登记参与自动推进的协程数变化n, 如启动协程前Add(1), 协程结束或阻塞在时钟以外的等待前Add(-1)
+func (d *ClockFake) Add(n int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.members += n
+	d.check()
+}
+
+// 推进虚拟时间, 唤醒到期的等待
+func (d *ClockFake) Advance(dur time.Duration) {
+	d.lock.Lock()
+	d.set(d.now.Add(dur))
+	d.lock.Unlock()
+}
+
+// 等待中的数目
+func (d *ClockFake) Waiters() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.waiters)
+}
+
+// 停止自动推进, 并唤醒所有等待; 之后的Sleep立即返回
+func (d *ClockFake) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = true
+	for _, w := range d.waiters {
+		close(w.done)
+	}
+	d.waiters = nil
+	return nil
+}
+
+// 设置虚拟时间, 调用者持锁
+func (d *ClockFake) set(t time.Time) {
+	if t.After(d.now) {
+		d.now = t
+	}
+	remain := d.waiters[:0]
+	for _, w := range d.waiters {
+		if w.at.After(d.now) {
+			remain = append(remain, w)
+		} else {
+			close(w.done)
+		}
+	}
+	d.waiters = remain
+}
+
+// 登记的协程全部在等待时推进到最早的等待, 调用者持锁
+func (d *ClockFake) check() {
+	if !d.auto || d.closed || d.members <= 0 || len(d.waiters) < d.members {
+		return
+	}
+	at := d.waiters[0].at
+	for _, w := range d.waiters[1:] {
+		if w.at.Before(at) {
+			at = w.at
+		}
+	}
+	d.set(at)
+}
+
+// 登记参与虚拟时钟自动推进的协程数变化n, 其它时钟忽略
+func clockAdd(clock Clock, n int) {
+	if c, ok := clock.(*ClockFake); ok {
+		c.Add(n)
+	}
+}
+
+// 场景的时钟, 未设置时为真实时钟
+func (s *Scene) GetClock() Clock {
+	if s.Clock == nil {
+		return ClockReal{}
+	}
+	return s.Clock
+}
+
+// 等待d, done关闭时提前返回, 返回是否等满; 虚拟时钟按原样等待, 只在开始前检查done
+func clockSleep(clock Clock, d time.Duration, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	if d <= 0 {
+		return true
+	}
+	if _, ok := clock.(ClockReal); !ok || done == nil {
+		clock.Sleep(d)
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// 取得名额, done关闭时放弃等待并返回false
+func (d *clockSem) acquire(clock Clock, done <-chan struct{}) bool {
+	d.lock.Lock()
+	if d.used < d.size {
+		d.used += 1
+		d.lock.Unlock()
+		return true
+	}
+	ch := make(chan struct{})
+	d.queue = append(d.queue, ch)
+	d.lock.Unlock()
+	clockAdd(clock, -1)
+	select {
+	case <-ch:
+		// 释放者已代为登记
+		return true
+	case <-done:
+	}
+	d.lock.Lock()
+	for i, c := range d.queue {
+		if c == ch {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			d.lock.Unlock()
+			clockAdd(clock, 1)
+			return false
+		}
+	}
+	d.lock.Unlock()
+	d.release(clock) // 已转交: 归还名额
+	return false
+}
+
+// 释放名额, 有等待者时转交给最早的
+func (d *clockSem) release(clock Clock) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.queue) > 0 {
+		ch := d.queue[0]
+		d.queue = d.queue[1:]
+		clockAdd(clock, 1)
+		close(ch)
+		return
+	}
+	d.used -= 1
+}
+
+// 已占用的名额数
+func (d *clockSem) getUsed() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.used
+}
@@ -0,0 +1,215 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试虚拟时钟: 手动推进, 自动推进与关闭
+func Test_ClockFake(t *testing.T) {
+	as := require.New(t)
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 手动推进: 未由NewClockFake创建时不自动推进
+	c := &ClockFake{now: t0}
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+	for c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(time.Second * 30)
+	select {
+	case <-done:
+		as.Fail("woke early")
+	case <-time.After(time.Millisecond * 20):
+	}
+	c.Advance(time.Second * 30)
+	<-done
+	as.Equal(t0.Add(time.Minute), c.Now())
+	as.Equal(0, c.Waiters())
+
+	// 自动推进: 登记的协程全部在等待时推进, 与真实时间无关
+	c = NewClockFake(t0)
+	c.Add(2) // 本协程与下面的协程
+	done = make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		c.Add(-1)
+		close(done)
+	}()
+	for c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		as.Fail("advanced while a member is running")
+	case <-time.After(time.Millisecond * 20):
+	}
+	c.Add(-1) // 本协程离开后只剩等待中的协程
+	<-done
+	as.Equal(t0.Add(time.Minute), c.Now())
+	start := time.Now()
+	c.Add(1)
+	c.Sleep(time.Hour)
+	c.Sleep(0)
+	as.Equal(t0.Add(time.Hour+time.Minute), c.Now())
+	as.True(time.Since(start) < time.Second)
+
+	// 关闭后不再等待
+	as.Nil(c.Close())
+	c.Sleep(time.Hour)
+	as.Equal(t0.Add(time.Hour+time.Minute), c.Now())
+	as.IsType(ClockReal{}, NewScene(nil).GetClock())
+}
+
+// 测试场景使用虚拟时钟: 100轮容量测试在真实的秒级内完成, 轮间等待与退出条件可预期
+func Test_SceneClock(t *testing.T) {
+	as := require.New(t)
+	clock := NewClockFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Close()
+
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			// 第81轮起变慢, 触发性能下降退出
+			if batch >= 80 {
+				u.Scene.GetClock().Sleep(time.Millisecond * 300)
+			} else {
+				u.Scene.GetClock().Sleep(time.Millisecond * 100)
+			}
+			return
+		},
+	})))
+	scene := NewScene(&Scene{Name: "clock", DefaultRobot: robot, Clock: clock, Seed: 1})
+	scene.Log.SetLevel(1)
+	start := time.Now()
+	data, err := scene.RunCapacity(&FormCapacity{NumInit: 2, BatchMax: 100, PeriodAction: 4000, PeriodScene: 10000, FailPerf: 0.5}, nil)
+	as.Nil(err)
+	as.True(time.Since(start) < time.Second*20, time.Since(start))
+
+	// 第81轮性能下降退出
+	as.Len(data, 81)
+	as.Equal(SceneStatusFailPerf, data[80].Status)
+	for i, d := range data {
+		if i == 0 {
+			continue
+		}
+		as.InDelta(float64(time.Millisecond*100), float64(d.LastPerfAvg), float64(time.Millisecond*5))
+		// 比预期提前完成时等到期望结束时间才开始下一轮
+		as.Equal(data[i-1].TimeEndLine, d.TimeStart, i)
+		as.Equal(d.TimeStart.Add(time.Second*10), d.TimeEndLine)
+		as.True(d.TimeRun >= time.Millisecond*100 && d.TimeRun < time.Millisecond*4400, d.TimeRun)
+		if i < 80 {
+			as.Equal(SceneStatusNormal, d.Status)
+		}
+	}
+	as.Equal(time.Second*800, data[80].TimeStart.Sub(data[0].TimeStart))
+}
+
+// 测试虚拟时钟下的执行与调度快慢无关: 动作中有真实时间的停顿时多次执行, 各动作的开始时间相同
+func Test_SceneClockDeterministic(t *testing.T) {
+	as := require.New(t)
+	run := func(streaming bool) (starts map[int]time.Time) {
+		var lock sync.Mutex
+		starts = map[int]time.Time{}
+		clock := NewClockFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		defer clock.Close()
+		robot := NewRobot(&Robot{Name: "robot"})
+		for i := 0; i < 2; i++ {
+			as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+				Name: "work",
+				Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+					clock := u.Scene.GetClock()
+					lock.Lock()
+					starts[batch*10000+u.Serial*10+step] = clock.Now()
+					lock.Unlock()
+					if u.Serial%3 == 0 {
+						time.Sleep(time.Millisecond * 5) // 真实时间的停顿不影响虚拟时间
+					}
+					clock.Sleep(time.Millisecond * time.Duration(10+u.Rand.Intn(100)))
+					return
+				},
+			})))
+		}
+		scene := NewScene(&Scene{Name: "clock", DefaultRobot: robot, Clock: clock, Seed: 3, Streaming: streaming})
+		scene.Log.SetLevel(1)
+		data, err := scene.RunCapacity(&FormCapacity{NumInit: 10, NumStep: 10, BatchMax: 3, PeriodAction: 1000, PeriodScene: 5000}, nil)
+		as.Nil(err)
+		as.Len(data, 3)
+		return
+	}
+
+	for _, streaming := range []bool{false, true} {
+		a := run(streaming)
+		as.Len(a, 120)
+		as.Equal(a, run(streaming))
+	}
+}
+
+// 测试虚拟时钟下暂停: 暂停等待的机器人不参与推进, 其他机器人的等待照常完成, 可从测试协程恢复
+func Test_SceneClockPause(t *testing.T) {
+	as := require.New(t)
+	clock := NewClockFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Close()
+
+	var (
+		sleeping = make(chan struct{})
+		paused   = make(chan struct{})
+		done     = make(chan struct{})
+		resumed  = make(chan struct{})
+	)
+	robot := NewRobot(&Robot{Name: "robot"})
+	for i := 0; i < 2; i++ {
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "work",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				first := step == 0 && batch == 0
+				if u.Serial == 0 {
+					if first {
+						// 另一个机器人进入虚拟时钟等待后暂停
+						<-sleeping
+						u.Scene.Pause()
+						close(paused)
+					}
+					return
+				}
+				if first {
+					close(sleeping)
+				}
+				u.Scene.GetClock().Sleep(time.Millisecond * 100)
+				if first {
+					close(done)
+				}
+				return
+			},
+		})))
+	}
+	scene := NewScene(&Scene{Name: "clock", DefaultRobot: robot, Clock: clock})
+	scene.Log.SetLevel(1)
+	go func() {
+		<-paused
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Error("clock blocked by paused robot")
+		}
+		scene.Resume()
+		close(resumed)
+	}()
+	data, err := scene.RunSurge(&FormSurge{NumInit: 2, BatchMax: 2, PeriodScene: 1000}, nil)
+	<-resumed
+	as.Nil(err)
+	as.Len(data, 2)
+	as.Equal(SceneStatusBatchMax, data[1].Status)
+	for _, d := range data {
+		as.Equal(time.Millisecond*200, d.TimeRun)
+		as.Zero(d.FailRate)
+	}
+}
@@ -0,0 +1,101 @@
+package box
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 分布式执行的默认参数
+var (
+	DefaultClusterStartDelay = time.Millisecond * 500 // 下发每轮后各节点同时开始前的等待, 须大于下发耗时
+	DefaultClusterClient     = &http.Client{}         // 协调节点的http客户端, 每轮耗时不定, 不设超时
+)
+
+// 工作节点接口
+const (
+	ClusterPathStart  = "/box/start"  // 开始执行, 参数ClusterStart
+	ClusterPathBatch  = "/box/batch"  // 执行一轮, 参数ClusterBatch, 返回ResultPart
+	ClusterPathFinish = "/box/finish" // 执行结束
+	ClusterPathStop   = "/box/stop"   // 停止执行中的一轮, 参数ClusterStop; 各节点跳过余下的动作后返回本轮结果
+)
+
+// 工作节点: 作为http处理器接收协调节点的指令, 以同一场景执行分到的机器人; 同一时刻只服务一个协调节点
+type ClusterWorker struct {
+	Scene *Scene // 与协调节点相同的场景
+	//
+	form        *FormScene         // 执行参数, 为空即未开始
+	sink        SinkMulti          // 本节点的结果输出
+	last        *ResultScene       // 本节点上一轮结果
+	concurrency concurrencyCounter // 并发计数
+	lock        sync.Mutex         //
+}
+
+// 开始执行
+type ClusterStart struct {
+	Scene   string     `json:"scene"`   // 场景名, 须与工作节点一致
+	Actions []string   `json:"actions"` // 默认机器人的动作名, 须与工作节点一致
+	Form    *FormScene `json:"form"`    // 执行参数
+	Seed    int64      `json:"seed"`    // 协调节点本次执行的随机种子
+}
+
+// 执行一轮
+type ClusterBatch struct {
+	Batch     int       `json:"batch"`     // 轮次, 0起始
+	Robots    int       `json:"robots"`    // 本节点的机器人数
+	Serial    int       `json:"serial"`    // 本节点机器人的起始编号
+	TimeStart time.Time `json:"timeStart"` // 各节点同时开始的时间
+}
+
+// 停止执行: 协调节点停止时转发, 如手动停止或收到信号
+type ClusterStop struct {
+	Status int    `json:"status"` // 场景状态, 默认SceneStatusStop
+	Reason string `json:"reason"` // 停止原因
+}
+
+// 一个节点一轮的结果: 计数与直方图, 多个节点的结果合并为一个ResultScene
+type ResultPart struct {
+	Worker      string                  `json:"worker"`      // 节点地址
+	Robots      int                     `json:"robots"`      // 机器人数
+	TimeStart   time.Time               `json:"timeStart"`   // 开始时间
+	TimeEnd     time.Time               `json:"timeEnd"`     // 结束时间
+	Concurrency int64                   `json:"concurrency"` // 最大并发
+	ErrText     string                  `json:"errText"`     // 最后一个错误文本
+	Units       int                     `json:"units"`       // 执行单元数
+	UnitFail    int                     `json:"unitFail"`    // 失败的执行单元数
+	UnitTotal   time.Duration           `json:"unitTotal"`   // 全部执行单元的总耗时
+	UnitSpent   *Histogram              `json:"unitSpent"`   // 成功执行单元的耗时
+	RespFastest time.Duration           `json:"respFastest"` // 最快动作
+	RespSlowest time.Duration           `json:"respSlowest"` // 最慢动作
+	Actions     []*ResultPartAction     `json:"actions"`     // 各动作
+	Errors      map[string]*ResultError `json:"errors"`      // 错误文本->统计
+	Generator   *ResultGenerator        `json:"generator"`   // 本节点的压测机状态
+	Status      int                     `json:"status"`      // 本节点已停止时的场景状态, 如熔断
+	Reason      string                  `json:"reason"`      // 本节点停止的原因
+}
+
+// 一个节点一轮中一个动作的结果
+type ResultPartAction struct {
+	Name          string         `json:"name"`          // 动作名
+	Count         int            `json:"count"`         // 执行次数
+	Fail          int            `json:"fail"`          // 失败次数
+	Skip          int            `json:"skip"`          // 跳过次数
+	Spent         *Histogram     `json:"spent"`         // 耗时
+	TimeConnect   time.Duration  `json:"timeConnect"`   // 建立连接总耗时
+	TimeFirstByte time.Duration  `json:"timeFirstByte"` // 首字节总耗时
+	TimeLimit     time.Duration  `json:"timeLimit"`     // 等待限流总时间
+	ErrText       string         `json:"errText"`       // 最后一个错误文本
+	ErrorClass    map[string]int `json:"errorClass"`    // 各错误分类的失败次数
+}
+
+// 协调节点
+type clusterCoordinator struct {
+	scene   *Scene
+	form    *FormScene
+	workers []string
+}
+
+// 工作节点的错误回复
+type clusterError struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,563 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 由一轮的动作结果生成可合并的结果, 统计口径与statUnits, statActions一致
+func NewResultPart(actions []Action, units [][]*RobotActionResult) (ret *ResultPart) {
+	ret = &ResultPart{UnitSpent: NewHistogram(), Errors: map[string]*ResultError{}}
+	for _, a := range actions {
+		ret.Actions = append(ret.Actions, &ResultPartAction{Name: a.GetName(), Spent: NewHistogram()})
+	}
+	for _, unit := range units {
+		for i, r := range unit {
+			ret.AddAction(i, r)
+		}
+		ret.AddUnit(unit)
+	}
+	return
+}
+
+// 计入一个动作结果, i: 动作位置
+func (d *ResultPart) AddAction(i int, r *RobotActionResult) {
+	if r == nil || i >= len(d.Actions) {
+		return
+	}
+	item := d.Actions[i]
+	if r.Status == ActionStatusClose && r.TimeCreate.IsZero() {
+		item.Skip += 1
+		return
+	}
+	item.Count += 1
+	if r.Status != ActionStatusNormal {
+		item.Fail += 1
+		if r.Error != nil {
+			item.ErrText = r.Error.Error()
+		}
+		class := resultErrorClass(r)
+		if item.ErrorClass == nil {
+			item.ErrorClass = map[string]int{}
+		}
+		item.ErrorClass[class] += 1
+		if d.Errors == nil {
+			d.Errors = map[string]*ResultError{}
+		}
+		addResultError(d.Errors, item.Name, class, r)
+	}
+	item.Spent.Add(r.TimeSpent)
+	item.TimeConnect += r.TimeConnect
+	item.TimeFirstByte += r.TimeFirstByte
+	item.TimeLimit += r.TimeLimit
+}
+
+// 计入一个执行单元的耗时与成败, 其中各动作需另行AddAction
+func (d *ResultPart) AddUnit(unit []*RobotActionResult) {
+	var (
+		spent     time.Duration
+		isSuccess = true
+	)
+	for _, r := range unit {
+		if r != nil {
+			spent += r.TimeSpent
+		}
+	}
+	d.Units += 1
+	d.UnitTotal += spent
+	for _, r := range unit {
+		if r == nil || r.Status != ActionStatusNormal {
+			d.UnitFail += 1
+			isSuccess = false
+			break
+		}
+		if r.TimeSpent > 0 {
+			if d.RespFastest == 0 || r.TimeSpent < d.RespFastest {
+				d.RespFastest = r.TimeSpent
+			}
+			if r.TimeSpent > d.RespSlowest {
+				d.RespSlowest = r.TimeSpent
+			}
+		}
+	}
+	if isSuccess && spent > 0 {
+		if d.UnitSpent == nil {
+			d.UnitSpent = NewHistogram()
+		}
+		d.UnitSpent.Add(spent)
+	}
+}
+
+// 合并另一部分结果: 计数与直方图相加, 最大并发相加, 时间取并集
+func (d *ResultPart) Merge(o *ResultPart) {
+	if o == nil {
+		return
+	}
+	if d.UnitSpent == nil {
+		d.UnitSpent = NewHistogram()
+	}
+	if d.Errors == nil {
+		d.Errors = map[string]*ResultError{}
+	}
+	mergeResultErrors(d.Errors, o.Errors)
+	d.Robots += o.Robots
+	d.Units += o.Units
+	d.UnitFail += o.UnitFail
+	d.UnitTotal += o.UnitTotal
+	d.UnitSpent.Merge(o.UnitSpent)
+	d.Concurrency += o.Concurrency
+	if !o.TimeStart.IsZero() && (d.TimeStart.IsZero() || o.TimeStart.Before(d.TimeStart)) {
+		d.TimeStart = o.TimeStart
+	}
+	if o.TimeEnd.After(d.TimeEnd) {
+		d.TimeEnd = o.TimeEnd
+	}
+	if len(o.ErrText) > 0 {
+		d.ErrText = o.ErrText
+	}
+	if o.RespFastest > 0 && (d.RespFastest == 0 || o.RespFastest < d.RespFastest) {
+		d.RespFastest = o.RespFastest
+	}
+	if o.RespSlowest > d.RespSlowest {
+		d.RespSlowest = o.RespSlowest
+	}
+	for i, a := range o.Actions {
+		if i >= len(d.Actions) {
+			d.Actions = append(d.Actions, &ResultPartAction{Name: a.Name, Spent: NewHistogram()})
+		}
+		item := d.Actions[i]
+		item.Count += a.Count
+		item.Fail += a.Fail
+		item.Skip += a.Skip
+		item.Spent.Merge(a.Spent)
+		item.TimeConnect += a.TimeConnect
+		item.TimeFirstByte += a.TimeFirstByte
+		item.TimeLimit += a.TimeLimit
+		if len(a.ErrText) > 0 {
+			item.ErrText = a.ErrText
+		}
+		for k, v := range a.ErrorClass {
+			if item.ErrorClass == nil {
+				item.ErrorClass = map[string]int{}
+			}
+			item.ErrorClass[k] += v
+		}
+	}
+}
+
+// 合并各节点一轮的结果, 百分位与90%平均耗时由直方图得出, 误差小于1%
+func (d *ResultScene) statParts(parts []*ResultPart, last *ResultScene) {
+	all := &ResultPart{UnitSpent: NewHistogram()}
+	for _, p := range parts {
+		all.Merge(p)
+	}
+	d.Concurrency += all.Concurrency
+	if all.RespFastest > 0 && (d.RespFastest == 0 || all.RespFastest < d.RespFastest) {
+		d.RespFastest = all.RespFastest
+	}
+	if all.RespSlowest > d.RespSlowest {
+		d.RespSlowest = all.RespSlowest
+	}
+	if all.Units > 0 {
+		d.PerfTime90Avg = all.UnitSpent.TrimmedMean(0.05, 0.95)
+		d.statUnitsTotal(all.Units, all.UnitFail, all.UnitTotal, last)
+	}
+	d.statTps(last)
+
+	// 各动作
+	d.ActionArray = make([]*ResultCapacityAction, len(all.Actions))
+	for i, a := range all.Actions {
+		item := &ResultCapacityAction{Name: a.Name, Step: i, Count: a.Count, Fail: a.Fail, Skip: a.Skip, ErrText: a.ErrText, ErrorClass: a.ErrorClass}
+		if item.Count > 0 {
+			item.FailRate = PubFloatRound(float64(item.Fail)/float64(item.Count), 4)
+			item.TimeAvg = a.Spent.Mean()
+			item.TimeMin = time.Duration(a.Spent.Min)
+			item.TimeMax = time.Duration(a.Spent.Max)
+			item.TimeP50 = a.Spent.Quantile(50)
+			item.TimeP90 = a.Spent.Quantile(90)
+			item.TimeP95 = a.Spent.Quantile(95)
+			item.TimeP99 = a.Spent.Quantile(99)
+			item.TimeStd = a.Spent.Std()
+			item.TimeConnect = a.TimeConnect / time.Duration(item.Count)
+			item.TimeFirstByte = a.TimeFirstByte / time.Duration(item.Count)
+			item.TimeLimit = a.TimeLimit / time.Duration(item.Count)
+		}
+		d.ActionArray[i] = item
+	}
+	d.statErrors(all.Errors)
+}
+
+// 创建工作节点
+func NewClusterWorker(scene *Scene) *ClusterWorker {
+	return &ClusterWorker{Scene: scene}
+}
+
+// 处理协调节点的指令
+func (d *ClusterWorker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		ret interface{}
+		err error
+	)
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch req.URL.Path {
+	case ClusterPathStart:
+		form := new(ClusterStart)
+		if err = json.NewDecoder(req.Body).Decode(form); err == nil {
+			err = d.start(form)
+		}
+	case ClusterPathBatch:
+		form := new(ClusterBatch)
+		if err = json.NewDecoder(req.Body).Decode(form); err == nil {
+			ret, err = d.batch(form)
+		}
+	case ClusterPathFinish:
+		err = d.finish()
+	case ClusterPathStop:
+		form := new(ClusterStop)
+		if err = json.NewDecoder(req.Body).Decode(form); err == nil {
+			d.stopBatch(form)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		ret = &clusterError{Error: err.Error()}
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+// 开始执行: 检查场景一致, 执行FnBefore; 上次执行未结束时先结束
+func (d *ClusterWorker) start(form *ClusterStart) (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	s := d.Scene
+	if err = s.initDefaultRobot(); err != nil {
+		return
+	}
+	if form.Form == nil {
+		return contrib.ErrParamInvalid.SetVars("form")
+	}
+	if err = form.Form.Valid(); err != nil {
+		return
+	}
+	if form.Scene != s.Name {
+		return contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`scene "%s" != "%s"`, form.Scene, s.Name))
+	}
+	if names := clusterActionNames(s); strings.Join(names, "\n") != strings.Join(form.Actions, "\n") {
+		return contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`actions %v != %v`, form.Actions, names))
+	}
+	if d.form != nil {
+		d.stop()
+	}
+	if s.FnBefore != nil {
+		if err = s.FnBefore(s); err != nil {
+			return
+		}
+	}
+	d.form = form.Form
+	s.seed = form.Seed
+	s.resetControl()
+	s.Breaker.reset()
+	d.sink = s.newSink(nil)
+	d.last = nil
+	s.Log.Infof(`[cluster-worker] start %s %s`, s.Name, PubJsonMust(d.form))
+	return
+}
+
+// 执行一轮: 等到约定时间后执行分到的机器人
+func (d *ClusterWorker) batch(form *ClusterBatch) (ret *ResultPart, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.form == nil {
+		return nil, contrib.ErrParamInvalid.SetVars("not started")
+	}
+	if form.Robots <= 0 || form.Serial < 0 || form.Batch < 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("robots")
+	}
+	var (
+		s      = d.Scene
+		clock  = s.GetClock()
+		report = &ResultScene{Scene: s.Name, Category: d.form.Category, Batch: form.Batch + 1, BatchMax: d.form.BatchMax, BatchRobot: form.Robots}
+		count  = func(add int64) {
+			d.concurrency.add(add)
+			d.sink.OnConcurrency(add)
+		}
+	)
+	clockAdd(clock, 1) // 本协程参与虚拟时钟的推进, 见ClockFake.Add
+	defer clockAdd(clock, -1)
+	s.sleepControl(clock, form.TimeStart.Sub(clock.Now()))
+	report.TimeStart = clock.Now()
+	d.sink.OnBatchStart(report)
+	var (
+		units     [][]*RobotActionResult
+		lastError error
+	)
+	s.monitor.begin()
+	if s.Streaming {
+		ret, lastError, err = s.runBatchStream(d.form, form.Batch, form.Robots, form.Serial, report, d.last, d.sink, count)
+	} else {
+		units, lastError, err = s.runBatch(d.form, form.Batch, form.Robots, form.Serial, d.sink, count)
+	}
+	generator := s.monitor.end()
+	if err != nil {
+		return
+	}
+	report.TimeEnd = clock.Now()
+	report.TimeRun = report.TimeEnd.Sub(report.TimeStart)
+
+	// 本节点统计, 仅用于本节点的结果输出
+	if ret != nil {
+		report.statParts([]*ResultPart{ret}, d.last)
+	} else {
+		report.statUnits(units, d.last)
+		report.statActions(s.DefaultRobot.ActionArray, units)
+		ret = NewResultPart(s.DefaultRobot.ActionArray, units)
+	}
+	report.Concurrency = d.concurrency.takeMax()
+	report.Generator = generator
+	if lastError != nil {
+		report.ErrText = lastError.Error()
+	}
+	d.sink.OnBatch(report)
+	d.last = report
+
+	ret.Robots = form.Robots
+	ret.TimeStart = report.TimeStart
+	ret.TimeEnd = report.TimeEnd
+	ret.Concurrency = report.Concurrency
+	ret.ErrText = report.ErrText
+	ret.Generator = generator
+	if s.IsStopped() {
+		ret.Status = s.getStopStatus()
+		ret.Reason = s.GetStopReason()
+	}
+	return
+}
+
+// 停止执行中的一轮: 不等待本轮结束, 本轮余下的动作跳过, 之后的轮次由协调节点不再下发
+func (d *ClusterWorker) stopBatch(form *ClusterStop) {
+	status := form.Status
+	if status == SceneStatusNormal {
+		status = SceneStatusStop
+	}
+	if d.Scene.stop(status, form.Reason) {
+		d.Scene.Log.Infof(`[cluster-worker] stop %s: %s`, d.Scene.Name, form.Reason)
+	}
+}
+
+// 执行结束: 执行FnAfter, 关闭结果输出
+func (d *ClusterWorker) finish() (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.form == nil {
+		return
+	}
+	return d.stop()
+}
+
+//
+func (d *ClusterWorker) stop() (err error) {
+	s := d.Scene
+	if s.FnAfter != nil {
+		err = s.FnAfter(s)
+	}
+	s.closeSink(d.sink)
+	d.form = nil
+	d.sink = nil
+	s.Log.Infof(`[cluster-worker] finish %s`, s.Name)
+	return
+}
+
+// 默认机器人的动作名
+func clusterActionNames(s *Scene) (ret []string) {
+	for _, a := range s.DefaultRobot.ActionArray {
+		ret = append(ret, a.GetName())
+	}
+	return
+}
+
+// 创建协调节点
+func newClusterCoordinator(s *Scene, form *FormScene) *clusterCoordinator {
+	d := &clusterCoordinator{scene: s, form: form}
+	for _, w := range s.Workers {
+		if w = strings.TrimSpace(w); len(w) > 0 {
+			if !strings.Contains(w, "://") {
+				w = "http://" + w
+			}
+			d.workers = append(d.workers, strings.TrimRight(w, "/"))
+		}
+	}
+	return d
+}
+
+// 向全部节点发出同一请求, 返回各节点的回复
+func (d *clusterCoordinator) call(path string, forms []interface{}, fnRet func(i int) interface{}) (err error) {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(d.workers))
+	)
+	for i := range d.workers {
+		if forms[i] == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.post(d.workers[i]+path, forms[i], fnRet(i))
+		}(i)
+	}
+	wg.Wait()
+	for i, e := range errs {
+		if e != nil {
+			return fmt.Errorf(`worker %s: %v`, d.workers[i], e)
+		}
+	}
+	return
+}
+
+// 发出一个请求
+func (d *clusterCoordinator) post(url string, form, ret interface{}) (err error) {
+	b, err := json.Marshal(form)
+	if err != nil {
+		return
+	}
+	resp, err := DefaultClusterClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := new(clusterError)
+		if json.NewDecoder(resp.Body).Decode(e) != nil || len(e.Error) == 0 {
+			e.Error = resp.Status
+		}
+		return errors.New(e.Error)
+	}
+	if ret != nil {
+		err = json.NewDecoder(resp.Body).Decode(ret)
+	}
+	return
+}
+
+// 通知各节点开始执行
+func (d *clusterCoordinator) start() (err error) {
+	if len(d.workers) == 0 {
+		return contrib.ErrParamInvalid.SetVars("workers")
+	}
+	form := &ClusterStart{Scene: d.scene.Name, Actions: clusterActionNames(d.scene), Form: d.form, Seed: d.scene.seed}
+	forms := make([]interface{}, len(d.workers))
+	for i := range forms {
+		forms[i] = form
+	}
+	if err = d.call(ClusterPathStart, forms, func(int) interface{} { return nil }); err != nil {
+		d.finish()
+	}
+	return
+}
+
+// 执行一轮: 将本轮机器人平均分到各节点, 约定同一开始时间, 合并各节点结果
+func (d *clusterCoordinator) runBatch(report, last *ResultScene) (lastError error, err error) {
+	var (
+		num    = len(d.workers)
+		forms  = make([]interface{}, num)
+		parts  = make([]*ResultPart, num)
+		serial = 0
+	)
+	report.TimeStart = d.scene.GetClock().Now().Add(DefaultClusterStartDelay)
+	for i := range d.workers {
+		robots := report.BatchRobot / num
+		if i < report.BatchRobot%num {
+			robots += 1
+		}
+		if robots > 0 {
+			forms[i] = &ClusterBatch{Batch: report.Batch - 1, Robots: robots, Serial: serial, TimeStart: report.TimeStart}
+		}
+		serial += robots
+	}
+	// 本轮中协调节点停止时通知各节点
+	var (
+		finished = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-d.scene.getDone():
+			d.stop()
+		case <-finished:
+		}
+	}()
+	err = d.call(ClusterPathBatch, forms, func(i int) interface{} {
+		parts[i] = &ResultPart{Worker: d.workers[i]}
+		return parts[i]
+	})
+	close(finished)
+	wg.Wait()
+	if err != nil {
+		return
+	}
+	var done []*ResultPart
+	for _, p := range parts {
+		if p == nil {
+			continue
+		}
+		done = append(done, p)
+		if p.Generator != nil {
+			if report.Generator == nil {
+				report.Generator = &ResultGenerator{}
+			}
+			report.Generator.merge(p.Worker, p.Generator)
+		}
+		if p.TimeEnd.After(report.TimeEnd) {
+			report.TimeEnd = p.TimeEnd
+		}
+		if len(p.ErrText) > 0 {
+			lastError = errors.New(p.ErrText)
+		}
+		if p.Status != SceneStatusNormal {
+			// 节点熔断等: 整个场景本轮后结束
+			d.scene.stop(p.Status, p.Worker+" "+p.Reason)
+		}
+	}
+	report.TimeRun = report.TimeEnd.Sub(report.TimeStart)
+	report.statParts(done, last)
+	return
+}
+
+// 通知各节点停止执行中的一轮
+func (d *clusterCoordinator) stop() {
+	form := &ClusterStop{Status: d.scene.getStopStatus(), Reason: d.scene.GetStopReason()}
+	forms := make([]interface{}, len(d.workers))
+	for i := range forms {
+		forms[i] = form
+	}
+	if err := d.call(ClusterPathStop, forms, func(int) interface{} { return nil }); err != nil {
+		d.scene.Log.Warnf(`[cluster-stop] %v`, err)
+	}
+}
+
+// 通知各节点执行结束
+func (d *clusterCoordinator) finish() {
+	forms := make([]interface{}, len(d.workers))
+	for i := range forms {
+		forms[i] = struct{}{}
+	}
+	if err := d.call(ClusterPathFinish, forms, func(int) interface{} { return nil }); err != nil {
+		d.scene.Log.Warnf(`[cluster-finish] %v`, err)
+	}
+}
@@ -0,0 +1,157 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 创建测试场景, 各节点与协调节点使用同一定义
+func testClusterScene(name string, record func(u *Robot)) *Scene {
+	robot := NewRobot(&Robot{Name: "robot"})
+	robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			record(u)
+			time.Sleep(time.Millisecond * 5)
+			if u.Serial == 7 {
+				err = fmt.Errorf("robot 7")
+			}
+			return
+		},
+	}))
+	robot.AddAction(NewActionOne(&ActionOne{Name: "home"}))
+	scene := NewScene(&Scene{Name: name, DefaultRobot: robot})
+	scene.Log.SetLevel(2)
+	return scene
+}
+
+// 测试在本机以多个工作节点分布式执行
+func Test_Cluster(t *testing.T) {
+	as := require.New(t)
+	var (
+		lock    sync.Mutex
+		serials = map[int]int{}
+		starts  = map[string]time.Time{}
+		workers []string
+	)
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("w%d", i)
+		w := NewClusterWorker(testClusterScene("cluster", func(u *Robot) {
+			lock.Lock()
+			serials[u.Serial] += 1
+			if _, ok := starts[name]; !ok {
+				starts[name] = time.Now()
+			}
+			lock.Unlock()
+		}))
+		srv := httptest.NewServer(w)
+		defer srv.Close()
+		workers = append(workers, srv.URL)
+	}
+
+	// 协调节点的动作不执行
+	scene := testClusterScene("cluster", func(u *Robot) { t.Error("coordinator runs robots") })
+	scene.Workers = workers
+	data, err := scene.RunCapacity(&FormCapacity{NumInit: 10, NumStep: 1, BatchMax: 2, PeriodAction: 10, FailFast: true}, nil)
+	as.Nil(err)
+	as.Len(data, 2)
+	as.Equal(10, data[0].BatchRobot)
+	as.Equal(11, data[1].BatchRobot)
+
+	// 机器人编号在各节点间不重复
+	as.Len(serials, 11)
+	as.Equal(2, serials[0])
+	as.Equal(1, serials[10])
+
+	// 同时开始
+	as.Len(starts, 3)
+	var first, last time.Time
+	for _, v := range starts {
+		if first.IsZero() || v.Before(first) {
+			first = v
+		}
+		if v.After(last) {
+			last = v
+		}
+	}
+	as.True(last.Sub(first) < DefaultClusterStartDelay, last.Sub(first))
+
+	// 合并统计
+	r := data[1]
+	as.Len(r.ActionArray, 2)
+	as.Equal(11, r.ActionArray[0].Count)
+	as.Equal(1, r.ActionArray[0].Fail)
+	as.Equal(10, r.ActionArray[1].Count)
+	as.Equal(1, r.ActionArray[1].Skip)
+	as.Equal(PubFloatRound(1.0/11, 4), r.FailRate)
+	as.Equal("robot 7", r.ErrText)
+	as.True(r.ActionArray[0].TimeP50 >= time.Millisecond*5)
+	as.True(r.PerfTime90Avg >= time.Millisecond*5)
+	as.True(r.Concurrency >= 3)
+	as.NotNil(r.Generator)
+	as.True(r.Generator.Goroutines > 0)
+	as.True(r.TpsAvg > 0)
+
+	// 场景不一致
+	other := testClusterScene("other", func(u *Robot) {})
+	other.Workers = workers
+	_, err = other.RunSurge(&FormSurge{NumInit: 2, BatchMax: 1}, nil)
+	as.NotNil(err)
+	as.Contains(err.Error(), "worker")
+}
+
+// 测试协调节点停止时各节点跳过余下的动作, 合并已有的结果
+func Test_ClusterStop(t *testing.T) {
+	as := require.New(t)
+	var (
+		started = make(chan struct{}, 10)
+		workers []string
+	)
+	newScene := func(fn func(u *Robot)) *Scene {
+		robot := NewRobot(&Robot{Name: "robot"})
+		robot.AddAction(NewActionOne(&ActionOne{
+			Name: "wait",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				fn(u)
+				return
+			},
+		}))
+		robot.AddAction(NewActionOne(&ActionOne{Name: "next"}))
+		scene := NewScene(&Scene{Name: "stop", DefaultRobot: robot})
+		scene.Log.SetLevel(2)
+		return scene
+	}
+	for i := 0; i < 2; i++ {
+		w := NewClusterWorker(newScene(func(u *Robot) {
+			started <- struct{}{}
+			for start := time.Now(); !u.Scene.IsStopped() && time.Since(start) < time.Second*5; {
+				time.Sleep(time.Millisecond)
+			}
+		}))
+		srv := httptest.NewServer(w)
+		defer srv.Close()
+		workers = append(workers, srv.URL)
+	}
+
+	scene := newScene(func(u *Robot) { t.Error("coordinator runs robots") })
+	scene.Workers = workers
+	go func() {
+		<-started
+		scene.Stop("distributed")
+	}()
+	start := time.Now()
+	data, err := scene.RunSurge(&FormSurge{NumInit: 4, BatchMax: 3}, nil)
+	as.Nil(err)
+	as.True(time.Since(start) < time.Second*2, time.Since(start))
+	as.Len(data, 1)
+	r := data[0]
+	as.Equal(SceneStatusStop, r.Status)
+	as.Equal("distributed", r.Reason)
+	as.Equal(4, r.ActionArray[0].Count)
+	as.Equal(4, r.ActionArray[1].Skip)
+}
@@ -0,0 +1,399 @@
+// gobox 按声明式计划文件执行场景测试
+//
+//	gobox run [-report path] [-metrics addr] [-dashboard addr] [-progress] [-samples path] [-workers addrs] [-v] plan.yaml
+//	gobox worker [-listen addr] plan.yaml
+//	gobox validate plan.yaml
+//	gobox har [-host h] [-type json] [-go pkg] session.har
+//	gobox analyze [-window ms] [-from ms] [-to ms] [-action a] [-p 99.9] samples.log
+//	gobox compare [-latency 0.1] [-alpha 0.05] baseline.json candidate.json
+package main
+
+import (
+	"github.com/suboat/go-box"
+	_ "github.com/suboat/go-box/boxgrpc" // 注册grpc动作
+	"github.com/suboat/go-contrib"
+
+	"github.com/tudyzhb/yaml"
+
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 退出码
+const (
+	exitOk    = 0 // 通过
+	exitFail  = 1 // 场景状态或阀值不通过
+	exitError = 2 // 参数或执行错误
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitError)
+	}
+	switch os.Args[1] {
+	case "run":
+		os.Exit(cmdRun(os.Args[2:]))
+	case "worker":
+		os.Exit(cmdWorker(os.Args[2:]))
+	case "validate":
+		os.Exit(cmdValidate(os.Args[2:]))
+	case "har":
+		os.Exit(cmdHar(os.Args[2:]))
+	case "analyze":
+		os.Exit(cmdAnalyze(os.Args[2:]))
+	case "compare":
+		os.Exit(cmdCompare(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(exitError)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n  gobox run [-report path] [-metrics addr] [-dashboard addr] [-progress] [-samples path] [-workers addrs] [-v] plan.yaml\n  gobox validate plan.yaml\n")
+	fmt.Fprintf(os.Stderr, "  gobox worker [-listen :7001] [-v] plan.yaml\n")
+	fmt.Fprintf(os.Stderr, "  gobox har [-host h1,h2] [-type json,html] [-think ms] [-go pkg] session.har\n")
+	fmt.Fprintf(os.Stderr, "  gobox analyze [-window ms] [-from ms] [-to ms] [-batch 1,2] [-action a,b] [-robot r] [-p 99.9] [-report path] samples.log\n")
+	fmt.Fprintf(os.Stderr, "  gobox compare [-latency 0.1] [-throughput 0.1] [-fail 0.01] [-capacity 0] [-alpha 0.05] [-o result.json] baseline.json candidate.json\n")
+	fmt.Fprintf(os.Stderr, "action types: %v\n", box.GetActionTypes())
+}
+
+// 执行计划
+func cmdRun(args []string) int {
+	var (
+		fs         = flag.NewFlagSet("run", flag.ExitOnError)
+		reportPath = fs.String("report", "", "report files, comma separated, format by extension: .json .csv .xml(junit) .html; overrides the plan report path")
+		verbose    = fs.Bool("v", false, "debug log")
+		metrics    = fs.String("metrics", "", "serve live Prometheus metrics on this address, e.g. :9100")
+		dashboard  = fs.String("dashboard", "", "serve a live web dashboard with pause/stop/rescale controls on this address, e.g. :9200")
+		progress   = fs.Bool("progress", false, "show live progress and a batch table on stderr instead of log lines; plain lines when stderr is not a terminal")
+		samples    = fs.String("samples", "", "append every action sample to this file for gobox analyze")
+		workers    = fs.String("workers", "", "coordinate these gobox worker addresses, comma separated; robots of each batch are split across them")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+
+	plan, err := box.LoadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] load plan: %s\n", errText(err))
+		return exitError
+	}
+	scene, err := plan.NewScene()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] plan invalid: %s\n", errText(err))
+		return exitError
+	}
+	if *verbose {
+		scene.Log.SetLevel(5)
+	}
+	if *progress {
+		box.NewSceneProgress(scene, os.Stderr)
+		if !*verbose {
+			scene.Log.SetLevel(2)
+		}
+	}
+	if len(*metrics) > 0 {
+		scene.Metrics = box.NewSceneMetrics(nil)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", scene.Metrics)
+		go func() {
+			if err := http.ListenAndServe(*metrics, mux); err != nil {
+				fmt.Fprintf(os.Stderr, "[gobox] metrics: %v\n", err)
+			}
+		}()
+	}
+	if len(*dashboard) > 0 {
+		d := box.NewSceneDashboard(scene)
+		go func() {
+			if err := http.ListenAndServe(*dashboard, d); err != nil {
+				fmt.Fprintf(os.Stderr, "[gobox] dashboard: %v\n", err)
+			}
+		}()
+	}
+
+	scene.Workers = splitList(*workers)
+	if len(*samples) > 0 {
+		if scene.Sink, err = box.NewSinkSample(*samples); err != nil {
+			fmt.Fprintf(os.Stderr, "[gobox] samples: %v\n", err)
+			return exitError
+		}
+		defer scene.Sink.Close()
+	}
+
+	// 保存报告: 第一次Ctrl-C结束本轮后正常返回, 第二次立即退出前保存已有的结果
+	if len(*reportPath) == 0 {
+		*reportPath = plan.Report
+	}
+	saveReport := func(data []*box.ResultScene) (err error) {
+		if len(*reportPath) > 0 {
+			if err = plan.SaveReport(*reportPath, data); err != nil {
+				fmt.Fprintf(os.Stderr, "[gobox] save report: %v\n", err)
+			}
+		}
+		return
+	}
+	scene.Signal = true
+	scene.FnExit = func(s *box.Scene, data []*box.ResultScene) {
+		saveReport(data)
+	}
+
+	// 逐轮输出结果
+	var (
+		cache = make(chan *box.ResultScene)
+		wg    sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range cache {
+			if !*progress {
+				fmt.Println(r.String())
+			}
+		}
+	}()
+	data, err := plan.Run(scene, cache)
+	close(cache)
+	wg.Wait()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] run: %s\n", errText(err))
+		return exitError
+	}
+
+	// 保存报告
+	if err = saveReport(data); err != nil {
+		return exitError
+	}
+
+	// 检查结果
+	if err = plan.Check(data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFail
+	}
+	return exitOk
+}
+
+// 作为工作节点, 等待协调节点下发各轮机器人
+func cmdWorker(args []string) int {
+	var (
+		fs      = flag.NewFlagSet("worker", flag.ExitOnError)
+		listen  = fs.String("listen", ":7001", "listen address")
+		verbose = fs.Bool("v", false, "debug log")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	plan, err := box.LoadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] load plan: %s\n", errText(err))
+		return exitError
+	}
+	scene, err := plan.NewScene()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] plan invalid: %s\n", errText(err))
+		return exitError
+	}
+	if *verbose {
+		scene.Log.SetLevel(5)
+	}
+	scene.Log.Infof(`[gobox] worker %s listen %s`, scene.Name, *listen)
+	if err = http.ListenAndServe(*listen, box.NewClusterWorker(scene)); err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] worker: %v\n", err)
+		return exitError
+	}
+	return exitOk
+}
+
+// 检查计划
+func cmdValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	plan, err := box.LoadPlan(fs.Arg(0))
+	if err == nil {
+		err = plan.Valid()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] %s invalid: %s\n", fs.Arg(0), errText(err))
+		return exitFail
+	}
+	fmt.Printf("[gobox] %s ok\n", fs.Arg(0))
+	return exitOk
+}
+
+// 由HAR生成计划或Go代码, 输出到标准输出
+func cmdHar(args []string) int {
+	var (
+		fs    = flag.NewFlagSet("har", flag.ExitOnError)
+		hosts = fs.String("host", "", "only import these hosts, comma separated")
+		types = fs.String("type", "", "only import these response types, comma separated, e.g. json,html")
+		think = fs.Int64("think", 100, "ignore think time shorter than this, ms")
+		pkg   = fs.String("go", "", "emit Go code in this package instead of a plan")
+		name  = fs.String("name", "", "plan name")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	opt := &box.HarOption{Name: *name, ThinkMin: *think}
+	if len(*hosts) > 0 {
+		opt.Hosts = strings.Split(*hosts, ",")
+	}
+	if len(*types) > 0 {
+		opt.Types = strings.Split(*types, ",")
+	}
+	plan, err := box.LoadHar(fs.Arg(0), opt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] har: %s\n", errText(err))
+		return exitError
+	}
+	var b []byte
+	if len(*pkg) > 0 {
+		b, err = box.PlanToGo(plan, *pkg)
+	} else {
+		b, err = yaml.Marshal(plan)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] har: %s\n", errText(err))
+		return exitError
+	}
+	os.Stdout.Write(b)
+	return exitOk
+}
+
+// 由样本文件重新统计, 输出各轮结果与各动作耗时
+func cmdAnalyze(args []string) int {
+	var (
+		fs          = flag.NewFlagSet("analyze", flag.ExitOnError)
+		form        = new(box.FormAnalyze)
+		batches     = fs.String("batch", "", "only these batches, 1-based, comma separated")
+		actions     = fs.String("action", "", "only these actions, comma separated")
+		robots      = fs.String("robot", "", "only these robots, comma separated")
+		percentiles = fs.String("p", "", "extra latency percentiles, comma separated, e.g. 99.9")
+		reportPath  = fs.String("report", "", "report files, comma separated, format by extension")
+	)
+	fs.Int64Var(&form.Window, "window", 0, "regroup by start time every this many ms instead of by batch")
+	fs.Int64Var(&form.From, "from", 0, "only robots started this many ms after the first sample")
+	fs.Int64Var(&form.To, "to", 0, "only robots started before this many ms after the first sample")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		return exitError
+	}
+	for _, s := range splitList(*batches) {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[gobox] batch: %v\n", err)
+			return exitError
+		}
+		form.Batches = append(form.Batches, v)
+	}
+	for _, s := range splitList(*percentiles) {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[gobox] p: %v\n", err)
+			return exitError
+		}
+		form.Percentiles = append(form.Percentiles, v)
+	}
+	form.Actions = splitList(*actions)
+	form.Robots = splitList(*robots)
+
+	data, err := box.AnalyzeSampleFile(fs.Arg(0), form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] analyze: %s\n", errText(err))
+		return exitError
+	}
+	for _, r := range data {
+		fmt.Println(r.String())
+		for _, a := range r.ActionArray {
+			fmt.Printf("  %-20s n:%d fail:%d skip:%d avg:%s p50:%s p90:%s p99:%s max:%s",
+				a.Name, a.Count, a.Fail, a.Skip, a.TimeAvg, a.TimeP50, a.TimeP90, a.TimeP99, a.TimeMax)
+			for _, p := range form.Percentiles {
+				k := "p" + strconv.FormatFloat(p, 'f', -1, 64)
+				fmt.Printf(" %s:%s", k, a.TimeCustom[k])
+			}
+			fmt.Println()
+		}
+	}
+	if len(data) > 0 && len(*reportPath) > 0 {
+		report := box.NewReport(data[0].Scene, data)
+		for _, p := range splitList(*reportPath) {
+			if err = report.Save(p); err != nil {
+				fmt.Fprintf(os.Stderr, "[gobox] save report: %v\n", err)
+				return exitError
+			}
+		}
+	}
+	return exitOk
+}
+
+// 对比两份json报告, 出现退化时以1退出
+func cmdCompare(args []string) int {
+	var (
+		fs   = flag.NewFlagSet("compare", flag.ExitOnError)
+		form = new(box.FormCompare)
+		out  = fs.String("o", "", "also save the comparison as json")
+	)
+	fs.Float64Var(&form.Latency, "latency", box.DefaultCompareLatency, "tolerated latency increase, 0.1 is 10%")
+	fs.Float64Var(&form.Throughput, "throughput", box.DefaultCompareThroughput, "tolerated throughput decrease")
+	fs.Float64Var(&form.FailRate, "fail", box.DefaultCompareFailRate, "tolerated error rate increase, absolute")
+	fs.Float64Var(&form.Capacity, "capacity", 0, "tolerated capacity decrease")
+	fs.Float64Var(&form.Alpha, "alpha", box.DefaultCompareAlpha, "significance level")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+		return exitError
+	}
+	ret, err := box.CompareReportFile(fs.Arg(0), fs.Arg(1), form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[gobox] compare: %s\n", errText(err))
+		return exitError
+	}
+	ret.WriteText(os.Stdout)
+	if len(*out) > 0 {
+		b, _ := json.MarshalIndent(ret, "", "  ")
+		if err = ioutil.WriteFile(*out, b, 0666); err != nil {
+			fmt.Fprintf(os.Stderr, "[gobox] compare: %v\n", err)
+			return exitError
+		}
+	}
+	if !ret.IsPass() {
+		return exitFail
+	}
+	return exitOk
+}
+
+// 拆分逗号分隔的参数
+func splitList(s string) (ret []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			ret = append(ret, v)
+		}
+	}
+	return
+}
+
+// 错误文本, 展开contrib错误的参数
+func errText(err error) string {
+	if e, ok := err.(*contrib.Error); ok {
+		return fmt.Sprintf("%s %v", e.GetDetail(), e.GetVars())
+	}
+	return err.Error()
+}
@@ -0,0 +1,59 @@
+package box
+
+// 对比默认参数, 见FormCompare
+var (
+	DefaultCompareLatency    = 0.1  // 耗时容许增幅
+	DefaultCompareThroughput = 0.1  // 吞吐容许降幅
+	DefaultCompareFailRate   = 0.01 // 错误率容许增加值
+	DefaultCompareAlpha      = 0.05 // 显著性水平
+)
+
+// 对比项名
+const (
+	CompareCapacity   = "capacity"   // 容量上限: 未出错且性能未下降的最大机器人数
+	CompareThroughput = "throughput" // 每秒完成的动作数
+	CompareFailRate   = "failRate"   // 错误率
+	CompareTimeAvg    = "avg"        // 平均耗时
+	CompareTimeP50    = "p50"        //
+	CompareTimeP90    = "p90"        //
+	CompareTimeP95    = "p95"        //
+	CompareTimeP99    = "p99"        //
+)
+
+// 基线与候选两次执行的对比结果
+type CompareResult struct {
+	Baseline    string          `json:"baseline"`    // 基线名
+	Candidate   string          `json:"candidate"`   // 候选名
+	Capacity    *CompareValue   `json:"capacity"`    // 容量上限
+	Batches     []*CompareBatch `json:"batches"`     // 按机器人数对齐的各轮
+	Unmatched   []int           `json:"unmatched"`   // 只在一方出现的机器人数
+	Regressions []*CompareValue `json:"regressions"` // 全部退化项
+	Params      *FormCompare    `json:"params"`      // 对比参数, 已填入默认值
+}
+
+// 机器人数相同的一轮
+type CompareBatch struct {
+	Robots    int              `json:"robots"`    // 机器人数
+	Baseline  int              `json:"baseline"`  // 基线轮次
+	Candidate int              `json:"candidate"` // 候选轮次
+	Values    []*CompareValue  `json:"values"`    // 吞吐与错误率
+	Actions   []*CompareAction `json:"actions"`   // 各动作, 按动作名对齐
+}
+
+// 一个动作的对比
+type CompareAction struct {
+	Name   string          `json:"name"`   // 动作名
+	Values []*CompareValue `json:"values"` // 耗时与错误率
+}
+
+// 一项对比
+type CompareValue struct {
+	Name      string  `json:"name"`      // 对比项, 见Compare*
+	Robots    int     `json:"robots"`    // 所在轮的机器人数
+	Action    string  `json:"action"`    // 所属动作, 整轮为空
+	Baseline  float64 `json:"baseline"`  // 基线值, 耗时单位毫秒
+	Candidate float64 `json:"candidate"` // 候选值
+	Delta     float64 `json:"delta"`     // 变化: 错误率为差值, 其它为相对基线的变化率
+	PValue    float64 `json:"pValue"`    // 候选更差的单侧p值, -1:无法检验
+	Regress   bool    `json:"regress"`   // 超出容许范围且统计显著
+}
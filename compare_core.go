@@ -0,0 +1,365 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 读取基线与候选两份json报告并对比
+func CompareReportFile(baselinePath, candidatePath string, form *FormCompare) (ret *CompareResult, err error) {
+	var base, cand *Report
+	if base, err = LoadReport(baselinePath); err != nil {
+		return
+	}
+	if cand, err = LoadReport(candidatePath); err != nil {
+		return
+	}
+	if ret, err = Compare(base.GetData(), cand.GetData(), form); err != nil {
+		return
+	}
+	ret.Baseline = baselinePath
+	ret.Candidate = candidatePath
+	return
+}
+
+// 对比基线与候选两次执行: 各轮按机器人数对齐, 同一机器人数出现多次时按先后对齐; 动作按动作名对齐
+//
+// 耗时以Welch t检验平均耗时的差异, 百分位沿用同一动作的检验结果; 错误率以双比例z检验; 吞吐以泊松计数检验
+func Compare(baseline, candidate []*ResultScene, form *FormCompare) (ret *CompareResult, err error) {
+	if len(baseline) == 0 || len(candidate) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("no result")
+	}
+	opt := FormCompare{}
+	if form != nil {
+		opt = *form
+	}
+	if err = opt.Valid(); err != nil {
+		return
+	}
+	if opt.Latency == 0 {
+		opt.Latency = DefaultCompareLatency
+	}
+	if opt.Throughput == 0 {
+		opt.Throughput = DefaultCompareThroughput
+	}
+	if opt.FailRate == 0 {
+		opt.FailRate = DefaultCompareFailRate
+	}
+	if opt.Alpha == 0 {
+		opt.Alpha = DefaultCompareAlpha
+	}
+	ret = &CompareResult{Params: &opt}
+
+	// 容量上限
+	ret.Capacity = ret.value(CompareCapacity, 0, "", float64(compareCapacity(baseline)), float64(compareCapacity(candidate)), -1)
+	if ret.Capacity.Baseline > 0 {
+		ret.Capacity.Delta = (ret.Capacity.Candidate - ret.Capacity.Baseline) / ret.Capacity.Baseline
+		ret.Capacity.Regress = ret.Capacity.Delta < -opt.Capacity
+	}
+
+	// 按机器人数对齐
+	var (
+		candRobots = map[int][]*ResultScene{}
+		baseSeen   = map[int]int{}
+		unmatched  = map[int]bool{}
+	)
+	for _, r := range candidate {
+		candRobots[r.BatchRobot] = append(candRobots[r.BatchRobot], r)
+	}
+	for _, b := range baseline {
+		idx := baseSeen[b.BatchRobot]
+		baseSeen[b.BatchRobot] = idx + 1
+		if idx >= len(candRobots[b.BatchRobot]) {
+			unmatched[b.BatchRobot] = true
+			continue
+		}
+		ret.Batches = append(ret.Batches, ret.batch(b, candRobots[b.BatchRobot][idx]))
+	}
+	for robots, arr := range candRobots {
+		if len(arr) > baseSeen[robots] {
+			unmatched[robots] = true
+		}
+	}
+	for robots := range unmatched {
+		ret.Unmatched = append(ret.Unmatched, robots)
+	}
+	sort.Ints(ret.Unmatched)
+
+	// 汇总退化项
+	if ret.Capacity.Regress {
+		ret.Regressions = append(ret.Regressions, ret.Capacity)
+	}
+	for _, b := range ret.Batches {
+		for _, v := range b.Values {
+			if v.Regress {
+				ret.Regressions = append(ret.Regressions, v)
+			}
+		}
+		for _, a := range b.Actions {
+			for _, v := range a.Values {
+				if v.Regress {
+					ret.Regressions = append(ret.Regressions, v)
+				}
+			}
+		}
+	}
+	return
+}
+
+// 对比一轮
+func (d *CompareResult) batch(base, cand *ResultScene) (ret *CompareBatch) {
+	ret = &CompareBatch{Robots: base.BatchRobot, Baseline: base.Batch, Candidate: cand.Batch}
+	opt := d.Params
+
+	// 吞吐: 候选更低为差
+	var (
+		nb, nc = compareCount(base), compareCount(cand)
+		tb, tc = base.TimeRun.Seconds(), cand.TimeRun.Seconds()
+		p      = -1.0
+	)
+	if tb > 0 && tc > 0 && nb+nc > 0 {
+		p = statNormalSf((float64(nb)/tb - float64(nc)/tc) / math.Sqrt(float64(nb)/(tb*tb)+float64(nc)/(tc*tc)))
+	}
+	v := d.value(CompareThroughput, ret.Robots, "", base.GetThroughput(), cand.GetThroughput(), p)
+	if v.Baseline > 0 {
+		v.Delta = (v.Candidate - v.Baseline) / v.Baseline
+		v.Regress = v.Delta < -opt.Throughput && d.isSignificant(p)
+	}
+	ret.Values = append(ret.Values, v)
+
+	// 错误率: 以执行单元计
+	ret.Values = append(ret.Values, d.failRate(ret.Robots, "",
+		int(math.Round(base.FailRate*float64(base.BatchRobot))), base.BatchRobot,
+		int(math.Round(cand.FailRate*float64(cand.BatchRobot))), cand.BatchRobot))
+
+	// 各动作
+	candActions := map[string]*ResultCapacityAction{}
+	for _, a := range cand.ActionArray {
+		candActions[a.Name] = a
+	}
+	for _, a := range base.ActionArray {
+		c := candActions[a.Name]
+		if c == nil {
+			continue
+		}
+		item := &CompareAction{Name: a.Name}
+		p := statWelch(float64(a.TimeAvg), float64(a.TimeStd), a.Count, float64(c.TimeAvg), float64(c.TimeStd), c.Count)
+		for _, t := range []struct {
+			name       string
+			base, cand time.Duration
+		}{
+			{CompareTimeAvg, a.TimeAvg, c.TimeAvg},
+			{CompareTimeP50, a.TimeP50, c.TimeP50},
+			{CompareTimeP90, a.TimeP90, c.TimeP90},
+			{CompareTimeP95, a.TimeP95, c.TimeP95},
+			{CompareTimeP99, a.TimeP99, c.TimeP99},
+		} {
+			v := d.value(t.name, ret.Robots, a.Name, t.base.Seconds()*1000, t.cand.Seconds()*1000, p)
+			if t.base > 0 {
+				v.Delta = (v.Candidate - v.Baseline) / v.Baseline
+				v.Regress = v.Delta > opt.Latency && d.isSignificant(p)
+			}
+			item.Values = append(item.Values, v)
+		}
+		item.Values = append(item.Values, d.failRate(ret.Robots, a.Name, a.Fail, a.Count, c.Fail, c.Count))
+		ret.Actions = append(ret.Actions, item)
+	}
+	return
+}
+
+// 对比错误率
+func (d *CompareResult) failRate(robots int, action string, failBase, numBase, failCand, numCand int) (ret *CompareValue) {
+	var rb, rc float64
+	if numBase > 0 {
+		rb = float64(failBase) / float64(numBase)
+	}
+	if numCand > 0 {
+		rc = float64(failCand) / float64(numCand)
+	}
+	p := -1.0
+	if numBase > 0 && numCand > 0 {
+		pool := float64(failBase+failCand) / float64(numBase+numCand)
+		if se := math.Sqrt(pool * (1 - pool) * (1/float64(numBase) + 1/float64(numCand))); se > 0 {
+			p = statNormalSf((rc - rb) / se)
+		}
+	}
+	ret = d.value(CompareFailRate, robots, action, PubFloatRound(rb, 4), PubFloatRound(rc, 4), p)
+	ret.Delta = PubFloatRound(rc-rb, 4)
+	ret.Regress = rc-rb > d.Params.FailRate && d.isSignificant(p)
+	return
+}
+
+// 新建对比项
+func (d *CompareResult) value(name string, robots int, action string, base, cand, p float64) *CompareValue {
+	if p >= 0 {
+		p = PubFloatRound(p, 6)
+	}
+	return &CompareValue{Name: name, Robots: robots, Action: action, Baseline: base, Candidate: cand, PValue: p}
+}
+
+// 是否统计显著, 无法检验时以容许范围为准
+func (d *CompareResult) isSignificant(p float64) bool {
+	return p < 0 || p < d.Params.Alpha
+}
+
+// 是否没有退化
+func (d *CompareResult) IsPass() bool {
+	return len(d.Regressions) == 0
+}
+
+// 以文本写入对比结果, 退化项以REGRESS标出
+func (d *CompareResult) WriteText(w io.Writer) (err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "baseline:  %s\ncandidate: %s\n", d.Baseline, d.Candidate)
+	fmt.Fprintf(&b, "capacity:  %s\n", d.Capacity.String())
+	for _, batch := range d.Batches {
+		fmt.Fprintf(&b, "#%d vs #%d %du\n", batch.Baseline, batch.Candidate, batch.Robots)
+		for _, v := range batch.Values {
+			fmt.Fprintf(&b, "  %-24s %s\n", v.Name, v.String())
+		}
+		for _, a := range batch.Actions {
+			for _, v := range a.Values {
+				fmt.Fprintf(&b, "  %-24s %s\n", a.Name+" "+v.Name, v.String())
+			}
+		}
+	}
+	if len(d.Unmatched) > 0 {
+		fmt.Fprintf(&b, "unmatched robots: %v\n", d.Unmatched)
+	}
+	if d.IsPass() {
+		b.WriteString("result: pass\n")
+	} else {
+		fmt.Fprintf(&b, "result: %d regressions\n", len(d.Regressions))
+	}
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+//
+func (d *CompareValue) String() (ret string) {
+	switch d.Name {
+	case CompareFailRate:
+		ret = fmt.Sprintf("%.2f%% -> %.2f%% (%+.2f%%", d.Baseline*100, d.Candidate*100, d.Delta*100)
+	case CompareCapacity, CompareThroughput:
+		ret = fmt.Sprintf("%g -> %g (%+.1f%%", d.Baseline, d.Candidate, d.Delta*100)
+	default:
+		ret = fmt.Sprintf("%.3fms -> %.3fms (%+.1f%%", d.Baseline, d.Candidate, d.Delta*100)
+	}
+	if d.PValue >= 0 {
+		ret += fmt.Sprintf(", p=%.4f", d.PValue)
+	}
+	ret += ")"
+	if d.Regress {
+		ret += " REGRESS"
+	}
+	return
+}
+
+// 容量上限: 未出错, 性能未下降且未中途停止的最大机器人数
+func compareCapacity(data []*ResultScene) (ret int) {
+	for _, r := range data {
+		switch r.Status {
+		case SceneStatusFailBreak, SceneStatusFailPerf, SceneStatusStop, SceneStatusBreak, SceneStatusInterrupt:
+			continue
+		}
+		if r.BatchRobot > ret {
+			ret = r.BatchRobot
+		}
+	}
+	return
+}
+
+// 本轮完成的动作数
+func compareCount(r *ResultScene) (ret int) {
+	for _, a := range r.ActionArray {
+		ret += a.Count
+	}
+	return
+}
+
+// 标准正态分布上侧概率 P(Z>z)
+func statNormalSf(z float64) float64 {
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// Welch t检验: 候选均值大于基线的单侧p值, 无法检验时为-1
+func statWelch(m1, s1 float64, n1 int, m2, s2 float64, n2 int) float64 {
+	if n1 < 2 || n2 < 2 {
+		return -1
+	}
+	v1, v2 := s1*s1/float64(n1), s2*s2/float64(n2)
+	if v1+v2 == 0 {
+		return -1
+	}
+	t := (m2 - m1) / math.Sqrt(v1+v2)
+	df := (v1 + v2) * (v1 + v2) / (v1*v1/float64(n1-1) + v2*v2/float64(n2-1))
+	return statStudentSf(t, df)
+}
+
+// t分布上侧概率 P(T>t)
+func statStudentSf(t, df float64) float64 {
+	p := 0.5 * statBetaInc(df/2, 0.5, df/(df+t*t))
+	if t < 0 {
+		return 1 - p
+	}
+	return p
+}
+
+// 正则化不完全贝塔函数 I_x(a,b)
+func statBetaInc(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * statBetaCf(a, b, x) / a
+	}
+	return 1 - front*statBetaCf(b, a, 1-x)/b
+}
+
+// 不完全贝塔函数的连分式, Lentz法
+func statBetaCf(a, b, x float64) float64 {
+	const (
+		eps  = 1e-14
+		tiny = 1e-300
+	)
+	fnTiny := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	var (
+		c = 1.0
+		d = 1 / fnTiny(1-(a+b)*x/(a+1))
+		h = d
+	)
+	for m := 1; m <= 300; m++ {
+		fm, m2 := float64(m), float64(2*m)
+		aa := fm * (b - fm) * x / ((a - 1 + m2) * (a + m2))
+		d = 1 / fnTiny(1+aa*d)
+		c = fnTiny(1 + aa/c)
+		h *= d * c
+		aa = -(a + fm) * (a + b + fm) * x / ((a + m2) * (a + 1 + m2))
+		d = 1 / fnTiny(1+aa*d)
+		c = fnTiny(1 + aa/c)
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,99 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bytes"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 生成一轮对比数据
+func testCompareBatch(batch, robots, status int, avg, std time.Duration, count, fail int) *ResultScene {
+	return &ResultScene{
+		Batch:      batch,
+		BatchRobot: robots,
+		Status:     status,
+		TimeRun:    time.Second * 10,
+		FailRate:   float64(fail) / float64(count),
+		ActionArray: []*ResultCapacityAction{{
+			Name: "login", Count: count, Fail: fail,
+			TimeAvg: avg, TimeStd: std, TimeP50: avg, TimeP90: avg + std, TimeP95: avg + std*2, TimeP99: avg + std*3,
+		}},
+	}
+}
+
+// 测试基线与候选对比
+func Test_Compare(t *testing.T) {
+	as := require.New(t)
+
+	// t分布: t=2, 自由度10, 单侧p约0.0367
+	as.InDelta(0.0367, statStudentSf(2, 10), 1e-4)
+	as.InDelta(0.9633, statStudentSf(-2, 10), 1e-4)
+	as.InDelta(0.5, statStudentSf(0, 5), 1e-9)
+	as.Equal(-1.0, statWelch(1, 0, 10, 2, 0, 10))
+
+	base := []*ResultScene{
+		testCompareBatch(1, 10, SceneStatusNormal, time.Millisecond*100, time.Millisecond*10, 1000, 0),
+		testCompareBatch(2, 20, SceneStatusNormal, time.Millisecond*100, time.Millisecond*10, 1000, 0),
+		testCompareBatch(3, 30, SceneStatusFailPerf, time.Millisecond*200, time.Millisecond*50, 1000, 10),
+	}
+
+	// 退化: 耗时增加30%且显著, 容量下降, 错误率上升
+	cand := []*ResultScene{
+		testCompareBatch(1, 10, SceneStatusNormal, time.Millisecond*130, time.Millisecond*10, 1000, 0),
+		testCompareBatch(2, 20, SceneStatusFailPerf, time.Millisecond*100, time.Millisecond*10, 1000, 50),
+		testCompareBatch(3, 40, SceneStatusFailPerf, time.Millisecond*100, time.Millisecond*10, 1000, 0),
+	}
+	ret, err := Compare(base, cand, nil)
+	as.Nil(err)
+	as.False(ret.IsPass())
+	as.Equal([]int{30, 40}, ret.Unmatched)
+	as.Len(ret.Batches, 2)
+	as.Equal(20.0, ret.Capacity.Baseline)
+	as.Equal(10.0, ret.Capacity.Candidate)
+	as.True(ret.Capacity.Regress)
+	avg := ret.Batches[0].Actions[0].Values[0]
+	as.Equal(CompareTimeAvg, avg.Name)
+	as.InDelta(0.3, avg.Delta, 1e-9)
+	as.True(avg.PValue >= 0 && avg.PValue < 0.001)
+	as.True(avg.Regress)
+	fail := ret.Batches[1].Actions[0].Values[5]
+	as.Equal(CompareFailRate, fail.Name)
+	as.InDelta(0.05, fail.Delta, 1e-9)
+	as.True(fail.Regress)
+	var buf bytes.Buffer
+	as.Nil(ret.WriteText(&buf))
+	as.Contains(buf.String(), "REGRESS")
+	as.Contains(buf.String(), "result: ")
+
+	// 噪声: 耗时增加15%但样本少且波动大, 不视为退化
+	noisy := []*ResultScene{testCompareBatch(1, 10, SceneStatusNormal, time.Millisecond*115, time.Millisecond*80, 10, 0)}
+	noisy[0].TimeRun = time.Millisecond * 100 // 吞吐不变
+	ret, err = Compare(base[:1], noisy, nil)
+	as.Nil(err)
+	as.True(ret.IsPass())
+	as.False(math.IsNaN(ret.Batches[0].Actions[0].Values[0].PValue))
+	ret, err = Compare(base[:1], noisy, &FormCompare{Alpha: 0.5})
+	as.Nil(err)
+	as.False(ret.IsPass())
+
+	// 参数错误
+	_, err = Compare(base, cand, &FormCompare{Throughput: 2})
+	as.NotNil(err)
+	_, err = Compare(nil, cand, nil)
+	as.NotNil(err)
+
+	// 由json报告读取
+	dir := t.TempDir()
+	as.Nil(NewReport("base", base).Save(filepath.Join(dir, "base.json")))
+	as.Nil(NewReport("cand", base).Save(filepath.Join(dir, "cand.json")))
+	ret, err = CompareReportFile(filepath.Join(dir, "base.json"), filepath.Join(dir, "cand.json"), nil)
+	as.Nil(err)
+	as.True(ret.IsPass())
+	as.Len(ret.Batches, 3)
+	as.Equal(0.0, ret.Batches[2].Actions[0].Values[0].Delta)
+	as.Equal(0.01, ret.Batches[2].Actions[0].Values[5].Baseline)
+}
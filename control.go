@@ -0,0 +1,17 @@
+package box
+
+import (
+	"sync"
+)
+
+// 执行控制: 由其它协程在执行中调用Scene.Pause/Resume/Stop/Rescale
+type sceneControl struct {
+	paused  bool          // 暂停中: 机器人在下一个动作前等待
+	stopped bool          // 已停止: 不再执行新的动作, 本轮结束后退出
+	reason  string        // 停止原因
+	status  int           // 停止后的场景状态, 手动停止为SceneStatusStop
+	rescale int           // 大于0时下一轮使用的机器人数
+	done    chan struct{} // 停止时关闭, 用于提前结束等待
+	lock    sync.Mutex    //
+	cond    *sync.Cond    // 暂停结束时通知
+}
@@ -0,0 +1,159 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"sync"
+	"time"
+)
+
+// 暂停: 机器人完成当前动作后等待, 直到Resume或Stop
+func (s *Scene) Pause() {
+	c := s.getControl()
+	c.lock.Lock()
+	c.paused = true
+	c.lock.Unlock()
+	s.Log.Infof(`[scene-control] pause`)
+}
+
+// 恢复执行
+func (s *Scene) Resume() {
+	c := s.getControl()
+	c.lock.Lock()
+	c.paused = false
+	c.lock.Unlock()
+	c.cond.Broadcast()
+	s.Log.Infof(`[scene-control] resume`)
+}
+
+// 停止: 不再执行新的动作, 剩余动作视为跳过; 本轮统计后以SceneStatusStop结束
+func (s *Scene) Stop(reason string) {
+	s.stop(SceneStatusStop, reason)
+	s.Log.Warnf(`[scene-control] stop: %s`, reason)
+}
+
+// 停止并指定本轮结束后的场景状态, 已停止时不改变原因与状态; 返回是否由本次停止
+func (s *Scene) stop(status int, reason string) (ok bool) {
+	c := s.getControl()
+	c.lock.Lock()
+	if !c.stopped {
+		ok = true
+		c.stopped = true
+		c.reason = reason
+		c.status = status
+		if c.done != nil {
+			close(c.done)
+		}
+	}
+	c.paused = false
+	c.lock.Unlock()
+	c.cond.Broadcast()
+	return
+}
+
+// 调整下一轮的机器人数, 之后各轮在此基础上按NumStep增加
+func (s *Scene) Rescale(robots int) (err error) {
+	if robots <= 0 {
+		return contrib.ErrParamInvalid.SetVars("robots")
+	}
+	c := s.getControl()
+	c.lock.Lock()
+	c.rescale = robots
+	c.lock.Unlock()
+	s.Log.Infof(`[scene-control] rescale %d`, robots)
+	return
+}
+
+// 是否暂停中
+func (s *Scene) IsPaused() bool {
+	c := s.getControl()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.paused
+}
+
+// 是否已停止
+func (s *Scene) IsStopped() bool {
+	c := s.getControl()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stopped
+}
+
+// 停止原因
+func (s *Scene) GetStopReason() string {
+	c := s.getControl()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.reason
+}
+
+//
+func (s *Scene) getControl() *sceneControl {
+	c := &s.control
+	c.lock.Lock()
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.lock)
+	}
+	c.lock.Unlock()
+	return c
+}
+
+// 执行开始时清除上次执行的控制状态
+func (s *Scene) resetControl() {
+	c := s.getControl()
+	c.lock.Lock()
+	c.paused = false
+	c.stopped = false
+	c.reason = ""
+	c.status = SceneStatusNormal
+	c.rescale = 0
+	c.done = make(chan struct{})
+	c.lock.Unlock()
+}
+
+// 停止后的场景状态, 未停止时为SceneStatusNormal
+func (s *Scene) getStopStatus() int {
+	c := s.getControl()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.status
+}
+
+// 停止时关闭的通道, 未执行过时为空
+func (s *Scene) getDone() <-chan struct{} {
+	c := s.getControl()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.done
+}
+
+// 等待d, 已停止或等待中停止时提前返回; 虚拟时钟按原样等待
+func (s *Scene) sleepControl(clock Clock, d time.Duration) {
+	clockSleep(clock, d, s.getDone())
+}
+
+// 暂停中则等待, 返回是否已停止; 等待期间不参与虚拟时钟的推进, 调用者已登记
+func (s *Scene) waitControl(clock Clock) (stopped bool) {
+	c := s.getControl()
+	c.lock.Lock()
+	if c.paused && !c.stopped {
+		clockAdd(clock, -1)
+		for c.paused && !c.stopped {
+			c.cond.Wait()
+		}
+		clockAdd(clock, 1)
+	}
+	stopped = c.stopped
+	c.lock.Unlock()
+	return
+}
+
+// 取出调整后的机器人数, 0为未调整
+func (s *Scene) takeRescale() (ret int) {
+	c := s.getControl()
+	c.lock.Lock()
+	ret, c.rescale = c.rescale, 0
+	c.lock.Unlock()
+	return
+}
@@ -0,0 +1,7 @@
+package box
+
+// 并发计数: 以原子操作记录当前与最大并发, 机器人协程中无锁调用
+type concurrencyCounter struct {
+	now int64 // 当前并发
+	max int64 // 最大并发, 取出后清零
+}
@@ -0,0 +1,39 @@
+package box
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 并发变化
+func (d *concurrencyCounter) add(n int64) {
+	now := atomic.AddInt64(&d.now, n)
+	for {
+		max := atomic.LoadInt64(&d.max)
+		if now <= max || atomic.CompareAndSwapInt64(&d.max, max, now) {
+			return
+		}
+	}
+}
+
+// 取出最大并发并以当前并发重新开始
+func (d *concurrencyCounter) takeMax() int64 {
+	return atomic.SwapInt64(&d.max, atomic.LoadInt64(&d.now))
+}
+
+// 各执行单元中最后完成的错误, 执行结束后由结果得出, 执行中无需同步
+func lastUnitError(units [][]*RobotActionResult) (ret error) {
+	var last time.Time
+	for _, unit := range units {
+		for _, r := range unit {
+			if r == nil || r.Status == ActionStatusNormal || r.Error == nil {
+				continue
+			}
+			if ret == nil || !r.TimeFinish.Before(last) {
+				ret = r.Error
+				last = r.TimeFinish
+			}
+		}
+	}
+	return
+}
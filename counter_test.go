@@ -0,0 +1,87 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试并发计数与最后错误
+func Test_ConcurrencyCounter(t *testing.T) {
+	as := require.New(t)
+	var (
+		c  concurrencyCounter
+		wg sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				c.add(1)
+				c.add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+	max := c.takeMax()
+	as.True(max >= 1 && max <= 8, max)
+	as.EqualValues(0, c.takeMax())
+
+	// 取出后以当前并发重新开始
+	c.add(3)
+	c.add(-1)
+	as.EqualValues(3, c.takeMax())
+	as.EqualValues(2, c.takeMax())
+
+	now := time.Now()
+	units := [][]*RobotActionResult{
+		{{Status: ActionStatusNormal, TimeFinish: now.Add(time.Second)}, {Status: ActionStatusClose}},
+		{{Status: ActionStatusFreeze, Error: fmt.Errorf("b"), TimeFinish: now}, nil},
+		{{Status: ActionStatusFreeze, Error: fmt.Errorf("a"), TimeFinish: now.Add(-time.Second)}},
+	}
+	as.Equal("b", lastUnitError(units).Error())
+	as.Nil(lastUnitError(units[:1]))
+}
+
+// 并发计数的开销
+func Benchmark_ConcurrencyCounter(b *testing.B) {
+	var c concurrencyCounter
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.add(1)
+			c.add(-1)
+		}
+	})
+}
+
+// 执行一个空动作的开销, 每次迭代为一个动作: 默认输出下含并发计数与结果记录
+func benchmarkSceneAction(b *testing.B, streaming bool) {
+	const actions = 10
+	robot := NewRobot(&Robot{Name: "robot"})
+	for i := 0; i < actions; i++ {
+		robot.AddAction(NewActionOne(&ActionOne{Name: fmt.Sprintf("a%d", i), Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			return
+		}}))
+	}
+	scene := NewScene(&Scene{Name: "bench", DefaultRobot: robot, Streaming: streaming})
+	scene.Log.SetLevel(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	data, err := scene.RunSurge(&FormSurge{NumInit: b.N/actions + 1, BatchMax: 1}, nil)
+	b.StopTimer()
+	if err != nil || len(data) != 1 {
+		b.Fatal(err)
+	}
+}
+
+func Benchmark_SceneAction(b *testing.B) {
+	benchmarkSceneAction(b, false)
+}
+
+func Benchmark_SceneActionStreaming(b *testing.B) {
+	benchmarkSceneAction(b, true)
+}
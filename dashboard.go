@@ -0,0 +1,103 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultDashboardInterval = time.Second // 图表采样间隔
+	DefaultDashboardPoints   = 3600        // 保留的采样点数
+	DefaultDashboardErrors   = 20          // 保留的最近错误数
+	DefaultDashboardBatches  = 50          // 保留的已完成轮数
+)
+
+// 场景实时网页: 作为结果输出在执行中更新, 作为http处理器提供页面, SSE数据流与暂停/停止/调整机器人数的控制
+//
+// 路径: / 页面, /events SSE数据流, /state 当前状态, /control 控制(POST action=pause|resume|stop|rescale, robots=N)
+type SceneDashboard struct {
+	Scene    *Scene        // 控制的场景
+	Interval time.Duration // 采样间隔, 默认DefaultDashboardInterval
+	//
+	scene       string             // 场景名
+	category    string             // 测试类型
+	batch       int                // 当前轮次, 1起始
+	batchMax    int                // 最大轮次
+	batchRobot  int                // 本轮机器人数
+	status      int                // 最近一轮的场景状态
+	running     bool               // 是否正在执行
+	concurrency int64              // 当前并发, 原子操作
+	timeStart   time.Time          // 本轮开始时间
+	actions     []*dashboardAction // 本轮各动作, 按动作位置
+	window      *Histogram         // 本采样间隔内的耗时
+	windowFail  int                // 本采样间隔内的失败数
+	points      []*DashboardPoint  // 采样点
+	errors      []*DashboardError  // 最近的错误
+	batches     []*ResultScene     // 已完成的轮
+	seq         int64              // 最后一个采样点的序号
+	stop        chan struct{}      // 停止采样
+	lock        sync.Mutex         //
+}
+
+// 本轮一个动作的统计
+type dashboardAction struct {
+	name  string
+	fail  int
+	skip  int
+	spent *Histogram
+}
+
+// 一个采样点
+type DashboardPoint struct {
+	Seq         int64     `json:"seq"`         // 序号
+	Time        time.Time `json:"time"`        // 采样时间
+	Throughput  float64   `json:"throughput"`  // 每秒完成的动作数
+	ErrorRate   float64   `json:"errorRate"`   // 错误率
+	P50         float64   `json:"p50"`         // 耗时, 单位毫秒
+	P90         float64   `json:"p90"`         //
+	P99         float64   `json:"p99"`         //
+	Concurrency int64     `json:"concurrency"` // 并发
+}
+
+// 一个最近的错误
+type DashboardError struct {
+	Time   time.Time `json:"time"`   // 动作开始时间
+	Robot  string    `json:"robot"`  // 机器人名
+	Action string    `json:"action"` // 动作名
+	Class  string    `json:"class"`  // 错误分类
+	Error  string    `json:"error"`  // 错误文本
+}
+
+// 本轮一个动作
+type DashboardAction struct {
+	Name  string  `json:"name"`  // 动作名
+	Count int     `json:"count"` // 执行次数
+	Fail  int     `json:"fail"`  // 失败次数
+	Skip  int     `json:"skip"`  // 跳过次数
+	Avg   float64 `json:"avg"`   // 耗时, 单位毫秒
+	P50   float64 `json:"p50"`   //
+	P90   float64 `json:"p90"`   //
+	P99   float64 `json:"p99"`   //
+	Max   float64 `json:"max"`   //
+}
+
+// 当前状态
+type DashboardState struct {
+	Scene       string             `json:"scene"`       // 场景名
+	Category    string             `json:"category"`    // 测试类型
+	Batch       int                `json:"batch"`       // 当前轮次
+	BatchMax    int                `json:"batchMax"`    // 最大轮次
+	Robots      int                `json:"robots"`      // 本轮机器人数
+	Status      int                `json:"status"`      // 最近一轮的场景状态
+	Running     bool               `json:"running"`     // 是否正在执行
+	Paused      bool               `json:"paused"`      // 是否暂停中
+	Stopped     bool               `json:"stopped"`     // 是否已停止
+	Reason      string             `json:"reason"`      // 停止原因
+	Concurrency int64              `json:"concurrency"` // 当前并发
+	TimeStart   time.Time          `json:"timeStart"`   // 本轮开始时间
+	Actions     []*DashboardAction `json:"actions"`     // 本轮各动作
+	Errors      []*DashboardError  `json:"errors"`      // 最近的错误, 新的在前
+	Batches     []*ResultScene     `json:"batches"`     // 已完成的轮
+	Points      []*DashboardPoint  `json:"points"`      // 采样点, SSE中只含新增的
+}
@@ -0,0 +1,294 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 创建场景实时网页并赋给scene.Dashboard
+func NewSceneDashboard(scene *Scene) (d *SceneDashboard) {
+	d = &SceneDashboard{Scene: scene, Interval: DefaultDashboardInterval, window: NewHistogram()}
+	if scene != nil {
+		scene.Dashboard = d
+	}
+	return
+}
+
+// 本轮开始
+func (d *SceneDashboard) OnBatchStart(report *ResultScene) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.scene = report.Scene
+	d.category = report.Category
+	d.batch = report.Batch
+	d.batchMax = report.BatchMax
+	d.batchRobot = report.BatchRobot
+	d.timeStart = report.TimeStart
+	d.running = true
+	d.actions = nil
+	if d.stop == nil {
+		if d.window == nil {
+			d.window = NewHistogram()
+		}
+		d.stop = make(chan struct{})
+		go d.loop(d.stop)
+	}
+}
+
+// 本轮结束
+func (d *SceneDashboard) OnBatch(report *ResultScene) {
+	d.lock.Lock()
+	d.status = report.Status
+	if n := len(d.batches); n > 0 && d.batches[n-1].Batch == report.Batch && d.batches[n-1].TimeStart.Equal(report.TimeStart) {
+		// 同一轮再次输出, 如轮间停止时, 以最后输出的为准
+		d.batches[n-1] = report
+	} else {
+		d.batches = append(d.batches, report)
+	}
+	if len(d.batches) > DefaultDashboardBatches {
+		d.batches = d.batches[len(d.batches)-DefaultDashboardBatches:]
+	}
+	d.lock.Unlock()
+}
+
+// 执行结束: 停止采样
+func (d *SceneDashboard) Close() error {
+	d.lock.Lock()
+	d.running = false
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	d.lock.Unlock()
+	d.sample()
+	return nil
+}
+
+// 并发变化: 原子计数, 不加锁
+func (d *SceneDashboard) OnConcurrency(add int64) {
+	atomic.AddInt64(&d.concurrency, add)
+}
+
+// 记录一个动作样本
+func (d *SceneDashboard) OnSample(r *ResultSample) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for len(d.actions) <= r.Step {
+		d.actions = append(d.actions, &dashboardAction{spent: NewHistogram()})
+	}
+	a := d.actions[r.Step]
+	a.name = r.Action
+	if r.IsSkip() {
+		a.skip += 1
+		return
+	}
+	a.spent.Add(r.TimeSpent)
+	if d.window == nil {
+		d.window = NewHistogram()
+	}
+	d.window.Add(r.TimeSpent)
+	if r.Status != ActionStatusNormal {
+		a.fail += 1
+		d.windowFail += 1
+		d.errors = append([]*DashboardError{{
+			Time:   r.TimeStart,
+			Robot:  r.Robot,
+			Action: r.Action,
+			Class:  r.ErrClass,
+			Error:  r.ErrText,
+		}}, d.errors...)
+		if len(d.errors) > DefaultDashboardErrors {
+			d.errors = d.errors[:DefaultDashboardErrors]
+		}
+	}
+}
+
+// 按采样间隔生成采样点
+func (d *SceneDashboard) loop(stop chan struct{}) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultDashboardInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			d.sample()
+		}
+	}
+}
+
+// 生成一个采样点并开始新的采样间隔
+func (d *SceneDashboard) sample() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var (
+		now      = time.Now()
+		interval = d.Interval
+		p        = &DashboardPoint{Time: now, Concurrency: atomic.LoadInt64(&d.concurrency)}
+		w        = d.window
+	)
+	if interval <= 0 {
+		interval = DefaultDashboardInterval
+	}
+	if len(d.points) > 0 {
+		interval = now.Sub(d.points[len(d.points)-1].Time)
+	}
+	if w != nil && w.Count > 0 {
+		p.Throughput = PubFloatRound(float64(w.Count)/interval.Seconds(), 4)
+		p.ErrorRate = PubFloatRound(float64(d.windowFail)/float64(w.Count), 4)
+		p.P50 = dashboardMs(w.Quantile(50))
+		p.P90 = dashboardMs(w.Quantile(90))
+		p.P99 = dashboardMs(w.Quantile(99))
+	}
+	d.seq += 1
+	p.Seq = d.seq
+	d.points = append(d.points, p)
+	if len(d.points) > DefaultDashboardPoints {
+		d.points = d.points[len(d.points)-DefaultDashboardPoints:]
+	}
+	d.window = NewHistogram()
+	d.windowFail = 0
+}
+
+// 取当前状态, 只含序号大于after的采样点
+func (d *SceneDashboard) GetState(after int64) (ret *DashboardState) {
+	d.lock.Lock()
+	ret = &DashboardState{
+		Scene:       d.scene,
+		Category:    d.category,
+		Batch:       d.batch,
+		BatchMax:    d.batchMax,
+		Robots:      d.batchRobot,
+		Status:      d.status,
+		Running:     d.running,
+		Concurrency: atomic.LoadInt64(&d.concurrency),
+		TimeStart:   d.timeStart,
+		Errors:      append([]*DashboardError{}, d.errors...),
+		Batches:     append([]*ResultScene{}, d.batches...),
+	}
+	for _, a := range d.actions {
+		item := &DashboardAction{Name: a.name, Count: int(a.spent.Count), Fail: a.fail, Skip: a.skip}
+		if a.spent.Count > 0 {
+			item.Avg = dashboardMs(a.spent.Mean())
+			item.P50 = dashboardMs(a.spent.Quantile(50))
+			item.P90 = dashboardMs(a.spent.Quantile(90))
+			item.P99 = dashboardMs(a.spent.Quantile(99))
+			item.Max = dashboardMs(time.Duration(a.spent.Max))
+		}
+		ret.Actions = append(ret.Actions, item)
+	}
+	for _, p := range d.points {
+		if p.Seq > after {
+			ret.Points = append(ret.Points, p)
+		}
+	}
+	d.lock.Unlock()
+	if s := d.Scene; s != nil {
+		ret.Paused = s.IsPaused()
+		ret.Stopped = s.IsStopped()
+		ret.Reason = s.GetStopReason()
+	}
+	return
+}
+
+// 执行控制: pause|resume|stop|rescale
+func (d *SceneDashboard) Control(action string, robots int) (err error) {
+	s := d.Scene
+	if s == nil {
+		return contrib.ErrParamInvalid.SetVars("scene")
+	}
+	switch action {
+	case "pause":
+		s.Pause()
+	case "resume":
+		s.Resume()
+	case "stop":
+		s.Stop("stopped from dashboard")
+	case "rescale":
+		err = s.Rescale(robots)
+	default:
+		err = contrib.ErrParamInvalid.SetVars("action")
+	}
+	return
+}
+
+// 提供页面, 数据流与控制
+func (d *SceneDashboard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/events"):
+		d.serveEvents(w, req)
+	case strings.HasSuffix(req.URL.Path, "/state"):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.GetState(0))
+	case strings.HasSuffix(req.URL.Path, "/control"):
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		robots, _ := strconv.Atoi(req.FormValue("robots"))
+		w.Header().Set("Content-Type", "application/json")
+		if err := d.Control(req.FormValue("action"), robots); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&clusterError{Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(d.GetState(0))
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, dashboardHtml)
+	}
+}
+
+// SSE数据流: 先发出全部采样点, 之后每个采样间隔发出新状态
+func (d *SceneDashboard) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultDashboardInterval
+	}
+	var (
+		t    = time.NewTicker(interval)
+		last int64
+	)
+	defer t.Stop()
+	for {
+		state := d.GetState(last)
+		if n := len(state.Points); n > 0 {
+			last = state.Points[n-1].Seq
+		}
+		b, _ := json.Marshal(state)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-req.Context().Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// 换算为毫秒
+func dashboardMs(v time.Duration) float64 {
+	return PubFloatRound(v.Seconds()*1000, 3)
+}
@@ -0,0 +1,107 @@
+package box
+
+// 实时网页: 无外部依赖, 以canvas绘制图表, 数据来自同目录下的events
+const dashboardHtml = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-box dashboard</title>
+<style>
+body{font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;margin:16px;color:#222;background:#fafafa}
+h1{font-size:20px;margin:0 0 8px}
+.bar{display:flex;flex-wrap:wrap;gap:16px;align-items:center;margin-bottom:12px}
+.kv{background:#fff;border:1px solid #ddd;border-radius:4px;padding:6px 10px}
+.kv b{display:block;font-size:18px}
+.status{padding:2px 8px;border-radius:4px;color:#fff;background:#2ca02c}
+.status.paused{background:#ff7f0e}.status.stopped,.status.fail{background:#d62728}.status.idle{background:#888}
+button{padding:6px 12px;margin-right:4px;cursor:pointer}
+input{width:80px;padding:5px}
+.charts{display:flex;flex-wrap:wrap;gap:12px}
+.chart{background:#fff;border:1px solid #ddd;border-radius:4px;padding:8px}
+.chart h3{font-size:13px;margin:0 0 4px}
+canvas{width:420px;height:180px}
+table{border-collapse:collapse;background:#fff;margin:8px 0 16px;font-size:13px}
+th,td{border:1px solid #ddd;padding:4px 8px;text-align:right}
+th:first-child,td:first-child,td.l{text-align:left}
+h2{font-size:15px;margin:16px 0 4px}
+</style>
+</head>
+<body>
+<h1 id="title">go-box</h1>
+<div class="bar">
+ <span id="status" class="status idle">idle</span>
+ <div class="kv">batch<b id="batch">-</b></div>
+ <div class="kv">robots<b id="robots">-</b></div>
+ <div class="kv">concurrency<b id="conc">-</b></div>
+ <div class="kv">elapsed<b id="elapsed">-</b></div>
+ <div>
+  <button onclick="control('pause')">Pause</button>
+  <button onclick="control('resume')">Resume</button>
+  <button onclick="if(confirm('Stop the run?'))control('stop')">Stop</button>
+  <input id="robotsInput" type="number" min="1" placeholder="robots">
+  <button onclick="control('rescale',document.getElementById('robotsInput').value)">Rescale</button>
+ </div>
+</div>
+<div class="charts">
+ <div class="chart"><h3>latency ms (p50 / p90 / p99)</h3><canvas id="cLatency" width="840" height="360"></canvas></div>
+ <div class="chart"><h3>throughput /s</h3><canvas id="cThroughput" width="840" height="360"></canvas></div>
+ <div class="chart"><h3>error rate %</h3><canvas id="cErrors" width="840" height="360"></canvas></div>
+</div>
+<h2>actions (current batch)</h2>
+<table id="actions"><tr><th>action</th><th>count</th><th>fail</th><th>skip</th><th>avg</th><th>p50</th><th>p90</th><th>p99</th><th>max</th></tr></table>
+<h2>recent errors</h2>
+<table id="errors"><tr><th>time</th><th>robot</th><th>action</th><th>class</th><th>error</th></tr></table>
+<h2>batches</h2>
+<table id="batches"><tr><th>batch</th><th>robots</th><th>status</th><th>run s</th><th>concurrency</th><th>fail %</th><th>avg ms</th><th>90% avg ms</th><th>error</th></tr></table>
+<script>
+var points=[],state=null,colors=["#1f77b4","#ff7f0e","#d62728"];
+function esc(s){return String(s==null?"":s).replace(/[&<>"]/g,function(c){return{"&":"&amp;","<":"&lt;",">":"&gt;","\"":"&quot;"}[c]})}
+function fmt(v){return v==null?"-":(Math.round(v*1000)/1000)}
+function draw(id,series){
+ var c=document.getElementById(id),g=c.getContext("2d"),W=c.width,H=c.height,L=70,B=30,T=10,R=10;
+ g.clearRect(0,0,W,H);g.font="20px sans-serif";g.strokeStyle="#ccc";g.fillStyle="#666";
+ var max=0;series.forEach(function(s){s.values.forEach(function(v){if(v>max)max=v})});
+ if(max<=0)max=1;
+ for(var i=0;i<=4;i++){var y=T+(H-T-B)*i/4;g.beginPath();g.moveTo(L,y);g.lineTo(W-R,y);g.stroke();g.fillText(fmt(max*(4-i)/4),4,y+6)}
+ var n=points.length;if(n<2)return;
+ g.fillText(new Date(points[0].time).toLocaleTimeString(),L,H-4);
+ var t=new Date(points[n-1].time).toLocaleTimeString();g.fillText(t,W-R-g.measureText(t).width,H-4);
+ series.forEach(function(s,k){g.strokeStyle=colors[k%colors.length];g.lineWidth=2;g.beginPath();
+  s.values.forEach(function(v,i){var x=L+(W-L-R)*i/(n-1),y=T+(H-T-B)*(1-v/max);if(i)g.lineTo(x,y);else g.moveTo(x,y)});g.stroke()});
+ g.lineWidth=1;
+}
+function render(){
+ if(!state)return;
+ document.getElementById("title").textContent="go-box "+state.scene+" ("+state.category+")";
+ var st=document.getElementById("status"),txt="running",cls="status";
+ if(state.stopped){txt="stopped "+state.reason;cls+=" stopped"}else if(state.paused){txt="paused";cls+=" paused"}else if(!state.running){txt="finished";cls+=" idle"}
+ st.textContent=txt;st.className=cls;
+ document.getElementById("batch").textContent=state.batch+"/"+state.batchMax;
+ document.getElementById("robots").textContent=state.robots;
+ document.getElementById("conc").textContent=state.concurrency;
+ var el="-";if(state.timeStart&&state.timeStart.indexOf("0001")!==0){el=Math.round((Date.now()-new Date(state.timeStart))/1000)+"s"}
+ document.getElementById("elapsed").textContent=state.running?el:"-";
+ draw("cLatency",[{values:points.map(function(p){return p.p50})},{values:points.map(function(p){return p.p90})},{values:points.map(function(p){return p.p99})}]);
+ draw("cThroughput",[{values:points.map(function(p){return p.throughput})}]);
+ draw("cErrors",[{values:points.map(function(p){return p.errorRate*100})}]);
+ var h='<tr><th>action</th><th>count</th><th>fail</th><th>skip</th><th>avg</th><th>p50</th><th>p90</th><th>p99</th><th>max</th></tr>';
+ (state.actions||[]).forEach(function(a){h+="<tr><td>"+esc(a.name)+"</td><td>"+a.count+"</td><td>"+a.fail+"</td><td>"+a.skip+"</td><td>"+fmt(a.avg)+"</td><td>"+fmt(a.p50)+"</td><td>"+fmt(a.p90)+"</td><td>"+fmt(a.p99)+"</td><td>"+fmt(a.max)+"</td></tr>"});
+ document.getElementById("actions").innerHTML=h;
+ h='<tr><th>time</th><th>robot</th><th>action</th><th>class</th><th>error</th></tr>';
+ (state.errors||[]).forEach(function(e){h+="<tr><td>"+new Date(e.time).toLocaleTimeString()+"</td><td class=l>"+esc(e.robot)+"</td><td class=l>"+esc(e.action)+"</td><td class=l>"+esc(e["class"])+"</td><td class=l>"+esc(e.error)+"</td></tr>"});
+ document.getElementById("errors").innerHTML=h;
+ h='<tr><th>batch</th><th>robots</th><th>status</th><th>run s</th><th>concurrency</th><th>fail %</th><th>avg ms</th><th>90% avg ms</th><th>error</th></tr>';
+ (state.batches||[]).slice().reverse().forEach(function(b){h+="<tr><td>"+b.batch+"</td><td>"+b.batchRobot+"</td><td>"+b.status+"</td><td>"+fmt(b.timeRun/1e9)+"</td><td>"+b.concurrency+"</td><td>"+fmt(b.failRate*100)+"</td><td>"+fmt(b.perfTimeAvg/1e6)+"</td><td>"+fmt(b.perfTime90Avg/1e6)+"</td><td class=l>"+esc(b.reason||b.errText)+"</td></tr>"});
+ document.getElementById("batches").innerHTML=h;
+}
+function control(action,robots){
+ var body="action="+encodeURIComponent(action)+(robots?"&robots="+encodeURIComponent(robots):"");
+ fetch("control",{method:"POST",headers:{"Content-Type":"application/x-www-form-urlencoded"},body:body})
+  .then(function(r){return r.json()}).then(function(v){if(v.error)alert(v.error);else{state=v;render()}});
+}
+var es=new EventSource("events");
+es.onmessage=function(e){var v=JSON.parse(e.data);points=points.concat(v.points||[]);if(points.length>3600)points=points.slice(points.length-3600);state=v;render()};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,184 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试实时网页的状态, 数据流与暂停/调整/停止控制
+func Test_SceneDashboard(t *testing.T) {
+	as := require.New(t)
+	var (
+		dashboard *SceneDashboard
+		svr       *httptest.Server
+		control   = func(action string, robots int) (code int, state *DashboardState) {
+			resp, err := http.PostForm(svr.URL+"/control", url.Values{
+				"action": {action},
+				"robots": {fmt.Sprint(robots)},
+			})
+			as.Nil(err)
+			defer resp.Body.Close()
+			state = &DashboardState{}
+			json.NewDecoder(resp.Body).Decode(state)
+			return resp.StatusCode, state
+		}
+		during  *DashboardState
+		resumed time.Time
+	)
+
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			time.Sleep(time.Millisecond * 5)
+			if u.Serial == 1 {
+				err = fmt.Errorf("robot 1")
+			}
+			if u.Serial != 0 {
+				return
+			}
+			switch batch {
+			case 0:
+				// 暂停后其它机器人等待, 恢复后继续
+				_, state := control("pause", 0)
+				as.True(state.Paused)
+				resumed = time.Now().Add(time.Millisecond * 100)
+				go func() {
+					time.Sleep(time.Millisecond * 100)
+					control("resume", 0)
+				}()
+				code, _ := control("rescale", 5)
+				as.Equal(http.StatusOK, code)
+			case 1:
+				resp, _err := http.Get(svr.URL + "/state")
+				as.Nil(_err)
+				during = &DashboardState{}
+				json.NewDecoder(resp.Body).Decode(during)
+				resp.Body.Close()
+				control("stop", 0)
+			}
+			return
+		},
+	})))
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "home"})))
+	scene := NewScene(&Scene{Name: "dashboard", DefaultRobot: robot})
+	scene.Log.SetLevel(2)
+	dashboard = NewSceneDashboard(scene)
+	dashboard.Interval = time.Millisecond * 20
+	svr = httptest.NewServer(dashboard)
+	defer svr.Close()
+
+	data, err := scene.RunCapacity(&FormCapacity{NumInit: 3, NumStep: 1, BatchMax: 10, PeriodAction: 10, FailFast: true}, nil)
+	as.Nil(err)
+
+	// 暂停与调整
+	as.Len(data, 2)
+	as.Equal(3, data[0].BatchRobot)
+	as.Equal(SceneStatusNormal, data[0].Status)
+	as.False(data[0].TimeEnd.Before(resumed))
+	as.Equal(5, data[1].BatchRobot)
+
+	// 停止
+	as.Equal(SceneStatusStop, data[1].Status)
+	as.Equal("stopped from dashboard", data[1].Reason)
+	as.True(scene.IsStopped())
+
+	// 执行中的状态
+	as.NotNil(during)
+	as.True(during.Running)
+	as.Equal(2, during.Batch)
+	as.Equal(5, during.Robots)
+	as.Equal("dashboard", during.Scene)
+	as.Equal(SceneCateCapacity, during.Category)
+	as.Len(during.Batches, 1)
+
+	// 数据流: 首条包含全部采样点
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	req, _ := http.NewRequest("GET", svr.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	as.Nil(err)
+	defer resp.Body.Close()
+	as.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	as.Nil(err)
+	as.True(strings.HasPrefix(line, "data: "))
+	state := &DashboardState{}
+	as.Nil(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), state))
+	as.False(state.Running)
+	as.True(state.Stopped)
+	as.Len(state.Batches, 2)
+	as.NotEmpty(state.Points)
+	as.EqualValues(0, state.Concurrency)
+	as.Len(state.Actions, 2)
+	as.Equal("login", state.Actions[0].Name)
+	as.Equal(5, state.Actions[0].Count+state.Actions[0].Skip)
+	as.True(state.Actions[0].P50 >= 5)
+	as.True(state.Actions[1].Skip >= 1)
+	as.NotEmpty(state.Errors)
+	as.Equal("robot 1", state.Errors[0].Error)
+
+	// 错误的控制
+	code, _ := control("rescale", 0)
+	as.Equal(http.StatusBadRequest, code)
+	code, _ = control("unknown", 0)
+	as.Equal(http.StatusBadRequest, code)
+
+	// 轮间停止: 不再开始新的一轮, 最后一轮以停止状态替换
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "login"})))
+	scene = NewScene(&Scene{Name: "dashboard", DefaultRobot: robot})
+	scene.Log.SetLevel(2)
+	dashboard = NewSceneDashboard(scene)
+	svr2 := httptest.NewServer(dashboard)
+	defer svr2.Close()
+	var (
+		cache    = make(chan *ResultScene)
+		received []*ResultScene
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range cache {
+			if len(received) == 0 {
+				resp, _err := http.PostForm(svr2.URL+"/control", url.Values{"action": {"stop"}})
+				as.Nil(_err)
+				resp.Body.Close()
+			}
+			received = append(received, r)
+		}
+	}()
+	data, err = scene.RunCapacity(&FormCapacity{NumInit: 3, NumStep: 1, BatchMax: 5, PeriodScene: 500}, cache)
+	as.Nil(err)
+	close(cache)
+	wg.Wait()
+	as.Len(data, 1)
+	as.Equal(SceneStatusStop, data[0].Status)
+	as.Equal("stopped from dashboard", data[0].Reason)
+	as.Zero(data[0].FailRate)
+	as.Len(received, 2)
+	as.Equal(1, received[1].Batch)
+	state = dashboard.GetState(0)
+	as.Len(state.Batches, 1)
+	as.Equal(SceneStatusStop, state.Batches[0].Status)
+
+	// 页面
+	resp2, err := http.Get(svr.URL + "/")
+	as.Nil(err)
+	body, _ := ioutil.ReadAll(resp2.Body)
+	resp2.Body.Close()
+	as.Contains(string(body), `new EventSource("events")`)
+}
@@ -0,0 +1,156 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试默认错误分类
+func Test_ErrorClass(t *testing.T) {
+	as := require.New(t)
+
+	// 连接被拒绝: 监听后关闭的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	as.Nil(err)
+	addr := ln.Addr().String()
+	as.Nil(ln.Close())
+	_, errRefused := net.DialTimeout("tcp", addr, time.Second)
+	as.NotNil(errRefused)
+
+	// tls握手失败: 自签名证书
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, errTls := http.Get(srv.URL)
+	as.NotNil(errTls)
+
+	// 超时
+	client := &http.Client{Timeout: time.Millisecond * 10}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	}))
+	defer slow.Close()
+	_, errTimeout := client.Get(slow.URL)
+	as.NotNil(errTimeout)
+
+	for _, c := range []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{errRefused, ErrorClassConnRefused},
+		{errTls, ErrorClassTls},
+		{errTimeout, ErrorClassTimeout},
+		{&net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}, ErrorClassDns},
+		{tls.RecordHeaderError{Msg: "bad"}, ErrorClassTls},
+		{fmt.Errorf("read: %w", io.EOF), ErrorClassConnReset},
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{context.Canceled, ErrorClassCanceled},
+		{&ErrorHttpStatus{StatusCode: 503}, ErrorClassHttp5xx},
+		{&ErrorHttpStatus{StatusCode: 404}, ErrorClassHttp4xx},
+		{fmt.Errorf("check: %w", NewErrorAssert("path %s not found", "a")), ErrorClassAssert},
+		{&ErrorPanic{Value: "boom"}, ErrorClassPanic},
+		{NewActionError(ActionStatusFreeze, errors.New("slow")), ErrorClassTimeout},
+		{errors.New("other"), ErrorClassOther},
+		// 只剩文本
+		{errors.New("dial tcp 127.0.0.1:1: connect: connection refused"), ErrorClassConnRefused},
+		{errors.New("panic: boom"), ErrorClassPanic},
+	} {
+		as.Equal(c.class, GetErrorClass(c.err), fmt.Sprint(c.err))
+	}
+
+	// 自定义分类优先, 返回空时使用默认分类
+	scene := NewScene(&Scene{ErrorClassifier: func(err error) string {
+		if err.Error() == "quota" {
+			return "quota"
+		}
+		return ""
+	}})
+	as.Equal("quota", scene.GetErrorClass(errors.New("quota")))
+	as.Equal(ErrorClassAssert, scene.GetErrorClass(NewErrorAssert("x")))
+	as.Equal("", scene.GetErrorClass(nil))
+}
+
+// 测试每轮按分类与动作的错误计数, 及最多的错误文本
+func Test_ErrorTop(t *testing.T) {
+	as := require.New(t)
+	for _, streaming := range []bool{false, true} {
+		robot := NewRobot(&Robot{Name: "robot"})
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "login",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				switch u.Serial % 4 {
+				case 1:
+					err = NewErrorAssert("token not found")
+				case 2:
+					panic("boom")
+				}
+				return
+			},
+		})))
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "home",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				if u.Serial%4 == 3 {
+					err = fmt.Errorf("quota %d", u.Serial%8)
+				}
+				return
+			},
+		})))
+		scene := NewScene(&Scene{Name: "error", DefaultRobot: robot, Streaming: streaming, ErrorClassifier: func(err error) string {
+			if strings.HasPrefix(err.Error(), "quota ") {
+				return "quota"
+			}
+			return ""
+		}})
+		scene.Log.SetLevel(1)
+		data, err := scene.RunSurge(&FormSurge{NumInit: 40, BatchMax: 1}, nil)
+		as.Nil(err)
+		as.Len(data, 1)
+		d := data[0]
+
+		// 分类计数
+		as.Equal(map[string]int{ErrorClassAssert: 10, ErrorClassPanic: 10, "quota": 10}, d.ErrorClass, streaming)
+		as.Equal(map[string]int{ErrorClassAssert: 10, ErrorClassPanic: 10}, d.ActionArray[0].ErrorClass)
+		as.Equal(map[string]int{"quota": 10}, d.ActionArray[1].ErrorClass)
+
+		// 最多的错误文本
+		as.Len(d.ErrorTop, 4)
+		for i, e := range d.ErrorTop {
+			if i < 2 {
+				as.Equal(10, e.Count)
+				as.Equal("login", e.Action)
+				as.Contains([]string{"token not found", "panic: boom"}, e.Text)
+			} else {
+				as.Equal(5, e.Count)
+				as.Equal("home", e.Action)
+				as.Equal("quota", e.Class)
+				as.Contains([]string{"quota 3", "quota 7"}, e.Text)
+			}
+			as.False(e.TimeFirst.IsZero())
+			as.False(e.TimeLast.Before(e.TimeFirst))
+		}
+	}
+
+	// 超出数量时截断
+	errs := map[string]*ResultError{}
+	now := time.Now()
+	for i := 0; i < DefaultErrorTop+5; i++ {
+		r := &RobotActionResult{Error: fmt.Errorf("e%d", i), TimeFinish: now.Add(time.Duration(i))}
+		addResultError(errs, "a", resultErrorClass(r), r)
+	}
+	top := topResultErrors(errs, DefaultErrorTop)
+	as.Len(top, DefaultErrorTop)
+	as.Equal("e0", top[0].Text)
+	as.Equal(ErrorClassOther, top[0].Class)
+}
@@ -9,44 +9,77 @@ import (
 // 测试参数
 type FormScene struct {
 	// 测试类型
-	Category string // capacity|surge|stable
+	Category string `json:"category" yaml:"category"` // capacity|surge|stable
 	// 测试参数
-	FailBreak    bool    // true:容量测试时,接口无法正确返回时即退出测试 false:接口错误仍继续执行到期望的最大周期。【默认true】
-	FailFast     bool    // 仅对测试单元执行接口数大于1时起作用。true:遇错停止执行本单元的余下接口调用 false:遇错仍继续执行本单元余下接口调用，不管余下调用是否成功，本单元均标记为失败。【默认true】
-	FailPerf     float32 // 设置数值大于0有效。如设为0.7，代表容量测试第N轮的TPS比N-1轮TPS少70%及以上，则退出容量测试。【默认0】
-	BatchMax     int     // 容量测试最大执行轮数理论值，实际执行会受FailBreak、FailPerf参数影响。【默认100】
-	NumInit      int     // 容量测试初始机器人数。【默认100】
-	NumStep      int     // 容量测试机器人递增数。【默认100】
-	PeriodAction int64   // 容量测试的"接口调用周期"参数，单位毫秒。【默认4000】
-	PeriodScene  int64   // 容量测试中一个场景(Scene)的时间跨度理论值，实际执行会受场景中调用最慢的一次接口影响，单位毫秒。【默认10000】
+	FailBreak    bool    `json:"failBreak" yaml:"failBreak"`       // true:容量测试时,接口无法正确返回时即退出测试 false:接口错误仍继续执行到期望的最大周期。【默认true】
+	FailFast     bool    `json:"failFast" yaml:"failFast"`         // 仅对测试单元执行接口数大于1时起作用。true:遇错停止执行本单元的余下接口调用 false:遇错仍继续执行本单元余下接口调用，不管余下调用是否成功，本单元均标记为失败。【默认true】
+	FailPerf     float32 `json:"failPerf" yaml:"failPerf"`         // 设置数值大于0有效。如设为0.7，代表容量测试第N轮的TPS比N-1轮TPS少70%及以上，则退出容量测试。【默认0】
+	BatchMax     int     `json:"batchMax" yaml:"batchMax"`         // 容量测试最大执行轮数理论值，实际执行会受FailBreak、FailPerf参数影响。【默认100】
+	NumInit      int     `json:"numInit" yaml:"numInit"`           // 容量测试初始机器人数。【默认100】
+	NumStep      int     `json:"numStep" yaml:"numStep"`           // 容量测试机器人递增数。【默认100】
+	PeriodAction int64   `json:"periodAction" yaml:"periodAction"` // 容量测试的"接口调用周期"参数，单位毫秒。【默认4000】
+	PeriodScene  int64   `json:"periodScene" yaml:"periodScene"`   // 容量测试中一个场景(Scene)的时间跨度理论值，实际执行会受场景中调用最慢的一次接口影响，单位毫秒。【默认10000】
 }
 
 // 容量测试
 type FormCapacity struct {
-	FailBreak    bool    //
-	FailFast     bool    //
-	FailPerf     float32 //
-	BatchMax     int     //
-	NumInit      int     //
-	NumStep      int     //
-	PeriodAction int64   //
-	PeriodScene  int64   //
+	FailBreak    bool    `json:"failBreak" yaml:"failBreak"`       //
+	FailFast     bool    `json:"failFast" yaml:"failFast"`         //
+	FailPerf     float32 `json:"failPerf" yaml:"failPerf"`         //
+	BatchMax     int     `json:"batchMax" yaml:"batchMax"`         //
+	NumInit      int     `json:"numInit" yaml:"numInit"`           //
+	NumStep      int     `json:"numStep" yaml:"numStep"`           //
+	PeriodAction int64   `json:"periodAction" yaml:"periodAction"` //
+	PeriodScene  int64   `json:"periodScene" yaml:"periodScene"`   //
 }
 
 // 浪涌测试
 type FormSurge struct {
-	BatchMax    int   //
-	NumInit     int   //
-	PeriodScene int64 //
+	BatchMax    int   `json:"batchMax" yaml:"batchMax"`       //
+	NumInit     int   `json:"numInit" yaml:"numInit"`         //
+	PeriodScene int64 `json:"periodScene" yaml:"periodScene"` //
 }
 
 // 稳定性测试
 type FormStable struct {
-	NumInit      int   //
-	PeriodAction int64 //
-	PeriodScene  int64 //
+	NumInit      int   `json:"numInit" yaml:"numInit"`           //
+	PeriodAction int64 `json:"periodAction" yaml:"periodAction"` //
+	PeriodScene  int64 `json:"periodScene" yaml:"periodScene"`   //
 	//
-	Duration int // 持续时间,单位秒
+	Duration int `json:"duration" yaml:"duration"` // 持续时间,单位秒
+}
+
+// 日志回放: 按日志中的相对时间发出请求
+type FormReplay struct {
+	Path        string  `json:"path" yaml:"path"`               // 日志文件
+	Format      string  `json:"format" yaml:"format"`           // combined|jsonl, 为空时按首行自动识别
+	Speed       float64 `json:"speed" yaml:"speed"`             // 回放倍速, 如2为两倍速。【默认1】
+	Robots      int     `json:"robots" yaml:"robots"`           // 机器人池大小, 即最大并发。【默认100】
+	PeriodScene int64   `json:"periodScene" yaml:"periodScene"` // 按日志时间每多少毫秒统计为一轮, 单位毫秒, 0:全部为一轮
+	BatchMax    int     `json:"batchMax" yaml:"batchMax"`       // 最多回放轮数, 0:不限
+	FailBreak   bool    `json:"failBreak" yaml:"failBreak"`     // true: 出现错误即停止回放
+	//
+	Records []*ReplayRecord `json:"-" yaml:"-"` // 直接指定要回放的请求, 设置后忽略Path
+}
+
+// 对比参数: 超出容许范围且统计显著的变化视为退化
+type FormCompare struct {
+	Latency    float64 `json:"latency" yaml:"latency"`       // 耗时容许的增幅, 如0.1为10%【默认0.1】
+	Throughput float64 `json:"throughput" yaml:"throughput"` // 吞吐容许的降幅【默认0.1】
+	FailRate   float64 `json:"failRate" yaml:"failRate"`     // 错误率容许增加的绝对值, 如0.01为1个百分点【默认0.01】
+	Capacity   float64 `json:"capacity" yaml:"capacity"`     // 容量上限容许的降幅, 0:不容许下降
+	Alpha      float64 `json:"alpha" yaml:"alpha"`           // 显著性水平, p值小于此值才视为退化【默认0.05】
+}
+
+// 离线分析参数: 由样本文件重新统计
+type FormAnalyze struct {
+	Window      int64     `json:"window" yaml:"window"`           // 按开始时间每多少毫秒统计为一轮, 0:按原轮次统计
+	From        int64     `json:"from" yaml:"from"`               // 只统计首个样本后多少毫秒起开始的执行单元
+	To          int64     `json:"to" yaml:"to"`                   // 只统计首个样本后多少毫秒前开始的执行单元, 0:不限
+	Batches     []int     `json:"batches" yaml:"batches"`         // 只统计这些轮次, 1起始
+	Actions     []string  `json:"actions" yaml:"actions"`         // 只统计这些动作
+	Robots      []string  `json:"robots" yaml:"robots"`           // 只统计这些机器人
+	Percentiles []float64 `json:"percentiles" yaml:"percentiles"` // 额外计算的耗时百分位, 如99.9, 结果见ResultCapacityAction.TimeCustom
 }
 
 //
@@ -144,3 +177,88 @@ func (d *FormStable) GetForm() (ret *FormScene, err error) {
 	ret.PeriodScene = d.PeriodScene
 	return
 }
+
+//
+func (d *FormReplay) Valid() (err error) {
+	if d == nil {
+		return contrib.ErrParamUndefined
+	}
+	if len(d.Path) == 0 && len(d.Records) == 0 {
+		return contrib.ErrParamInvalid.SetVars("path")
+	}
+	if d.Speed < 0 {
+		return contrib.ErrParamInvalid.SetVars("speed")
+	}
+	return
+}
+
+//
+func (d *FormReplay) GetForm() (ret *FormScene, err error) {
+	if err = d.Valid(); err != nil {
+		return
+	}
+	ret = new(FormScene)
+	ret.Category = SceneCateReplay
+	ret.FailBreak = d.FailBreak
+	ret.FailFast = true
+	ret.FailPerf = 0
+	ret.BatchMax = d.BatchMax
+	ret.NumInit = d.Robots
+	if ret.NumInit <= 0 {
+		ret.NumInit = DefaultSceneReplayRobots
+	}
+	ret.NumStep = 0
+	ret.PeriodAction = 0
+	ret.PeriodScene = d.PeriodScene
+	return
+}
+
+// 取回放倍速
+func (d *FormReplay) GetSpeed() float64 {
+	if d.Speed <= 0 {
+		return 1
+	}
+	return d.Speed
+}
+
+//
+func (d *FormAnalyze) Valid() (err error) {
+	if d == nil {
+		return contrib.ErrParamUndefined
+	}
+	if d.Window < 0 {
+		return contrib.ErrParamInvalid.SetVars("window")
+	}
+	if d.From < 0 || d.To < 0 || (d.To > 0 && d.To <= d.From) {
+		return contrib.ErrParamInvalid.SetVars("from/to")
+	}
+	for _, p := range d.Percentiles {
+		if p <= 0 || p > 100 {
+			return contrib.ErrParamInvalid.SetVars("percentiles")
+		}
+	}
+	return
+}
+
+//
+func (d *FormCompare) Valid() (err error) {
+	if d == nil {
+		return contrib.ErrParamUndefined
+	}
+	if d.Latency < 0 {
+		return contrib.ErrParamInvalid.SetVars("latency")
+	}
+	if d.Throughput < 0 || d.Throughput >= 1 {
+		return contrib.ErrParamInvalid.SetVars("throughput")
+	}
+	if d.FailRate < 0 || d.FailRate >= 1 {
+		return contrib.ErrParamInvalid.SetVars("failRate")
+	}
+	if d.Capacity < 0 || d.Capacity >= 1 {
+		return contrib.ErrParamInvalid.SetVars("capacity")
+	}
+	if d.Alpha < 0 || d.Alpha >= 1 {
+		return contrib.ErrParamInvalid.SetVars("alpha")
+	}
+	return
+}
@@ -0,0 +1,41 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultGeneratorCpuRate  = 0.9                    // 进程CPU占可用核的比例达到时视为压测机瓶颈
+	DefaultGeneratorLag      = time.Millisecond * 100 // 机器人实际起始晚于计划达到时视为压测机瓶颈
+	DefaultGeneratorInterval = time.Millisecond * 100 // 执行中采样协程数与堆内存峰值的间隔
+)
+
+// 压测机自身的状态: 每轮取自runtime与/proc, 压测机饱和时耗时偏大, 不应归咎于被测服务
+type ResultGenerator struct {
+	Cpu        float64       `json:"cpu"`        // 本轮进程CPU使用, 1为一个核满载; 取不到时为0
+	CpuRate    float64       `json:"cpuRate"`    // 按GOMAXPROCS折算的CPU使用率, 0~1
+	Goroutines int           `json:"goroutines"` // 协程数峰值
+	HeapAlloc  uint64        `json:"heapAlloc"`  // 堆内存峰值
+	Rss        int64         `json:"rss"`        // 本轮结束时的常驻内存, 取自/proc; 取不到时为0
+	GcNum      uint32        `json:"gcNum"`      // 本轮GC次数
+	GcPause    time.Duration `json:"gcPause"`    // 本轮GC暂停总时长
+	LagMax     time.Duration `json:"lagMax"`     // 机器人实际起始晚于计划的最大时间
+	Bound      bool          `json:"bound"`      // true: 压测机成为瓶颈, 本轮耗时可能偏大
+	BoundText  string        `json:"boundText"`  // 成为瓶颈的原因
+}
+
+// 一轮的压测机监控
+type generatorMonitor struct {
+	lagMax     int64         // 最大调度延迟, 原子操作
+	goroutines int           // 协程数峰值
+	heapAlloc  uint64        // 堆内存峰值
+	cpu        time.Duration // 开始时进程CPU时间
+	cpuOk      bool          // 取到了CPU时间
+	wall       time.Time     // 开始时间
+	gcNum      uint32        // 开始时GC次数
+	gcPause    uint64        // 开始时GC暂停总时长
+	stop       chan struct{} // 停止采样
+	lock       sync.Mutex    //
+}
@@ -0,0 +1,196 @@
+package box
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 开始一轮的监控: 记录起点并按间隔采样峰值
+func (d *generatorMonitor) begin() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	atomic.StoreInt64(&d.lagMax, 0)
+	d.goroutines = runtime.NumGoroutine()
+	d.heapAlloc = m.HeapAlloc
+	d.cpu, d.cpuOk = procCpuTime()
+	d.wall = time.Now()
+	d.gcNum = m.NumGC
+	d.gcPause = m.PauseTotalNs
+	if d.stop == nil {
+		d.stop = make(chan struct{})
+		go d.loop(d.stop)
+	}
+}
+
+// 记录一个机器人的调度延迟, 机器人协程中调用
+func (d *generatorMonitor) addLag(lag time.Duration) {
+	for {
+		old := atomic.LoadInt64(&d.lagMax)
+		if int64(lag) <= old || atomic.CompareAndSwapInt64(&d.lagMax, old, int64(lag)) {
+			return
+		}
+	}
+}
+
+// 结束一轮的监控, 取本轮统计并判断是否成为瓶颈
+func (d *generatorMonitor) end() (ret *ResultGenerator) {
+	d.sample()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	ret = &ResultGenerator{
+		Goroutines: d.goroutines,
+		HeapAlloc:  d.heapAlloc,
+		Rss:        procRss(),
+		GcNum:      m.NumGC - d.gcNum,
+		GcPause:    time.Duration(m.PauseTotalNs - d.gcPause),
+		LagMax:     time.Duration(atomic.LoadInt64(&d.lagMax)),
+	}
+	if cpu, ok := procCpuTime(); ok && d.cpuOk {
+		if wall := time.Since(d.wall); wall > 0 {
+			ret.Cpu = PubFloatRound(float64(cpu-d.cpu)/float64(wall), 4)
+			ret.CpuRate = PubFloatRound(ret.Cpu/float64(runtime.GOMAXPROCS(0)), 4)
+		}
+	}
+	ret.check()
+	return
+}
+
+// 按间隔采样峰值
+func (d *generatorMonitor) loop(stop chan struct{}) {
+	t := time.NewTicker(DefaultGeneratorInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			d.sample()
+		}
+	}
+}
+
+// 采样协程数与堆内存
+func (d *generatorMonitor) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	n := runtime.NumGoroutine()
+	d.lock.Lock()
+	if n > d.goroutines {
+		d.goroutines = n
+	}
+	if m.HeapAlloc > d.heapAlloc {
+		d.heapAlloc = m.HeapAlloc
+	}
+	d.lock.Unlock()
+}
+
+// 按阀值判断压测机是否成为瓶颈
+func (d *ResultGenerator) check() {
+	var text []string
+	if d.CpuRate >= DefaultGeneratorCpuRate {
+		text = append(text, fmt.Sprintf(`cpu %.0f%%`, d.CpuRate*100))
+	}
+	if d.LagMax >= DefaultGeneratorLag {
+		text = append(text, fmt.Sprintf(`lag %s`, d.LagMax))
+	}
+	d.Bound = len(text) > 0
+	d.BoundText = strings.Join(text, ", ")
+}
+
+// 合并各节点的状态: 各项取最大, 任一节点成为瓶颈即为瓶颈
+func (d *ResultGenerator) merge(worker string, o *ResultGenerator) {
+	if o == nil {
+		return
+	}
+	if o.Cpu > d.Cpu {
+		d.Cpu = o.Cpu
+	}
+	if o.CpuRate > d.CpuRate {
+		d.CpuRate = o.CpuRate
+	}
+	if o.Goroutines > d.Goroutines {
+		d.Goroutines = o.Goroutines
+	}
+	if o.HeapAlloc > d.HeapAlloc {
+		d.HeapAlloc = o.HeapAlloc
+	}
+	if o.Rss > d.Rss {
+		d.Rss = o.Rss
+	}
+	if o.GcNum > d.GcNum {
+		d.GcNum = o.GcNum
+	}
+	if o.GcPause > d.GcPause {
+		d.GcPause = o.GcPause
+	}
+	if o.LagMax > d.LagMax {
+		d.LagMax = o.LagMax
+	}
+	if o.Bound {
+		text := o.BoundText
+		if len(worker) > 0 {
+			text = worker + " " + text
+		}
+		if d.Bound {
+			d.BoundText += "; " + text
+		} else {
+			d.BoundText = text
+		}
+		d.Bound = true
+	}
+}
+
+// 进程CPU时间, 取自/proc/self/stat, 按每秒100个时钟周期换算
+func procCpuTime() (ret time.Duration, ok bool) {
+	b, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return
+	}
+	// 进程名可能含空格, 从最后一个括号之后取: state为第3项, utime与stime为第14,15项
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 13 {
+		return
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	return time.Duration(utime+stime) * time.Second / 100, true
+}
+
+// 进程常驻内存, 取自/proc/self/statm; 取不到时为0
+func procRss() int64 {
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
@@ -0,0 +1,73 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 测试压测机监控: 每轮记录CPU,协程,GC与内存, 超出阀值时标记为瓶颈
+func Test_Generator(t *testing.T) {
+	as := require.New(t)
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "spin",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			// 占用CPU
+			for start := time.Now(); time.Since(start) < time.Millisecond*200; {
+				ret = make([]byte, 1024)
+			}
+			return
+		},
+	})))
+	scene := NewScene(&Scene{Name: "generator", DefaultRobot: robot})
+	scene.Log.SetLevel(1)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 2, BatchMax: 1}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+	g := data[0].Generator
+	as.NotNil(g)
+	as.True(g.Goroutines >= 2, g.Goroutines)
+	as.True(g.HeapAlloc > 0)
+	as.True(g.LagMax >= 0 && g.LagMax < time.Second, g.LagMax)
+	if runtime.GOOS == "linux" {
+		as.True(g.Cpu > 0.5, g.Cpu)
+		as.True(g.CpuRate > 0 && g.CpuRate <= g.Cpu)
+		as.True(g.Rss > 0)
+	}
+
+	// 阀值
+	g = &ResultGenerator{CpuRate: 0.95, LagMax: time.Millisecond * 150}
+	g.check()
+	as.True(g.Bound)
+	as.Equal("cpu 95%, lag 150ms", g.BoundText)
+	g = &ResultGenerator{CpuRate: 0.5, LagMax: time.Millisecond}
+	g.check()
+	as.False(g.Bound)
+	as.Empty(g.BoundText)
+	r := &ResultScene{Generator: &ResultGenerator{Bound: true, BoundText: "cpu 95%"}}
+	as.Contains(r.String(), " generator-bound:cpu 95%")
+
+	// 调度延迟取最大
+	var m generatorMonitor
+	m.begin()
+	m.addLag(time.Millisecond * 3)
+	m.addLag(time.Millisecond * 200)
+	m.addLag(time.Millisecond)
+	g = m.end()
+	as.Equal(time.Millisecond*200, g.LagMax)
+	as.True(g.Bound)
+	as.Equal("lag 200ms", g.BoundText)
+
+	// 合并各节点
+	all := &ResultGenerator{}
+	all.merge("h1:7001", &ResultGenerator{Cpu: 1.5, Goroutines: 10, Bound: true, BoundText: "cpu 95%"})
+	all.merge("h2:7001", &ResultGenerator{Cpu: 0.5, Goroutines: 20})
+	all.merge("h3:7001", nil)
+	as.Equal(1.5, all.Cpu)
+	as.Equal(20, all.Goroutines)
+	as.True(all.Bound)
+	as.Equal("h1:7001 cpu 95%", all.BoundText)
+}
@@ -1,10 +1,32 @@
 module github.com/suboat/go-box
 
-go 1.13
+go 1.21
 
 require (
+	github.com/gorilla/websocket v1.5.3
 	github.com/shopspring/decimal v0.0.0-20191009025716-f1972eb1d1f5
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.9.0
 	github.com/suboat/go-contrib v0.0.0-20191016053736-2c933feb3092
 	github.com/tudyzhb/yaml v2.2.2-0.20181009085833-11f656f39252+incompatible
+	google.golang.org/grpc v1.67.3
+	google.golang.org/protobuf v1.35.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/lestrrat-go/file-rotatelogs v2.2.0+incompatible // indirect
+	github.com/lestrrat-go/strftime v0.0.0-20190725011945-5c849dd2c51d // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rogpeppe/go-internal v1.10.0 // indirect
+	github.com/sirupsen/logrus v1.4.2 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+	gopkg.in/yaml.v2 v2.2.3 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,62 @@
+package box
+
+import (
+	"time"
+)
+
+// HAR文件(HTTP Archive), 仅包含导入需要的字段
+type Har struct {
+	Log HarLog `json:"log"`
+}
+type HarLog struct {
+	Entries []*HarEntry `json:"entries"`
+}
+type HarEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"` // 请求开始时间
+	Time            float64     `json:"time"`            // 请求总耗时,单位毫秒
+	Request         HarRequest  `json:"request"`         //
+	Response        HarResponse `json:"response"`        //
+}
+type HarRequest struct {
+	Method   string          `json:"method"`   //
+	Url      string          `json:"url"`      //
+	Headers  []*HarNameValue `json:"headers"`  //
+	PostData *HarPostData    `json:"postData"` //
+}
+type HarResponse struct {
+	Status  int             `json:"status"`  //
+	Headers []*HarNameValue `json:"headers"` //
+	Content HarContent      `json:"content"` //
+}
+type HarNameValue struct {
+	Name  string `json:"name"`  //
+	Value string `json:"value"` //
+}
+type HarPostData struct {
+	MimeType string `json:"mimeType"` //
+	Text     string `json:"text"`     //
+}
+type HarContent struct {
+	MimeType string `json:"mimeType"` //
+	Text     string `json:"text"`     //
+	Encoding string `json:"encoding"` // base64时Text为编码后的内容
+}
+
+// HAR导入参数
+type HarOption struct {
+	Name      string   // 计划名, 默认har
+	Hosts     []string // 只导入这些域名的请求, 为空时不限
+	Types     []string // 只导入返回类型包含这些文本的请求, 如json,html; 为空时跳过静态资源
+	ThinkMin  int64    // 小于该间隔(毫秒)的思考时间忽略, 默认100
+	NoExtract bool     // true: 不识别动态值
+}
+
+// 导入时识别出的动态值
+type harValue struct {
+	Value  string // 录制时的值
+	Name   string // 变量名, 首次引用时去重
+	Action int    // 来源动作位置
+	Kind   string // json|header|regexp
+	Path   string // json路径,头部名或正则
+	used   bool   // 已被后续请求引用
+}
@@ -0,0 +1,409 @@
+package box
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// 像令牌的值: 足够长且不含空白
+	regHarToken = regexp.MustCompile(`^[A-Za-z0-9\-_.~+/=:]{8,}$`)
+	// html中的隐藏字段, 如csrf
+	regHarInput = regexp.MustCompile(`<input[^>]*?name="([^"]+)"[^>]*?value="([^"]*)"`)
+	// 变量名中的非法字符
+	regHarName = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	// 导入时忽略的请求头, 由http客户端自行处理
+	harHeaderSkip = map[string]bool{
+		"host": true, "content-length": true, "cookie": true, "connection": true,
+		"accept-encoding": true, "keep-alive": true, "te": true, "upgrade": true,
+	}
+	// 导入时忽略的返回头, 不作为动态值
+	harRespHeaderSkip = map[string]bool{
+		"date": true, "expires": true, "last-modified": true, "set-cookie": true, "etag": true,
+		"content-type": true, "content-length": true, "content-encoding": true, "cache-control": true,
+		"server": true, "vary": true, "age": true, "connection": true, "location": true,
+	}
+	// 默认跳过的静态资源类型
+	harStaticTypes = []string{"image/", "font/", "text/css", "javascript", "video/", "audio/"}
+)
+
+// 读取HAR文件并生成计划
+func LoadHar(harPath string, opt *HarOption) (ret *Plan, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(harPath); err != nil {
+		return
+	}
+	return ImportHar(b, opt)
+}
+
+// 由HAR内容生成计划: 每个请求一个http动作, 请求间隔作为思考时间, 动态值转为变量提取
+func ImportHar(b []byte, opt *HarOption) (ret *Plan, err error) {
+	var har Har
+	if err = json.Unmarshal(b, &har); err != nil {
+		return
+	}
+	if opt == nil {
+		opt = new(HarOption)
+	}
+	if len(opt.Name) == 0 {
+		opt.Name = "har"
+	}
+	if opt.ThinkMin == 0 {
+		opt.ThinkMin = 100
+	}
+	var (
+		entries []*HarEntry
+		actions []*ActionHttp
+		thinks  []int64
+		values  []*harValue
+		names   = map[string]bool{}
+	)
+	for _, e := range har.Log.Entries {
+		if harFilter(e, opt) {
+			entries = append(entries, e)
+		}
+	}
+
+	for i, e := range entries {
+		act := &ActionHttp{
+			Name:   fmt.Sprintf("%s %s", e.Request.Method, harPath(e.Request.Url)),
+			Method: e.Request.Method,
+			Url:    harEscape(e.Request.Url),
+			Header: map[string]string{},
+		}
+		for _, h := range e.Request.Headers {
+			if harHeaderSkip[strings.ToLower(h.Name)] || strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			act.Header[h.Name] = harEscape(h.Value)
+		}
+		if e.Request.PostData != nil {
+			act.Body = harEscape(e.Request.PostData.Text)
+		}
+		if e.Response.Status >= 400 {
+			act.Expect = []int{e.Response.Status}
+		}
+
+		// 引用之前识别的动态值, 长的优先替换
+		for _, v := range values {
+			found := strings.Contains(act.Url, v.Value) || strings.Contains(act.Body, v.Value)
+			for _, h := range act.Header {
+				found = found || strings.Contains(h, v.Value)
+			}
+			if !found {
+				continue
+			}
+			if !v.used {
+				// 首次引用时命名, 并在来源动作中提取
+				v.used = true
+				v.Name = harName(v.Name, names)
+				src := actions[v.Action]
+				switch v.Kind {
+				case "json":
+					if src.Extract == nil {
+						src.Extract = map[string]string{}
+					}
+					src.Extract[v.Name] = v.Path
+				case "header":
+					if src.ExtractHeader == nil {
+						src.ExtractHeader = map[string]string{}
+					}
+					src.ExtractHeader[v.Name] = v.Path
+				case "regexp":
+					if src.ExtractRegexp == nil {
+						src.ExtractRegexp = map[string]string{}
+					}
+					src.ExtractRegexp[v.Name] = v.Path
+				}
+			}
+			ref := fmt.Sprintf(`{{.Var.%s}}`, v.Name)
+			act.Url = strings.Replace(act.Url, v.Value, ref, -1)
+			act.Body = strings.Replace(act.Body, v.Value, ref, -1)
+			for k, h := range act.Header {
+				act.Header[k] = strings.Replace(h, v.Value, ref, -1)
+			}
+		}
+
+		// 思考时间: 距上个请求结束的间隔
+		var think int64
+		if i > 0 {
+			last := entries[i-1]
+			lastEnd := last.StartedDateTime.UnixNano()/1e6 + int64(last.Time)
+			if gap := e.StartedDateTime.UnixNano()/1e6 - lastEnd; gap >= opt.ThinkMin {
+				think = gap
+			}
+		}
+		actions = append(actions, act)
+		thinks = append(thinks, think)
+
+		// 识别返回中的动态值
+		if !opt.NoExtract {
+			values = append(values, harValues(e, i)...)
+			sort.SliceStable(values, func(a, b int) bool { return len(values[a].Value) > len(values[b].Value) })
+		}
+	}
+
+	// 生成计划
+	ret = &Plan{
+		Name:     opt.Name,
+		Category: SceneCateCapacity,
+		Capacity: &FormCapacity{NumInit: 1, BatchMax: 1},
+		Robot:    &PlanRobot{Name: opt.Name},
+	}
+	for i, act := range actions {
+		var params map[string]interface{}
+		if params, err = harParams(act); err != nil {
+			return
+		}
+		ret.Robot.Actions = append(ret.Robot.Actions, &PlanAction{
+			Name:   act.Name,
+			Type:   PlanActionHttp,
+			Think:  thinks[i],
+			Params: params,
+		})
+	}
+	return
+}
+
+// 将计划中的http动作生成Go代码, 返回函数NewRobot
+func PlanToGo(plan *Plan, pkg string) (ret []byte, err error) {
+	if plan == nil || plan.Robot == nil {
+		return nil, fmt.Errorf(`plan robot undefined`)
+	}
+	if len(pkg) == 0 {
+		pkg = "main"
+	}
+	var (
+		buf   bytes.Buffer
+		think bool
+	)
+	for _, a := range plan.Robot.Actions {
+		think = think || a.Think > 0
+	}
+	fmt.Fprintf(&buf, "// Code generated by gobox har; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import (\n\"github.com/suboat/go-box\"\n")
+	if think {
+		fmt.Fprintf(&buf, "\n\"time\"\n")
+	}
+	fmt.Fprintf(&buf, ")\n\n// 由计划%s生成的机器人\nfunc NewRobot() (ret *box.Robot, err error) {\n", strconv.Quote(plan.Name))
+	fmt.Fprintf(&buf, "ret = box.NewRobot(&box.Robot{Name: %q})\nvar act *box.ActionHttp\n", plan.Robot.Name)
+	for i, a := range plan.Robot.Actions {
+		if a.Type != PlanActionHttp {
+			return nil, fmt.Errorf(`action "%s" type "%s" not support`, a.Name, a.Type)
+		}
+		act := new(ActionHttp)
+		if err = a.Decode(act); err != nil {
+			return
+		}
+		fmt.Fprintf(&buf, "\n// %d. %s\nif act, err = box.NewActionHttp(&box.ActionHttp{\n", i+1, a.Name)
+		fmt.Fprintf(&buf, "Name: %q,\nMethod: %q,\nUrl: %q,\n", a.Name, act.Method, act.Url)
+		harGoMap(&buf, "Header", act.Header)
+		if len(act.Body) > 0 {
+			fmt.Fprintf(&buf, "Body: %q,\n", act.Body)
+		}
+		harGoMap(&buf, "Extract", act.Extract)
+		harGoMap(&buf, "ExtractHeader", act.ExtractHeader)
+		harGoMap(&buf, "ExtractRegexp", act.ExtractRegexp)
+		if len(act.Expect) > 0 {
+			fmt.Fprintf(&buf, "Expect: %#v,\n", act.Expect)
+		}
+		fmt.Fprintf(&buf, "}); err != nil {\nreturn\n}\n")
+		if a.Think > 0 {
+			fmt.Fprintf(&buf, "ret.AddAction(box.NewActionThink(act, %d*time.Millisecond))\n", a.Think)
+		} else {
+			fmt.Fprintf(&buf, "ret.AddAction(act)\n")
+		}
+	}
+	fmt.Fprintf(&buf, "return\n}\n")
+	return format.Source(buf.Bytes())
+}
+
+// 是否导入该请求
+func harFilter(e *HarEntry, opt *HarOption) bool {
+	u, err := url.Parse(e.Request.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if len(opt.Hosts) > 0 {
+		ok := false
+		for _, h := range opt.Hosts {
+			ok = ok || u.Hostname() == h || u.Host == h
+		}
+		if !ok {
+			return false
+		}
+	}
+	mime := strings.ToLower(e.Response.Content.MimeType)
+	if len(opt.Types) > 0 {
+		for _, t := range opt.Types {
+			if strings.Contains(mime, strings.ToLower(t)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, t := range harStaticTypes {
+		if strings.Contains(mime, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// 识别返回中的动态值: json中的令牌, 返回头, html隐藏字段
+func harValues(e *HarEntry, action int) (ret []*harValue) {
+	add := func(name, value, kind, path string) {
+		if !regHarToken.MatchString(value) {
+			return
+		}
+		for _, v := range ret {
+			if v.Value == value {
+				return
+			}
+		}
+		ret = append(ret, &harValue{Value: value, Name: name, Action: action, Kind: kind, Path: path})
+	}
+	for _, h := range e.Response.Headers {
+		if !harRespHeaderSkip[strings.ToLower(h.Name)] {
+			add(h.Name, h.Value, "header", h.Name)
+		}
+	}
+	body := e.Response.Content.Text
+	if e.Response.Content.Encoding == "base64" {
+		if b, err := base64.StdEncoding.DecodeString(body); err == nil {
+			body = string(b)
+		}
+	}
+	mime := strings.ToLower(e.Response.Content.MimeType)
+	if strings.Contains(mime, "json") {
+		var data interface{}
+		if json.Unmarshal([]byte(body), &data) == nil {
+			harWalk(data, "", "", add)
+		}
+	}
+	if strings.Contains(mime, "html") {
+		for _, m := range regHarInput.FindAllStringSubmatch(body, -1) {
+			add(m[1], m[2], "regexp", fmt.Sprintf(`name="%s"[^>]*?value="([^"]*)"`, regexp.QuoteMeta(m[1])))
+		}
+	}
+	return
+}
+
+// 遍历json中的字符串
+func harWalk(data interface{}, path, key string, fn func(name, value, kind, path string)) {
+	join := func(k string) string {
+		if len(path) == 0 {
+			return k
+		}
+		return path + "." + k
+	}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !strings.Contains(k, ".") {
+				harWalk(v[k], join(k), k, fn)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			harWalk(val, join(strconv.Itoa(i)), key, fn)
+		}
+	case string:
+		fn(key, v, "json", path)
+	}
+}
+
+// 生成不重复的变量名
+func harName(name string, names map[string]bool) (ret string) {
+	name = strings.Trim(regHarName.ReplaceAllString(name, "_"), "_")
+	if len(name) == 0 {
+		name = "var"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "v" + name
+	}
+	ret = name
+	for i := 2; names[ret]; i++ {
+		ret = fmt.Sprintf("%s%d", name, i)
+	}
+	names[ret] = true
+	return
+}
+
+// 转义模板标记, 录制内容按原文发送
+func harEscape(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return strings.Replace(s, "{{", `{{"{{"}}`, -1)
+}
+
+// 请求路径, 用于动作命名
+func harPath(s string) string {
+	if u, err := url.Parse(s); err == nil && len(u.Path) > 0 {
+		return u.Path
+	}
+	return s
+}
+
+// 动作转为计划参数
+func harParams(act *ActionHttp) (ret map[string]interface{}, err error) {
+	var b []byte
+	if b, err = json.Marshal(act); err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &ret); err != nil {
+		return
+	}
+	delete(ret, "name")
+	for k, v := range ret {
+		switch _v := v.(type) {
+		case nil:
+			delete(ret, k)
+		case string:
+			if len(_v) == 0 {
+				delete(ret, k)
+			}
+		case map[string]interface{}:
+			if len(_v) == 0 {
+				delete(ret, k)
+			}
+		case float64:
+			if _v == 0 {
+				delete(ret, k)
+			}
+		}
+	}
+	return
+}
+
+// 输出map字面量, 键排序
+func harGoMap(buf *bytes.Buffer, field string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(buf, "%s: map[string]string{\n", field)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%q: %q,\n", k, m[k])
+	}
+	fmt.Fprintf(buf, "},\n")
+}
@@ -0,0 +1,64 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"github.com/tudyzhb/yaml"
+
+	"strings"
+	"testing"
+)
+
+const testHar = `{"log":{"entries":[
+{"startedDateTime":"2019-10-01T10:00:00.000Z","time":100,
+ "request":{"method":"GET","url":"https://app.test/login","headers":[{"name":"Cookie","value":"a=1"},{"name":"Accept","value":"text/html"}]},
+ "response":{"status":200,"headers":[],"content":{"mimeType":"text/html","text":"<form><input type=\"hidden\" name=\"csrf_token\" value=\"abcd1234efgh\"></form>"}}},
+{"startedDateTime":"2019-10-01T10:00:00.050Z","time":10,
+ "request":{"method":"GET","url":"https://cdn.test/logo.png","headers":[]},
+ "response":{"status":200,"headers":[],"content":{"mimeType":"image/png"}}},
+{"startedDateTime":"2019-10-01T10:00:02.100Z","time":50,
+ "request":{"method":"POST","url":"https://app.test/api/session","headers":[],"postData":{"mimeType":"application/x-www-form-urlencoded","text":"csrf_token=abcd1234efgh&user=a"}},
+ "response":{"status":200,"headers":[{"name":"X-Request-Id","value":"req-99999999"}],"content":{"mimeType":"application/json","text":"{\"data\":{\"token\":\"tok-0123456789\",\"name\":\"alice-long-name\"}}"}}},
+{"startedDateTime":"2019-10-01T10:00:02.200Z","time":20,
+ "request":{"method":"GET","url":"https://app.test/api/me","headers":[{"name":"Authorization","value":"Bearer tok-0123456789"}]},
+ "response":{"status":401,"headers":[],"content":{"mimeType":"application/json","text":"{}"}}}
+]}}`
+
+// 测试HAR导入: 过滤,思考时间与动态值识别
+func Test_HarImport(t *testing.T) {
+	as := require.New(t)
+	plan, err := ImportHar([]byte(testHar), &HarOption{Hosts: []string{"app.test"}})
+	as.Nil(err)
+	as.Len(plan.Robot.Actions, 3)
+
+	var acts []*ActionHttp
+	for _, a := range plan.Robot.Actions {
+		act := new(ActionHttp)
+		as.Nil(a.Decode(act))
+		acts = append(acts, act)
+	}
+	as.Equal(`text/html`, acts[0].Header["Accept"])
+	as.NotContains(acts[0].Header, "Cookie")
+	as.Contains(acts[0].ExtractRegexp, "csrf_token")
+	as.Equal("csrf_token={{.Var.csrf_token}}&user=a", acts[1].Body)
+	as.Equal("data.token", acts[1].Extract["token"])
+	as.Len(acts[1].Extract, 1)
+	as.Empty(acts[1].ExtractHeader)
+	as.Equal("Bearer {{.Var.token}}", acts[2].Header["Authorization"])
+	as.Equal([]int{401}, acts[2].Expect)
+	as.EqualValues(0, plan.Robot.Actions[0].Think)
+	as.EqualValues(2000, plan.Robot.Actions[1].Think)
+	as.EqualValues(0, plan.Robot.Actions[2].Think)
+
+	// 计划可再读取
+	b, err := yaml.Marshal(plan)
+	as.Nil(err)
+	plan2, err := ParsePlan(b)
+	as.Nil(err)
+	as.Nil(plan2.Valid())
+
+	// Go代码
+	code, err := PlanToGo(plan, "robots")
+	as.Nil(err)
+	as.True(strings.Contains(string(code), `box.NewActionThink(act, 2000*time.Millisecond)`))
+}
@@ -0,0 +1,14 @@
+package box
+
+// 直方图精度: 每个2的幂区间再等分为2^HistogramSubBits个桶, 相对误差小于1/2^HistogramSubBits
+const HistogramSubBits = 7
+
+// 耗时直方图: 对数线性分桶, 内存只与耗时的数量级相关; 可合并, 可json序列化
+type Histogram struct {
+	Count   uint64           `json:"count"`   // 样本数
+	Sum     float64          `json:"sum"`     // 总和, 单位纳秒
+	M2      float64          `json:"m2"`      // 离均差平方和, 用于标准差; 逐个累加与合并时更新, 避免平方和相减的精度损失
+	Min     int64            `json:"min"`     // 最小值, 纳秒
+	Max     int64            `json:"max"`     // 最大值, 纳秒
+	Buckets map[int32]uint64 `json:"buckets"` // 桶序号->样本数
+}
@@ -0,0 +1,192 @@
+package box
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// 创建直方图
+func NewHistogram() *Histogram {
+	return &Histogram{Buckets: map[int32]uint64{}}
+}
+
+// 耗时对应的桶序号: 小于2^HistogramSubBits纳秒时精确记录
+func histogramIndex(v int64) int32 {
+	if v <= 0 {
+		return 0
+	}
+	const sub = 1 << HistogramSubBits
+	if v < sub {
+		return int32(v)
+	}
+	e := bits.Len64(uint64(v)) - 1
+	shift := uint(e - HistogramSubBits)
+	return int32((int(shift)+1)*sub + int(uint64(v)>>shift) - sub)
+}
+
+// 桶的代表值: 桶的中点
+func histogramValue(idx int32) int64 {
+	const sub = 1 << HistogramSubBits
+	group := int(idx) / sub
+	if group == 0 {
+		return int64(idx)
+	}
+	shift := uint(group - 1)
+	low := int64(sub+int(idx)%sub) << shift
+	return low + (int64(1)<<shift)/2
+}
+
+// 记录一个耗时
+func (d *Histogram) Add(v time.Duration) {
+	if d.Buckets == nil {
+		d.Buckets = map[int32]uint64{}
+	}
+	n := int64(v)
+	if d.Count == 0 || n < d.Min {
+		d.Min = n
+	}
+	if d.Count == 0 || n > d.Max {
+		d.Max = n
+	}
+	// Welford: 按新旧平均值更新离均差平方和
+	x := float64(n)
+	mean := 0.0
+	if d.Count > 0 {
+		mean = d.Sum / float64(d.Count)
+	}
+	d.Count += 1
+	d.Sum += x
+	d.M2 += (x - mean) * (x - d.Sum/float64(d.Count))
+	d.Buckets[histogramIndex(n)] += 1
+}
+
+// 合并另一个直方图
+func (d *Histogram) Merge(o *Histogram) {
+	if o == nil || o.Count == 0 {
+		return
+	}
+	if d.Buckets == nil {
+		d.Buckets = map[int32]uint64{}
+	}
+	if d.Count == 0 || o.Min < d.Min {
+		d.Min = o.Min
+	}
+	if d.Count == 0 || o.Max > d.Max {
+		d.Max = o.Max
+	}
+	// 合并离均差平方和: 两部分各自的加上平均值之差带来的部分
+	if d.Count > 0 {
+		na, nb := float64(d.Count), float64(o.Count)
+		delta := o.Sum/nb - d.Sum/na
+		d.M2 += o.M2 + delta*delta*na*nb/(na+nb)
+	} else {
+		d.M2 = o.M2
+	}
+	d.Count += o.Count
+	d.Sum += o.Sum
+	for k, v := range o.Buckets {
+		d.Buckets[k] += v
+	}
+}
+
+// 按桶序号升序遍历, fn返回false时停止
+func (d *Histogram) walk(fn func(value int64, count uint64) bool) {
+	keys := make([]int, 0, len(d.Buckets))
+	for k := range d.Buckets {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		v := histogramValue(int32(k))
+		if v < d.Min {
+			v = d.Min
+		}
+		if v > d.Max {
+			v = d.Max
+		}
+		if !fn(v, d.Buckets[int32(k)]) {
+			return
+		}
+	}
+}
+
+// 百分位, q取0-100, 与排序后取第(n-1)*q/100个一致
+func (d *Histogram) Quantile(q float64) (ret time.Duration) {
+	if d.Count == 0 {
+		return
+	}
+	var (
+		rank = uint64(float64(d.Count-1) * q / 100)
+		seen uint64
+	)
+	// 两端精确
+	if rank == 0 {
+		return time.Duration(d.Min)
+	}
+	if rank >= d.Count-1 {
+		return time.Duration(d.Max)
+	}
+	d.walk(func(value int64, count uint64) bool {
+		seen += count
+		if seen > rank {
+			ret = time.Duration(value)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// 平均值
+func (d *Histogram) Mean() time.Duration {
+	if d.Count == 0 {
+		return 0
+	}
+	return time.Duration(d.Sum / float64(d.Count))
+}
+
+// 样本标准差
+func (d *Histogram) Std() time.Duration {
+	if d.Count < 2 {
+		return 0
+	}
+	v := d.M2 / float64(d.Count-1)
+	if !(v > 0) {
+		return 0
+	}
+	return time.Duration(math.Sqrt(v))
+}
+
+// 去掉两端后的平均值: 排序后取[n*from, n*to)区间, 与statUnits的90%平均一致
+func (d *Histogram) TrimmedMean(from, to float64) time.Duration {
+	var (
+		lo    = uint64(float64(d.Count) * from)
+		hi    = uint64(float64(d.Count) * to)
+		seen  uint64
+		total float64
+	)
+	if hi < lo {
+		hi = lo
+	}
+	d.walk(func(value int64, count uint64) bool {
+		// 本桶占[seen, seen+count), 与[lo, hi)的交集
+		a, b := seen, seen+count
+		if a < lo {
+			a = lo
+		}
+		if b > hi {
+			b = hi
+		}
+		if b > a {
+			total += float64(value) * float64(b-a)
+		}
+		seen += count
+		return seen < hi
+	})
+	if hi > lo {
+		return time.Duration(total / float64(hi-lo))
+	}
+	return time.Duration(total)
+}
@@ -0,0 +1,102 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 测试直方图的百分位误差与合并
+func Test_Histogram(t *testing.T) {
+	as := require.New(t)
+	var (
+		all    = NewHistogram()
+		a, b   = NewHistogram(), NewHistogram()
+		values []time.Duration
+	)
+	for i := 0; i < 10000; i++ {
+		v := time.Duration(rand.ExpFloat64() * float64(time.Millisecond*20))
+		values = append(values, v)
+		all.Add(v)
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(b)
+	as.Equal(all.Count, a.Count)
+	as.Equal(all.Buckets, a.Buckets)
+	as.Equal(all.Min, a.Min)
+	as.Equal(all.Max, a.Max)
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, q := range []float64{50, 90, 99, 99.9} {
+		exact := values[int(float64(len(values)-1)*q/100)]
+		as.InEpsilon(float64(exact), float64(a.Quantile(q)), 0.01, q)
+	}
+	as.Equal(values[0], a.Quantile(0))
+	as.Equal(values[len(values)-1], a.Quantile(100))
+	var total time.Duration
+	for _, v := range values[500:9500] {
+		total += v
+	}
+	as.InEpsilon(float64(total/9000), float64(a.TrimmedMean(0.05, 0.95)), 0.01)
+
+	// 小于128纳秒精确记录
+	h := NewHistogram()
+	for _, v := range []time.Duration{3, 7, 100} {
+		h.Add(v)
+	}
+	as.Equal(time.Duration(7), h.Quantile(50))
+}
+
+// 测试大样本数下的标准差: 耗时大而离散小时不因平方和相减失去精度, 合并后一致
+func Test_HistogramStd(t *testing.T) {
+	as := require.New(t)
+	var (
+		all   = NewHistogram()
+		parts = []*Histogram{NewHistogram(), NewHistogram(), NewHistogram()}
+	)
+	// 10秒左右, 相差2纳秒, 标准差约1纳秒
+	for i := 0; i < 3000000; i++ {
+		v := time.Second*10 + time.Duration(i%2*2)
+		all.Add(v)
+		parts[i%7%3].Add(v)
+	}
+	as.InDelta(1, float64(all.Std()), 0.01)
+	merged := NewHistogram()
+	for _, p := range parts {
+		merged.Merge(p)
+	}
+	as.Equal(all.Count, merged.Count)
+	as.InDelta(1, float64(merged.Std()), 0.01)
+
+	// 相同的值标准差为0
+	h := NewHistogram()
+	for i := 0; i < 1000000; i++ {
+		h.Add(time.Hour)
+	}
+	as.Zero(h.Std())
+
+	// 与逐个计算一致
+	var values []float64
+	h = NewHistogram()
+	for i := 0; i < 1000; i++ {
+		v := rand.ExpFloat64() * float64(time.Millisecond*20)
+		values = append(values, float64(time.Duration(v)))
+		h.Add(time.Duration(v))
+	}
+	var mean, m2 float64
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	for _, v := range values {
+		m2 += (v - mean) * (v - mean)
+	}
+	as.InEpsilon(math.Sqrt(m2/float64(len(values)-1)), float64(h.Std()), 1e-6)
+}
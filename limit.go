@@ -0,0 +1,30 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 限流: 令牌桶限速与同时执行的上限, 可设置在Scene(所有动作)或单个动作上, 也可由多个动作共用一个;
+// 等待限流的时间记入RobotActionResult.TimeLimit, 不计入动作耗时
+type Limiter struct {
+	Rate     float64 // 每秒允许开始的动作数, 不大于0时不限速
+	Burst    int     // 令牌桶容量, 即允许的突发数, 默认1
+	InFlight int     // 同时执行的上限, 如模拟客户端连接池; 不大于0时不限
+	//
+	tokens float64    // 桶内令牌, 为负时表示已预约的等待
+	last   time.Time  // 上次计算令牌的时间
+	sem    *clockSem  // 同时执行的名额
+	lock   sync.Mutex //
+}
+
+// 可限流的动作, 见Limiter
+type ActionLimit interface {
+	GetLimiter() *Limiter // 动作的限流, 为空时不限
+}
+
+// 为动作加上限流
+type ActionLimited struct {
+	Action           // 原动作
+	Limiter *Limiter // 限流
+}
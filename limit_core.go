@@ -0,0 +1,146 @@
+package box
+
+import (
+	"io"
+	"time"
+)
+
+// 创建限流: rate为每秒允许开始的动作数, inFlight为同时执行的上限, 为0时不限
+func NewLimiter(rate float64, inFlight int) *Limiter {
+	return &Limiter{Rate: rate, InFlight: inFlight}
+}
+
+// 等待限流: 先取得同时执行的名额, 再等待令牌; 返回执行结束时调用的释放函数. clock为空时为真实时钟
+func (d *Limiter) Wait(clock Clock) (release func()) {
+	release, _ = d.wait(clock, nil)
+	return
+}
+
+// 等待限流, done关闭时放弃等待并返回ok为false, 此时已取得的名额已释放
+func (d *Limiter) wait(clock Clock, done <-chan struct{}) (release func(), ok bool) {
+	release = func() {}
+	if d == nil {
+		return release, true
+	}
+	if clock == nil {
+		clock = ClockReal{}
+	}
+	if sem := d.getSem(); sem != nil {
+		if !sem.acquire(clock, done) {
+			return
+		}
+		release = func() { sem.release(clock) }
+	}
+	if !clockSleep(clock, d.reserve(clock.Now()), done) {
+		release()
+		return func() {}, false
+	}
+	return release, true
+}
+
+// 当前执行中的数目
+func (d *Limiter) GetInFlight() int {
+	if sem := d.getSem(); sem != nil {
+		return sem.getUsed()
+	}
+	return 0
+}
+
+// 预约一个令牌, 返回需等待的时间
+func (d *Limiter) reserve(now time.Time) (wait time.Duration) {
+	if d.Rate <= 0 {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	burst := float64(d.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if d.last.IsZero() {
+		d.tokens = burst
+		d.last = now
+	}
+	if now.After(d.last) {
+		d.tokens += now.Sub(d.last).Seconds() * d.Rate
+		if d.tokens > burst {
+			d.tokens = burst
+		}
+		d.last = now
+	}
+	d.tokens -= 1
+	if d.tokens < 0 {
+		wait = time.Duration(-d.tokens / d.Rate * float64(time.Second))
+	}
+	return
+}
+
+// 同时执行的名额, 首次使用时按InFlight创建
+func (d *Limiter) getSem() *clockSem {
+	if d == nil || d.InFlight <= 0 {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.sem == nil {
+		d.sem = &clockSem{size: d.InFlight}
+	}
+	return d.sem
+}
+
+// 为动作加上限流
+func NewActionLimited(a Action, l *Limiter) *ActionLimited {
+	return &ActionLimited{Action: a, Limiter: l}
+}
+
+//
+func (d *ActionLimited) GetLimiter() *Limiter {
+	return d.Limiter
+}
+
+// 原动作的思考时间
+func (d *ActionLimited) GetThink() (ret time.Duration) {
+	if a, ok := d.Action.(ActionThinking); ok {
+		ret = a.GetThink()
+	}
+	return
+}
+
+// 关闭原动作持有的资源, 见io.Closer
+func (d *ActionLimited) Close() (err error) {
+	if c, ok := d.Action.(io.Closer); ok {
+		err = c.Close()
+	}
+	return
+}
+
+// 等待场景与动作的限流, 返回等待时间与执行结束时调用的释放函数; 都不限流时release为空.
+// 等待中场景停止时放弃等待, ok为false且release为空
+func (s *Scene) waitLimit(action Action, clock Clock) (wait time.Duration, release func(), ok bool) {
+	var limiter *Limiter
+	if a, _ok := action.(ActionLimit); _ok {
+		limiter = a.GetLimiter()
+	}
+	if limiter == nil && s.Limiter == nil {
+		return 0, nil, true
+	}
+	var (
+		done  = s.getDone()
+		start = clock.Now()
+	)
+	r1, ok := limiter.wait(clock, done) // 先动作后场景, 顺序固定避免互相等待
+	if !ok {
+		return
+	}
+	r2, ok := s.Limiter.wait(clock, done)
+	if !ok {
+		r1()
+		return
+	}
+	wait = clock.Now().Sub(start)
+	release = func() {
+		r2()
+		r1()
+	}
+	return
+}
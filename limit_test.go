@@ -0,0 +1,144 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试令牌桶与同时执行上限, 等待限流的时间不计入耗时
+func Test_Limiter(t *testing.T) {
+	as := require.New(t)
+
+	// 令牌桶: 按速率预约, 空闲时积攒到容量
+	now := time.Now()
+	l := NewLimiter(10, 0)
+	as.Equal(time.Duration(0), l.reserve(now))
+	as.Equal(time.Millisecond*100, l.reserve(now))
+	as.Equal(time.Millisecond*200, l.reserve(now))
+	now = now.Add(time.Second * 10)
+	l.Burst = 2
+	as.Equal(time.Duration(0), l.reserve(now))
+	as.Equal(time.Duration(0), l.reserve(now))
+	as.Equal(time.Millisecond*100, l.reserve(now))
+	as.Equal(time.Duration(0), NewLimiter(0, 0).reserve(now))
+	var none *Limiter
+	none.Wait(nil)()
+
+	// 动作限速: 每秒10个, 按虚拟时间
+	clock := NewClockFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Close()
+	var (
+		lock     sync.Mutex
+		starts   []time.Time
+		inFlight int
+		maxIn    int
+	)
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name:    "limited",
+		Limiter: NewLimiter(10, 0),
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			lock.Lock()
+			starts = append(starts, u.Scene.GetClock().Now())
+			lock.Unlock()
+			u.Scene.GetClock().Sleep(time.Millisecond * 10)
+			return
+		},
+	})))
+	scene := NewScene(&Scene{Name: "limit", DefaultRobot: robot, Clock: clock})
+	scene.Log.SetLevel(1)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 20, BatchMax: 1}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+	lock.Lock()
+	as.Len(starts, 20)
+	first, last := starts[0], starts[0]
+	for _, at := range starts {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	lock.Unlock()
+	as.Equal(time.Millisecond*1900, last.Sub(first))
+
+	// 等待单独报告, 耗时不含等待
+	a := data[0].ActionArray[0]
+	as.Equal(time.Millisecond*10, a.TimeMax)
+	as.Equal(time.Millisecond*950, a.TimeLimit)
+
+	// 场景同时执行上限
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "pool",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			lock.Lock()
+			inFlight += 1
+			if inFlight > maxIn {
+				maxIn = inFlight
+			}
+			lock.Unlock()
+			u.Scene.GetClock().Sleep(time.Millisecond * 500)
+			lock.Lock()
+			inFlight -= 1
+			lock.Unlock()
+			return
+		},
+	})))
+	scene = NewScene(&Scene{Name: "limit", DefaultRobot: robot, Clock: clock, Limiter: NewLimiter(0, 3)})
+	scene.Log.SetLevel(1)
+	data, err = scene.RunSurge(&FormSurge{NumInit: 10, BatchMax: 1}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+	as.Equal(3, maxIn)
+	as.Equal(0, scene.Limiter.GetInFlight())
+	a = data[0].ActionArray[0]
+	as.Equal(time.Millisecond*500, a.TimeMax)
+	as.Equal(time.Millisecond*600, a.TimeLimit) // 按名额轮流: 0,0,0,500,500,500,1000,1000,1000,1500
+	as.Equal(time.Millisecond*2000, data[0].TimeRun)
+
+	// 思考在限流之前, 思考中不占用名额: 同时思考100ms后依次执行
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionThink(NewActionLimited(NewActionOne(&ActionOne{
+		Name: "think",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			u.Scene.GetClock().Sleep(time.Millisecond * 10)
+			return
+		},
+	}), NewLimiter(0, 1)), time.Millisecond*100)))
+	scene = NewScene(&Scene{Name: "limit", DefaultRobot: robot, Clock: clock})
+	scene.Log.SetLevel(1)
+	data, err = scene.RunSurge(&FormSurge{NumInit: 3, BatchMax: 1}, nil)
+	as.Nil(err)
+	as.Equal(time.Millisecond*130, data[0].TimeRun)
+	as.Equal(time.Millisecond*10, data[0].ActionArray[0].TimeLimit) // 0,10,20
+
+	// 计划中的限流
+	plan, err := ParsePlan([]byte(`
+name: limit
+category: surge
+surge: {numInit: 1}
+rate: 100
+inFlight: 5
+robot:
+  actions:
+    - name: wait
+      type: sleep
+      duration: 1
+      rate: 10
+      inFlight: 2
+      think: 1
+`))
+	as.Nil(err)
+	s, err := plan.NewScene()
+	as.Nil(err)
+	as.Equal(&Limiter{Rate: 100, InFlight: 5}, s.Limiter)
+	limited, ok := s.DefaultRobot.ActionArray[0].(ActionLimit)
+	as.True(ok)
+	as.Equal(&Limiter{Rate: 10, InFlight: 2}, limited.GetLimiter())
+}
@@ -0,0 +1,40 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10} // 动作耗时直方图分桶, 单位秒
+	DefaultMetricsPrefix  = "box"                                                       // 指标名前缀
+)
+
+// 场景实时指标, 以Prometheus文本格式输出; 赋给Scene.Metrics或作为结果输出在执行中更新
+type SceneMetrics struct {
+	Prefix  string    // 指标名前缀, 默认DefaultMetricsPrefix
+	Buckets []float64 // 耗时直方图分桶, 单位秒, 默认DefaultMetricsBuckets
+	//
+	scene       string                    // 场景名
+	category    string                    // 测试类型
+	batch       int                       // 当前轮次, 1起始
+	batchMax    int                       // 最大轮次
+	batchRobot  int                       // 本轮机器人数
+	status      int                       // 最近一轮的场景状态
+	running     bool                      // 是否正在执行
+	concurrency int64                     // 当前并发, 原子操作
+	timeStart   time.Time                 // 本轮开始时间
+	actions     map[string]*metricsAction // 各动作统计
+	names       []string                  // 动作名, 保持出现顺序
+	lock        sync.RWMutex              //
+}
+
+// 一个动作的指标
+type metricsAction struct {
+	buckets []uint64          // 各分桶累计数, 与Buckets对应
+	count   uint64            // 执行次数
+	sum     float64           // 总耗时, 单位秒
+	skip    uint64            // 跳过次数
+	errors  map[string]uint64 // 错误分类->次数
+}
@@ -0,0 +1,169 @@
+package box
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 创建场景实时指标
+func NewSceneMetrics(s *SceneMetrics) (d *SceneMetrics) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(SceneMetrics)
+	}
+	if len(d.Prefix) == 0 {
+		d.Prefix = DefaultMetricsPrefix
+	}
+	if len(d.Buckets) == 0 {
+		d.Buckets = DefaultMetricsBuckets
+	}
+	d.Buckets = append([]float64{}, d.Buckets...)
+	sort.Float64s(d.Buckets)
+	d.actions = map[string]*metricsAction{}
+	return
+}
+
+// 本轮开始
+func (d *SceneMetrics) OnBatchStart(report *ResultScene) {
+	d.lock.Lock()
+	if d.actions == nil {
+		NewSceneMetrics(d)
+	}
+	d.scene = report.Scene
+	d.category = report.Category
+	d.batch = report.Batch
+	d.batchMax = report.BatchMax
+	d.batchRobot = report.BatchRobot
+	d.timeStart = report.TimeStart
+	d.running = true
+	d.lock.Unlock()
+}
+
+// 本轮结束, 场景状态不再正常时即执行结束
+func (d *SceneMetrics) OnBatch(report *ResultScene) {
+	d.lock.Lock()
+	d.status = report.Status
+	d.running = report.Status == SceneStatusNormal
+	d.lock.Unlock()
+}
+
+//
+func (d *SceneMetrics) Close() error {
+	return nil
+}
+
+// 并发变化: 原子计数, 不加锁
+func (d *SceneMetrics) OnConcurrency(add int64) {
+	atomic.AddInt64(&d.concurrency, add)
+}
+
+// 记录一个动作样本
+func (d *SceneMetrics) OnSample(r *ResultSample) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.actions == nil {
+		NewSceneMetrics(d)
+	}
+	a := d.actions[r.Action]
+	if a == nil {
+		a = &metricsAction{buckets: make([]uint64, len(d.Buckets)), errors: map[string]uint64{}}
+		d.actions[r.Action] = a
+		d.names = append(d.names, r.Action)
+	}
+	if r.IsSkip() {
+		a.skip += 1
+		return
+	}
+	spent := r.TimeSpent.Seconds()
+	a.count += 1
+	a.sum += spent
+	for i, b := range d.Buckets {
+		if spent <= b {
+			a.buckets[i] += 1
+		}
+	}
+	if r.Status != ActionStatusNormal {
+		class := r.ErrClass
+		if len(class) == 0 {
+			class = ErrorClassOther
+		}
+		a.errors[class] += 1
+	}
+}
+
+// 以Prometheus文本格式输出
+func (d *SceneMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	d.WriteTo(w)
+}
+
+// 写入Prometheus文本格式
+func (d *SceneMetrics) WriteTo(w io.Writer) (n int64, err error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	var (
+		b       = new(bytes.Buffer)
+		p       = d.Prefix
+		labels  = fmt.Sprintf(`scene="%s",category="%s"`, metricsEscape(d.scene), metricsEscape(d.category))
+		running = 0
+	)
+	if d.running {
+		running = 1
+	}
+	fnGauge := func(name, help string, v interface{}) {
+		fmt.Fprintf(b, "# HELP %s_%s %s\n# TYPE %s_%s gauge\n%s_%s{%s} %v\n", p, name, help, p, name, p, name, labels, v)
+	}
+	fnGauge("scene_running", "Whether the scene is running.", running)
+	fnGauge("scene_batch", "Current batch, 1-based.", d.batch)
+	fnGauge("scene_batch_max", "Max batch of the scene.", d.batchMax)
+	fnGauge("scene_robots", "Robots of the current batch.", d.batchRobot)
+	fnGauge("scene_concurrency", "Actions in flight.", atomic.LoadInt64(&d.concurrency))
+	fnGauge("scene_status", "Scene status of the last finished batch, see SceneStatus*.", d.status)
+	if !d.timeStart.IsZero() {
+		fnGauge("scene_batch_start_seconds", "Start time of the current batch, unix seconds.", d.timeStart.Unix())
+	}
+
+	// 动作耗时
+	fmt.Fprintf(b, "# HELP %s_action_duration_seconds Action latency.\n# TYPE %s_action_duration_seconds histogram\n", p, p)
+	for _, name := range d.names {
+		a := d.actions[name]
+		l := fmt.Sprintf(`%s,action="%s"`, labels, metricsEscape(name))
+		for i, le := range d.Buckets {
+			fmt.Fprintf(b, "%s_action_duration_seconds_bucket{%s,le=\"%s\"} %d\n", p, l, strconv.FormatFloat(le, 'g', -1, 64), a.buckets[i])
+		}
+		fmt.Fprintf(b, "%s_action_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", p, l, a.count)
+		fmt.Fprintf(b, "%s_action_duration_seconds_sum{%s} %s\n", p, l, strconv.FormatFloat(a.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_action_duration_seconds_count{%s} %d\n", p, l, a.count)
+	}
+
+	// 错误与跳过
+	fmt.Fprintf(b, "# HELP %s_action_errors_total Action errors by class.\n# TYPE %s_action_errors_total counter\n", p, p)
+	for _, name := range d.names {
+		a := d.actions[name]
+		var classes []string
+		for c := range a.errors {
+			classes = append(classes, c)
+		}
+		sort.Strings(classes)
+		for _, c := range classes {
+			fmt.Fprintf(b, "%s_action_errors_total{%s,action=\"%s\",class=\"%s\"} %d\n", p, labels, metricsEscape(name), metricsEscape(c), a.errors[c])
+		}
+	}
+	fmt.Fprintf(b, "# HELP %s_action_skipped_total Actions skipped after a previous failure.\n# TYPE %s_action_skipped_total counter\n", p, p)
+	for _, name := range d.names {
+		fmt.Fprintf(b, "%s_action_skipped_total{%s,action=\"%s\"} %d\n", p, labels, metricsEscape(name), d.actions[name].skip)
+	}
+	return b.WriteTo(w)
+}
+
+// 转义标签值
+func metricsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
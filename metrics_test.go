@@ -0,0 +1,72 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试执行中的Prometheus指标
+func Test_SceneMetrics(t *testing.T) {
+	as := require.New(t)
+	var (
+		metrics = NewSceneMetrics(nil)
+		svr     = httptest.NewServer(metrics)
+		scrape  = func() string {
+			resp, err := http.Get(svr.URL)
+			as.Nil(err)
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+			return string(b)
+		}
+		during string
+	)
+	defer svr.Close()
+
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			time.Sleep(time.Millisecond * 20)
+			if u.Serial == 0 {
+				err = NewActionError(ActionStatusFreeze, fmt.Errorf("slow"))
+			} else if u.Serial == 1 {
+				err = &ErrorHttpStatus{StatusCode: 502}
+			} else if u.Serial == 2 && batch == 0 {
+				during = scrape()
+			}
+			return
+		},
+	})))
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "query"})))
+	scene := NewScene(&Scene{Name: `demo "1"`, DefaultRobot: robot, Metrics: metrics})
+	scene.Log.SetLevel(2)
+	_, err := scene.RunSurge(&FormSurge{NumInit: 4, BatchMax: 2}, nil)
+	as.Nil(err)
+
+	// 执行中
+	as.Contains(during, `box_scene_running{scene="demo \"1\"",category="surge"} 1`)
+	as.Contains(during, `box_scene_batch{scene="demo \"1\"",category="surge"} 1`)
+	as.Contains(during, `box_scene_robots{scene="demo \"1\"",category="surge"} 4`)
+	as.Regexp(`box_scene_concurrency\{[^}]*\} [1-4]\n`, during)
+
+	// 执行后
+	text := scrape()
+	as.Contains(text, `box_scene_running{scene="demo \"1\"",category="surge"} 0`)
+	as.Contains(text, `box_scene_batch{scene="demo \"1\"",category="surge"} 2`)
+	as.Contains(text, fmt.Sprintf(`box_scene_status{scene="demo \"1\"",category="surge"} %d`, SceneStatusBatchMax))
+	as.Contains(text, `box_scene_concurrency{scene="demo \"1\"",category="surge"} 0`)
+	as.Contains(text, `box_action_duration_seconds_bucket{scene="demo \"1\"",category="surge",action="login",le="0.01"} 0`)
+	as.Contains(text, `box_action_duration_seconds_bucket{scene="demo \"1\"",category="surge",action="login",le="+Inf"} 8`)
+	as.Contains(text, `box_action_duration_seconds_count{scene="demo \"1\"",category="surge",action="query"} 4`)
+	as.Contains(text, `box_action_errors_total{scene="demo \"1\"",category="surge",action="login",class="http_5xx"} 2`)
+	as.Contains(text, `box_action_errors_total{scene="demo \"1\"",category="surge",action="login",class="timeout"} 2`)
+	as.Contains(text, `box_action_skipped_total{scene="demo \"1\"",category="surge",action="query"} 4`)
+	as.Equal(1, strings.Count(text, "# TYPE box_action_duration_seconds histogram"))
+}
@@ -0,0 +1,75 @@
+package box
+
+import (
+	"sync"
+)
+
+// 内置动作类型
+const (
+	PlanActionSleep = "sleep" // 休眠指定毫秒, 用于调试计划
+)
+
+// 声明式测试计划: 由yaml/json文件描述场景,机器人与动作
+type Plan struct {
+	Name      string  `json:"name" yaml:"name"`                     // 场景名
+	Category  string  `json:"category" yaml:"category"`             // 测试类型 capacity|surge|stable|replay
+	NumCpu    int     `json:"numCpu" yaml:"numCpu,omitempty"`       // 程序并发数
+	Report    string  `json:"report" yaml:"report,omitempty"`       // 报告保存地址
+	Streaming bool    `json:"streaming" yaml:"streaming,omitempty"` // true: 流式统计, 内存不随机器人数增长, 见Scene.Streaming
+	Seed      int64   `json:"seed" yaml:"seed,omitempty"`           // 随机种子, 相同时调度可复现, 见Scene.Seed
+	Rate      float64 `json:"rate" yaml:"rate,omitempty"`           // 所有动作每秒开始的上限, 0:不限
+	InFlight  int     `json:"inFlight" yaml:"inFlight,omitempty"`   // 所有动作同时执行的上限, 0:不限
+	// 测试参数: 按Category选用其一
+	Capacity *FormCapacity `json:"capacity" yaml:"capacity,omitempty"` // 容量测试参数
+	Surge    *FormSurge    `json:"surge" yaml:"surge,omitempty"`       // 浪涌测试参数
+	Stable   *FormStable   `json:"stable" yaml:"stable,omitempty"`     // 稳定测试参数
+	Replay   *FormReplay   `json:"replay" yaml:"replay,omitempty"`     // 日志回放参数
+	//
+	Robot     *PlanRobot     `json:"robot" yaml:"robot"`                   // 机器人模板
+	Threshold *PlanThreshold `json:"threshold" yaml:"threshold,omitempty"` // 通过阀值
+	Breaker   *PlanBreaker   `json:"breaker" yaml:"breaker,omitempty"`     // 熔断, 见Scene.Breaker
+}
+
+// 计划中的熔断: 一轮中最近一段时间或最近若干动作的错误率达到阀值时中途停止
+type PlanBreaker struct {
+	FailRate float64 `json:"failRate" yaml:"failRate"`           // 错误率阀值 0~1
+	Window   int64   `json:"window" yaml:"window,omitempty"`     // 按最近多少毫秒统计, 0:默认10秒
+	Count    int     `json:"count" yaml:"count,omitempty"`       // 按最近多少个动作统计, 设置后不按时间
+	MinCount int     `json:"minCount" yaml:"minCount,omitempty"` // 窗口内至少有多少个动作才判断, 0:默认20
+}
+
+// 计划中的机器人模板
+type PlanRobot struct {
+	Name    string                 `json:"name" yaml:"name"`           // 用户名
+	Vars    map[string]interface{} `json:"vars" yaml:"vars,omitempty"` // 初始变量, 可在动作模板中引用
+	Actions []*PlanAction          `json:"actions" yaml:"actions"`     // 要做的动作
+}
+
+// 计划中的一个动作
+type PlanAction struct {
+	Name     string                 `json:"name" yaml:"name"`                   // 动作命名
+	Type     string                 `json:"type" yaml:"type"`                   // 动作类型, 需事先通过RegisterAction注册
+	Think    int64                  `json:"think" yaml:"think,omitempty"`       // 执行前的思考时间,单位毫秒
+	Rate     float64                `json:"rate" yaml:"rate,omitempty"`         // 本动作每秒开始的上限, 0:不限
+	InFlight int                    `json:"inFlight" yaml:"inFlight,omitempty"` // 本动作同时执行的上限, 0:不限
+	Params   map[string]interface{} `json:"-" yaml:",inline"`                   // 动作参数, 由动作类型自行解析
+	//
+	built    Action // Plan.Valid生成的动作实例, 由Plan.NewScene取走
+	builtKey string // 生成时的动作内容, 改变后重新生成
+}
+
+// 计划的通过阀值, 超出即视为测试失败
+type PlanThreshold struct {
+	FailRate      float64 `json:"failRate" yaml:"failRate"`           // 每轮允许的最大错误率, 0:不检查
+	PerfTimeAvg   int64   `json:"perfTimeAvg" yaml:"perfTimeAvg"`     // 每轮平均耗时上限,单位毫秒, 0:不检查
+	PerfTime90Avg int64   `json:"perfTime90Avg" yaml:"perfTime90Avg"` // 每轮90%平均耗时上限,单位毫秒, 0:不检查
+	StatusFail    []int   `json:"statusFail" yaml:"statusFail"`       // 视为失败的场景状态, 默认: SceneStatusFailBreak,SceneStatusBreak,SceneStatusInterrupt
+}
+
+// 动作构造函数: 由计划中的动作参数生成动作实例
+type ActionBuilder func(act *PlanAction) (ret Action, err error)
+
+var (
+	actionBuilders     = map[string]ActionBuilder{} // 已注册的动作类型
+	actionBuildersLock sync.RWMutex                 //
+)
@@ -0,0 +1,344 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"github.com/tudyzhb/yaml"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterAction(PlanActionSleep, func(act *PlanAction) (ret Action, err error) {
+		var params struct {
+			Duration int64 `yaml:"duration"` // 休眠时长,单位毫秒
+		}
+		if err = act.Decode(&params); err != nil {
+			return
+		}
+		spent := time.Duration(params.Duration) * time.Millisecond
+		ret = NewActionOne(&ActionOne{
+			Name: act.Name,
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				u.Scene.GetClock().Sleep(spent)
+				return
+			},
+		})
+		return
+	})
+}
+
+// 注册动作类型, 同名类型将被覆盖
+func RegisterAction(category string, fn ActionBuilder) {
+	actionBuildersLock.Lock()
+	actionBuilders[category] = fn
+	actionBuildersLock.Unlock()
+}
+
+// 已注册的动作类型
+func GetActionTypes() (ret []string) {
+	actionBuildersLock.RLock()
+	for k := range actionBuilders {
+		ret = append(ret, k)
+	}
+	actionBuildersLock.RUnlock()
+	sort.Strings(ret)
+	return
+}
+
+// 读取计划文件
+func LoadPlan(planPath string) (ret *Plan, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(planPath); err != nil {
+		return
+	}
+	return ParsePlan(b)
+}
+
+// 解析计划内容, yaml或json
+func ParsePlan(b []byte) (ret *Plan, err error) {
+	ret = new(Plan)
+	if err = yaml.Unmarshal(b, ret); err != nil {
+		ret = nil
+		return
+	}
+	return
+}
+
+// 将动作参数解析到结构体, 按yaml标签匹配
+func (d *PlanAction) Decode(v interface{}) (err error) {
+	var b []byte
+	if b, err = yaml.Marshal(d.Params); err != nil {
+		return
+	}
+	return yaml.Unmarshal(b, v)
+}
+
+// 生成动作实例
+func (d *PlanAction) Build() (ret Action, err error) {
+	actionBuildersLock.RLock()
+	fn := actionBuilders[d.Type]
+	actionBuildersLock.RUnlock()
+	if fn == nil {
+		return nil, contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`action "%s" type "%s"`, d.Name, d.Type))
+	}
+	if ret, err = fn(d); err != nil {
+		err = fmt.Errorf(`action "%s": %v`, d.Name, err)
+		return
+	}
+	if d.Rate > 0 || d.InFlight > 0 {
+		ret = NewActionLimited(ret, NewLimiter(d.Rate, d.InFlight))
+	}
+	if d.Think > 0 {
+		ret = NewActionThink(ret, time.Duration(d.Think)*time.Millisecond)
+	}
+	return
+}
+
+// 生成并暂存动作实例, 动作内容未变时沿用上次生成的
+func (d *PlanAction) build() (err error) {
+	var b []byte
+	if b, err = yaml.Marshal(d); err != nil {
+		return
+	}
+	if d.built != nil && d.builtKey == string(b) {
+		return
+	}
+	if c, ok := d.built.(io.Closer); ok {
+		c.Close()
+	}
+	d.built, d.builtKey = nil, ""
+	var a Action
+	if a, err = d.Build(); err != nil {
+		return
+	}
+	d.built, d.builtKey = a, string(b)
+	return
+}
+
+// 取场景测试参数
+func (d *Plan) GetForm() (ret *FormScene, err error) {
+	switch d.Category {
+	case SceneCateCapacity:
+		if d.Capacity == nil {
+			d.Capacity = new(FormCapacity)
+		}
+		ret, err = d.Capacity.GetForm()
+	case SceneCateSurge:
+		if d.Surge == nil {
+			d.Surge = new(FormSurge)
+		}
+		ret, err = d.Surge.GetForm()
+	case SceneCateStable:
+		if d.Stable == nil {
+			d.Stable = new(FormStable)
+		}
+		ret, err = d.Stable.GetForm()
+	case SceneCateReplay:
+		if d.Replay == nil {
+			d.Replay = new(FormReplay)
+		}
+		ret, err = d.Replay.GetForm()
+	default:
+		err = contrib.ErrParamInvalid.SetVars("category")
+	}
+	return
+}
+
+// 检查计划, 不执行
+func (d *Plan) Valid() (err error) {
+	if d == nil {
+		return contrib.ErrParamUndefined
+	}
+	if d.Category == SceneCateStable {
+		// 稳定测试由周期与时长得出轮数, 缺少时无法执行
+		if d.Stable == nil || d.Stable.PeriodScene <= 0 {
+			return contrib.ErrParamInvalid.SetVars("periodScene")
+		}
+		if d.Stable.Duration <= 0 {
+			return contrib.ErrParamInvalid.SetVars("duration")
+		}
+	}
+	var form *FormScene
+	if form, err = d.GetForm(); err != nil {
+		return
+	}
+	if err = form.Valid(); err != nil {
+		return
+	}
+	if d.Robot == nil || len(d.Robot.Actions) == 0 {
+		return contrib.ErrParamInvalid.SetVars("robot.actions")
+	}
+	for _, act := range d.Robot.Actions {
+		if err = act.build(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 按计划生成场景
+func (d *Plan) NewScene() (ret *Scene, err error) {
+	if err = d.Valid(); err != nil {
+		return
+	}
+	robot := NewRobot(&Robot{
+		Name: d.Robot.Name,
+		Vars: d.Robot.Vars,
+	})
+	if len(robot.Name) == 0 {
+		robot.Name = "robot"
+	}
+	for _, act := range d.Robot.Actions {
+		// 取走检查时生成的实例, 再次生成场景时重新生成
+		a := act.built
+		act.built, act.builtKey = nil, ""
+		if err = robot.AddAction(a); err != nil {
+			return
+		}
+	}
+	ret = NewScene(&Scene{
+		Name:         d.Name,
+		NumCpu:       d.NumCpu,
+		DefaultRobot: robot,
+		Streaming:    d.Streaming,
+		Seed:         d.Seed,
+		FnAfter:      closeActions,
+	})
+	if d.Rate > 0 || d.InFlight > 0 {
+		ret.Limiter = NewLimiter(d.Rate, d.InFlight)
+	}
+	if b := d.Breaker; b != nil && b.FailRate > 0 {
+		ret.Breaker = &Breaker{
+			FailRate: b.FailRate,
+			Window:   time.Duration(b.Window) * time.Millisecond,
+			Count:    b.Count,
+			MinCount: b.MinCount,
+		}
+	}
+	return
+}
+
+// 场景执行后关闭动作持有的共用资源(io.Closer), 如gRPC共用连接池
+func closeActions(s *Scene) (err error) {
+	for _, a := range s.DefaultRobot.ActionArray {
+		if c, ok := a.(io.Closer); ok {
+			if _err := c.Close(); _err != nil && err == nil {
+				err = _err
+			}
+		}
+	}
+	return
+}
+
+// 按计划执行场景
+func (d *Plan) Run(s *Scene, cache chan *ResultScene) (ret []*ResultScene, err error) {
+	if s == nil {
+		if s, err = d.NewScene(); err != nil {
+			return
+		}
+	}
+	switch d.Category {
+	case SceneCateCapacity:
+		ret, err = s.RunCapacity(d.Capacity, cache)
+	case SceneCateSurge:
+		ret, err = s.RunSurge(d.Surge, cache)
+	case SceneCateStable:
+		ret, err = s.RunStable(d.Stable, cache)
+	case SceneCateReplay:
+		ret, err = s.RunReplay(d.Replay, cache)
+	default:
+		err = contrib.ErrParamInvalid.SetVars("category")
+	}
+	return
+}
+
+// 按阀值检查测试结果, 返回第一个不通过的原因
+func (d *Plan) Check(data []*ResultScene) (err error) {
+	if len(data) == 0 {
+		return fmt.Errorf(`[plan-check] no result`)
+	}
+	var (
+		threshold  = d.Threshold
+		statusFail = []int{SceneStatusFailBreak, SceneStatusBreak, SceneStatusInterrupt}
+	)
+	if threshold == nil {
+		threshold = new(PlanThreshold)
+	}
+	if len(threshold.StatusFail) > 0 {
+		statusFail = threshold.StatusFail
+	}
+
+	// 场景状态
+	last := data[len(data)-1]
+	for _, status := range statusFail {
+		if last.Status == status {
+			text := last.ErrText
+			if last.Status == SceneStatusBreak || last.Status == SceneStatusInterrupt {
+				text = last.Reason
+			}
+			return fmt.Errorf(`[plan-check] #%d status %d: %s`, last.Batch, last.Status, text)
+		}
+	}
+
+	// 每轮阀值
+	for _, r := range data {
+		if err = d.CheckBatch(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 按阀值检查一轮结果
+func (d *Plan) CheckBatch(r *ResultScene) (err error) {
+	threshold := d.Threshold
+	if threshold == nil {
+		threshold = new(PlanThreshold)
+	}
+	if r.Status == SceneStatusFailPerf && r.Category == SceneCateCapacity {
+		// 容量测试因性能下降而终止的一轮不参与检查
+		return
+	}
+	if threshold.FailRate > 0 && r.FailRate > threshold.FailRate {
+		return fmt.Errorf(`[plan-check] #%d failRate %.4f > %.4f`, r.Batch, r.FailRate, threshold.FailRate)
+	}
+	if limit := time.Duration(threshold.PerfTimeAvg) * time.Millisecond; limit > 0 && r.PerfTimeAvg > limit {
+		return fmt.Errorf(`[plan-check] #%d perfTimeAvg %s > %s`, r.Batch, r.PerfTimeAvg, limit)
+	}
+	if limit := time.Duration(threshold.PerfTime90Avg) * time.Millisecond; limit > 0 && r.PerfTime90Avg > limit {
+		return fmt.Errorf(`[plan-check] #%d perfTime90Avg %s > %s`, r.Batch, r.PerfTime90Avg, limit)
+	}
+	return
+}
+
+// 生成测试报告, 按阀值给出结论
+func (d *Plan) NewReport(data []*ResultScene) (ret *Report) {
+	ret = NewReport(d.Name, data)
+	for _, b := range ret.Batches {
+		if err := d.CheckBatch(b.ResultScene); err != nil {
+			b.Error = err.Error()
+		}
+	}
+	ret.SetVerdict(d.Check(data))
+	return
+}
+
+// 保存测试报告, 多个地址以逗号分隔, 按扩展名选择格式, 见Report.Save
+func (d *Plan) SaveReport(reportPath string, data []*ResultScene) (err error) {
+	report := d.NewReport(data)
+	for _, p := range strings.Split(reportPath, ",") {
+		if p = strings.TrimSpace(p); len(p) == 0 {
+			continue
+		}
+		if err = report.Save(p); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"testing"
+)
+
+// 测试计划解析
+func Test_PlanParse(t *testing.T) {
+	as := require.New(t)
+	plan, err := ParsePlan([]byte(`
+name: demo
+category: capacity
+capacity:
+  numInit: 5
+  numStep: 5
+  batchMax: 2
+robot:
+  name: bot
+  actions:
+    - name: wait
+      type: sleep
+      duration: 20
+threshold:
+  failRate: 0.1
+`))
+	as.Nil(err)
+	as.Nil(plan.Valid())
+	as.Equal(5, plan.Capacity.NumInit)
+	as.Equal("sleep", plan.Robot.Actions[0].Type)
+	as.EqualValues(20, plan.Robot.Actions[0].Params["duration"])
+
+	// 未注册的类型
+	plan.Robot.Actions[0].Type = "unknown"
+	as.NotNil(plan.Valid())
+
+	// 稳定测试缺少周期时返回错误
+	plan.Robot.Actions[0].Type = "sleep"
+	plan.Category = SceneCateStable
+	plan.Stable = &FormStable{Duration: 60}
+	as.NotNil(plan.Valid())
+	plan.Stable = &FormStable{PeriodScene: 1000}
+	as.NotNil(plan.Valid())
+	plan.Stable = &FormStable{Duration: 60, PeriodScene: 1000, NumInit: 1}
+	as.Nil(plan.Valid())
+
+	// 阀值
+	as.Nil(plan.Check([]*ResultScene{{Batch: 1, FailRate: 0.05, Status: SceneStatusBatchMax}}))
+	as.NotNil(plan.Check([]*ResultScene{{Batch: 1, FailRate: 0.2}}))
+	as.NotNil(plan.Check([]*ResultScene{{Batch: 1, Status: SceneStatusFailBreak}}))
+}
+
+// 测试检查计划时生成的动作由生成场景沿用, 不重复生成
+func Test_PlanBuild(t *testing.T) {
+	as := require.New(t)
+	var count int
+	RegisterAction("test-count", func(act *PlanAction) (ret Action, err error) {
+		count++
+		return NewActionOne(&ActionOne{Name: act.Name}), nil
+	})
+	plan := &Plan{
+		Name:     "build",
+		Category: SceneCateSurge,
+		Surge:    &FormSurge{NumInit: 1, BatchMax: 1},
+		Robot:    &PlanRobot{Actions: []*PlanAction{{Name: "a", Type: "test-count"}}},
+	}
+	as.Nil(plan.Valid())
+	as.Nil(plan.Valid())
+	as.Equal(1, count)
+	scene, err := plan.NewScene()
+	as.Nil(err)
+	as.Equal(1, count)
+	as.Len(scene.DefaultRobot.ActionArray, 1)
+
+	// 动作内容改变时重新生成
+	plan.Robot.Actions[0].Think = 10
+	as.Nil(plan.Valid())
+	as.Equal(2, count)
+
+	// 再次生成场景时不复用已交给上一个场景的实例
+	_, err = plan.NewScene()
+	as.Nil(err)
+	_, err = plan.NewScene()
+	as.Nil(err)
+	as.Equal(3, count)
+}
@@ -0,0 +1,44 @@
+package box
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultProgressInterval      = time.Millisecond * 200 // 终端中进度刷新间隔
+	DefaultProgressPlainInterval = time.Second * 5        // 非终端时输出进度行的间隔
+	DefaultProgressWindow        = 1000                   // 滚动p95取最近的样本数
+	DefaultProgressWidth         = 30                     // 进度条宽度
+)
+
+// 终端进度: 在一行内刷新本轮进度条(完成的机器人/本轮机器人数), 已用时间/期望结束时间, 并发, 滚动p95与错误数;
+// 每轮结束后追加一行到轮次表. 输出不是终端时改为按间隔输出纯文本行
+type SceneProgress struct {
+	Writer   io.Writer     // 输出, 默认os.Stderr
+	TTY      bool          // true: 单行刷新; 由NewSceneProgress按Writer自动判断
+	Interval time.Duration // 刷新间隔, 默认按TTY取DefaultProgressInterval或DefaultProgressPlainInterval
+	Scene    *Scene        // 场景, 用于取每个机器人的动作数
+	//
+	actions     int             // 每个机器人的动作数
+	category    string          // 测试类型
+	batch       int             // 当前轮次, 1起始
+	batchMax    int             // 最大轮次
+	batchRobot  int             // 本轮机器人数
+	finished    int             // 本轮完成的机器人数
+	count       int             // 本轮完成的动作数, 不含跳过
+	fail        int             // 本轮失败的动作数
+	skip        int             // 本轮跳过的动作数
+	concurrency int64           // 当前并发, 原子操作
+	timeStart   time.Time       // 本轮开始时间
+	timeEndLine time.Time       // 本轮期望结束时间
+	spent       *Histogram      // 本轮耗时
+	window      []time.Duration // 最近的耗时, 环形
+	windowPos   int             // 下一个写入位置
+	header      bool            // 已输出表头
+	line        bool            // 终端中有未换行的进度行
+	stop        chan struct{}   // 停止刷新
+	lock        sync.Mutex      //
+}
@@ -0,0 +1,266 @@
+package box
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 创建终端进度并赋给scene.Progress; w为空时输出到os.Stderr
+func NewSceneProgress(scene *Scene, w io.Writer) (d *SceneProgress) {
+	if w == nil {
+		w = os.Stderr
+	}
+	d = &SceneProgress{Writer: w, TTY: IsTerminal(w), Scene: scene}
+	if scene != nil {
+		scene.Progress = d
+	}
+	return
+}
+
+// 是否为终端
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// 本轮开始
+func (d *SceneProgress) OnBatchStart(report *ResultScene) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.actions = 0
+	if d.Scene != nil && d.Scene.DefaultRobot != nil {
+		d.actions = len(d.Scene.DefaultRobot.ActionArray)
+	}
+	d.category = report.Category
+	d.batch = report.Batch
+	d.batchMax = report.BatchMax
+	d.batchRobot = report.BatchRobot
+	d.timeStart = report.TimeStart
+	d.timeEndLine = report.TimeEndLine
+	d.finished, d.count, d.fail, d.skip = 0, 0, 0, 0
+	d.spent = NewHistogram()
+	d.window = d.window[:0]
+	d.windowPos = 0
+	if d.stop == nil {
+		d.stop = make(chan struct{})
+		go d.loop(d.stop)
+	}
+	if d.TTY {
+		d.render()
+	}
+}
+
+// 记录一个动作样本
+func (d *SceneProgress) OnSample(r *ResultSample) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.actions > 0 && r.Step == d.actions-1 {
+		d.finished += 1
+	}
+	if r.IsSkip() {
+		d.skip += 1
+		return
+	}
+	d.count += 1
+	if r.Status != ActionStatusNormal {
+		d.fail += 1
+	}
+	if d.spent == nil {
+		d.spent = NewHistogram()
+	}
+	d.spent.Add(r.TimeSpent)
+	if len(d.window) < DefaultProgressWindow {
+		d.window = append(d.window, r.TimeSpent)
+	} else {
+		d.window[d.windowPos] = r.TimeSpent
+	}
+	d.windowPos = (d.windowPos + 1) % DefaultProgressWindow
+}
+
+// 并发变化: 原子计数, 不加锁
+func (d *SceneProgress) OnConcurrency(add int64) {
+	atomic.AddInt64(&d.concurrency, add)
+}
+
+// 本轮结束: 清除进度行, 追加一行到轮次表
+func (d *SceneProgress) OnBatch(report *ResultScene) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.clear()
+	if !d.header {
+		d.header = true
+		fmt.Fprintf(d.Writer, "%-7s %7s %-8s %9s %6s %9s %10s %10s %7s  %s\n",
+			"batch", "robots", "status", "run", "conc", "tps", "avg", "p95", "fail%", "error")
+	}
+	errText := report.ErrText
+	if len(report.Reason) > 0 {
+		errText = report.Reason
+	}
+	var p95 time.Duration
+	if d.spent != nil {
+		p95 = d.spent.Quantile(95)
+	}
+	row := fmt.Sprintf("%-7s %7d %-8s %9s %6d %9.2f %10s %10s %7.2f  %s",
+		fmt.Sprintf("%d/%d", report.Batch, report.BatchMax), report.BatchRobot, progressStatus(report.Status),
+		progressDuration(report.TimeRun), report.Concurrency, report.GetThroughput(),
+		progressDuration(report.PerfTimeAvg), progressDuration(p95), report.FailRate*100, progressText(errText, 60))
+	fmt.Fprintln(d.Writer, strings.TrimRight(row, " "))
+}
+
+// 执行结束: 停止刷新
+func (d *SceneProgress) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	d.clear()
+	return nil
+}
+
+// 按间隔刷新进度
+func (d *SceneProgress) loop(stop chan struct{}) {
+	interval := d.Interval
+	if interval <= 0 {
+		if d.TTY {
+			interval = DefaultProgressInterval
+		} else {
+			interval = DefaultProgressPlainInterval
+		}
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			d.lock.Lock()
+			// 等锁期间已Close时不再输出
+			if d.stop == stop {
+				d.render()
+			}
+			d.lock.Unlock()
+		}
+	}
+}
+
+// 输出进度: 终端中覆盖当前行, 否则输出一行
+func (d *SceneProgress) render() {
+	text := d.text()
+	if d.TTY {
+		fmt.Fprintf(d.Writer, "\r\x1b[K%s", text)
+		d.line = true
+	} else {
+		fmt.Fprintf(d.Writer, "[progress] %s\n", text)
+	}
+}
+
+// 清除终端中的进度行
+func (d *SceneProgress) clear() {
+	if d.TTY && d.line {
+		fmt.Fprint(d.Writer, "\r\x1b[K")
+		d.line = false
+	}
+}
+
+// 进度文本, 调用者持锁
+func (d *SceneProgress) text() string {
+	var (
+		b       strings.Builder
+		elapsed = time.Since(d.timeStart)
+	)
+	fmt.Fprintf(&b, "#%d/%d %s ", d.batch, d.batchMax, d.category)
+	if d.actions > 0 && d.batchRobot > 0 {
+		width := DefaultProgressWidth
+		done := d.finished * width / d.batchRobot
+		if done > width {
+			done = width
+		}
+		bar := strings.Repeat("=", done)
+		if done < width {
+			bar += ">" + strings.Repeat(" ", width-done-1)
+		}
+		fmt.Fprintf(&b, "[%s] %d/%d robots ", bar, d.finished, d.batchRobot)
+	} else {
+		fmt.Fprintf(&b, "%d robots ", d.batchRobot)
+	}
+	if d.timeEndLine.After(d.timeStart) {
+		fmt.Fprintf(&b, "%s/%s ", progressDuration(elapsed), progressDuration(d.timeEndLine.Sub(d.timeStart)))
+	} else {
+		fmt.Fprintf(&b, "%s ", progressDuration(elapsed))
+	}
+	fmt.Fprintf(&b, "conc %d p95 %s err %d", atomic.LoadInt64(&d.concurrency), progressDuration(d.getWindowP95()), d.fail)
+	if d.skip > 0 {
+		fmt.Fprintf(&b, " skip %d", d.skip)
+	}
+	return b.String()
+}
+
+// 最近样本的p95
+func (d *SceneProgress) getWindowP95() time.Duration {
+	if len(d.window) == 0 {
+		return 0
+	}
+	values := append([]time.Duration{}, d.window...)
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values[(len(values)-1)*95/100]
+}
+
+// 状态名
+func progressStatus(status int) string {
+	switch status {
+	case SceneStatusNormal:
+		return "ok"
+	case SceneStatusFailBreak:
+		return "error"
+	case SceneStatusFailPerf:
+		return "perf"
+	case SceneStatusBatchMax:
+		return "done"
+	case SceneStatusStop:
+		return "stopped"
+	case SceneStatusBreak:
+		return "breaker"
+	case SceneStatusInterrupt:
+		return "interrupted"
+	}
+	return fmt.Sprint(status)
+}
+
+// 时长, 保留3位有效数字
+func progressDuration(v time.Duration) string {
+	switch {
+	case v <= 0:
+		return "0s"
+	case v < time.Millisecond:
+		return fmt.Sprintf("%.3gus", float64(v)/float64(time.Microsecond))
+	case v < time.Second:
+		return fmt.Sprintf("%.3gms", float64(v)/float64(time.Millisecond))
+	case v >= time.Second*100:
+		return fmt.Sprintf("%.0fs", v.Seconds())
+	}
+	return fmt.Sprintf("%.3gs", v.Seconds())
+}
+
+// 截断过长的文本
+func progressText(s string, n int) string {
+	s = strings.Replace(s, "\n", " ", -1)
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
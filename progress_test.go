@@ -0,0 +1,72 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试终端进度与非终端时的纯文本输出
+func Test_SceneProgress(t *testing.T) {
+	as := require.New(t)
+	for _, tty := range []bool{false, true} {
+		robot := NewRobot(&Robot{Name: "robot"})
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "login",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				time.Sleep(time.Millisecond * time.Duration(10+u.Serial*10))
+				if u.Serial == 1 {
+					err = fmt.Errorf("robot 1")
+				}
+				return
+			},
+		})))
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "home"})))
+		var (
+			buf   = new(bytes.Buffer)
+			scene = NewScene(&Scene{Name: "progress", DefaultRobot: robot})
+		)
+		scene.Log.SetLevel(2)
+		progress := NewSceneProgress(scene, buf)
+		as.False(progress.TTY)
+		progress.TTY = tty
+		progress.Interval = time.Millisecond * 5
+		_, err := scene.RunSurge(&FormSurge{NumInit: 4, BatchMax: 2, PeriodScene: 200}, nil)
+		as.Nil(err)
+
+		text := buf.String()
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		if tty {
+			// 进度行被覆盖, 最终只留下轮次表
+			as.Contains(text, "\r\x1b[K#1/2 surge [")
+			as.NotContains(text, "[progress]")
+			as.Len(lines, 3, text)
+		} else {
+			as.Contains(text, "[progress] #1/2 surge [")
+			as.Contains(text, "/4 robots ")
+			as.Contains(text, "/200ms conc ")
+			as.NotContains(text, "\r")
+		}
+		as.Contains(text, "4/4 robots")
+		as.Regexp(`err [1-9]`, text)
+
+		// 轮次表
+		var table []string
+		for _, line := range lines {
+			if i := strings.LastIndex(line, "\r\x1b[K"); i >= 0 {
+				line = line[i+len("\r\x1b[K"):]
+			}
+			if !strings.HasPrefix(line, "[progress]") && len(line) > 0 {
+				table = append(table, line)
+			}
+		}
+		as.Len(table, 3, text)
+		as.True(strings.HasPrefix(table[0], "batch"))
+		as.Regexp(`^1/2 +4 ok +`, table[1])
+		as.Regexp(`^2/2 +4 done +.* 25\.00  robot 1$`, table[2])
+	}
+}
@@ -0,0 +1,53 @@
+package box
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// 内置动作类型
+const (
+	PlanActionReplay = "replay" // 回放日志中的http请求
+)
+
+// 回放日志格式
+const (
+	ReplayFormatCombined = "combined" // nginx/apache combined或common日志
+	ReplayFormatJsonl    = "jsonl"    // 每行一个json请求, 见ReplayRecord
+)
+
+const (
+	ReplayVar               = "replay"            // 机器人变量: 当前回放的请求*ReplayRecord, 模板中可引用 {{.Var.replay.Url}}
+	actionReplayStoreClient = "box-replay-client" // 机器人私有存储: 回放用http客户端
+	replayLineMax           = 1 << 20             // 单行最大长度
+)
+
+var (
+	// combined: 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://ref/" "Mozilla/4.08"
+	regReplayCombined = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}|-) (\S+)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+)
+
+// 一条要回放的请求
+type ReplayRecord struct {
+	Time   time.Time         `json:"time"`   // 原始请求时间, jsonl中可为RFC3339文本或unix秒数
+	Method string            `json:"method"` // 请求方法, 默认GET
+	Url    string            `json:"url"`    // 请求路径或完整地址
+	Header map[string]string `json:"header"` // 请求头
+	Body   string            `json:"body"`   // 请求内容
+	Status int               `json:"status"` // 原始返回状态码, 0:未知
+	//
+	Offset time.Duration `json:"-"` // 相对第一条请求的时间
+	Line   int           `json:"-"` // 所在行
+}
+
+// 回放http请求动作: 执行机器人变量ReplayVar中的请求, 不跟随跳转
+type ActionReplay struct {
+	Name    string            `json:"name" yaml:"name"`       // 动作命名
+	Target  string            `json:"target" yaml:"target"`   // 目标地址, 如http://127.0.0.1:8080, 替换日志中的协议与域名; 为空时日志中须为完整地址
+	Header  map[string]string `json:"header" yaml:"header"`   // 追加的请求头
+	Timeout int64             `json:"timeout" yaml:"timeout"` // 请求超时,单位毫秒, 0:不超时
+	Status  bool              `json:"status" yaml:"status"`   // true: 返回状态码须与日志一致 false: 小于400即成功
+	//
+	Transport http.RoundTripper `json:"-" yaml:"-"` // 共用的传输层, 默认http.DefaultTransport
+}
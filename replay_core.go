@@ -0,0 +1,538 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterAction(PlanActionReplay, func(act *PlanAction) (ret Action, err error) {
+		d := new(ActionReplay)
+		if err = act.Decode(d); err != nil {
+			return
+		}
+		d.Name = act.Name
+		return NewActionReplay(d)
+	})
+}
+
+// 读取回放日志
+func LoadReplay(logPath string, format string) (ret []*ReplayRecord, err error) {
+	var f *os.File
+	if f, err = os.Open(logPath); err != nil {
+		return
+	}
+	defer f.Close()
+	return ParseReplay(f, format)
+}
+
+// 解析回放日志, 按时间排序并计算相对时间; 请求行无法识别的记录(如"-")跳过
+func ParseReplay(r io.Reader, format string) (ret []*ReplayRecord, err error) {
+	var (
+		scanner = bufio.NewScanner(r)
+		line    = 0
+	)
+	scanner.Buffer(make([]byte, 64<<10), replayLineMax)
+	for scanner.Scan() {
+		line += 1
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+		if len(format) == 0 {
+			// 按首行识别
+			if strings.HasPrefix(text, "{") {
+				format = ReplayFormatJsonl
+			} else {
+				format = ReplayFormatCombined
+			}
+		}
+		var rec *ReplayRecord
+		switch format {
+		case ReplayFormatCombined:
+			rec, err = parseReplayCombined(text)
+		case ReplayFormatJsonl:
+			rec, err = parseReplayJson(text)
+		default:
+			return nil, contrib.ErrParamInvalid.SetVars("format")
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`replay line %d: %v`, line, err)
+		}
+		if rec != nil {
+			rec.Line = line
+			ret = append(ret, rec)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(ret) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("replay: no record")
+	}
+	SortReplay(ret)
+	return
+}
+
+// 按时间排序并计算相对第一条请求的时间
+func SortReplay(data []*ReplayRecord) {
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Time.Before(data[j].Time)
+	})
+	for _, d := range data {
+		d.Offset = d.Time.Sub(data[0].Time)
+	}
+}
+
+// 解析一行combined/common日志
+func parseReplayCombined(text string) (ret *ReplayRecord, err error) {
+	m := regReplayCombined.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf(`not a combined log`)
+	}
+	ret = &ReplayRecord{Header: map[string]string{}}
+	if ret.Time, err = time.Parse("02/Jan/2006:15:04:05 -0700", m[3]); err != nil {
+		return nil, err
+	}
+	req := strings.Fields(replayUnquote(m[4]))
+	if len(req) < 2 {
+		// 无效请求, 如 "-" 或探测报文
+		return nil, nil
+	}
+	ret.Method = req[0]
+	ret.Url = req[1]
+	ret.Status, _ = strconv.Atoi(m[5])
+	if ref := replayUnquote(m[7]); len(ref) > 0 && ref != "-" {
+		ret.Header["Referer"] = ref
+	}
+	if ua := replayUnquote(m[8]); len(ua) > 0 && ua != "-" {
+		ret.Header["User-Agent"] = ua
+	}
+	return
+}
+
+// 解析一行json日志
+func parseReplayJson(text string) (ret *ReplayRecord, err error) {
+	var raw struct {
+		ReplayRecord
+		Time interface{} `json:"time"`
+	}
+	if err = json.Unmarshal([]byte(text), &raw); err != nil {
+		return
+	}
+	ret = &raw.ReplayRecord
+	switch v := raw.Time.(type) {
+	case string:
+		if ret.Time, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, err
+		}
+	case float64:
+		if v > 1e12 {
+			// 毫秒
+			v /= 1000
+		}
+		ret.Time = time.Unix(0, int64(v*float64(time.Second)))
+	default:
+		return nil, contrib.ErrParamInvalid.SetVars("time")
+	}
+	if len(ret.Url) == 0 {
+		return nil, contrib.ErrParamInvalid.SetVars("url")
+	}
+	return
+}
+
+// 还原日志中转义的引号
+func replayUnquote(s string) string {
+	if strings.Contains(s, `\`) {
+		if v, err := strconv.Unquote(`"` + s + `"`); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// 取机器人当前回放的请求
+func GetReplayRecord(u *Robot) (ret *ReplayRecord) {
+	ret, _ = u.GetVar(ReplayVar).(*ReplayRecord)
+	return
+}
+
+// 创建回放动作
+func NewActionReplay(s *ActionReplay) (d *ActionReplay, err error) {
+	if s != nil {
+		d = s
+	} else {
+		d = new(ActionReplay)
+	}
+	if len(d.Target) > 0 {
+		if _, err = url.Parse(d.Target); err != nil {
+			return nil, contrib.ErrParamInvalid.SetVars("target")
+		}
+		d.Target = strings.TrimSuffix(d.Target, "/")
+	}
+	return
+}
+
+// 发出当前回放的请求
+func (d *ActionReplay) Run(u *Robot, step, batch int) (ret interface{}, err error) {
+	var (
+		rec    = GetReplayRecord(u)
+		addr   string
+		method string
+		req    *http.Request
+		resp   *http.Response
+		result = new(ActionHttpResult)
+	)
+	if rec == nil {
+		return nil, contrib.ErrParamUndefined.SetVars(ReplayVar)
+	}
+	if addr, err = d.GetUrl(rec); err != nil {
+		return
+	}
+	if method = strings.ToUpper(rec.Method); len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	// 请求
+	ctx := u.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	if req, err = http.NewRequest(method, addr, strings.NewReader(rec.Body)); err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	for k, v := range rec.Header {
+		req.Header.Set(k, v)
+	}
+	for k, v := range d.Header {
+		req.Header.Set(k, v)
+	}
+	if resp, err = d.GetClient(u).Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Header = resp.Header
+	if _, err = io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return
+	}
+	ret = result
+
+	// 状态码
+	if d.Status && rec.Status > 0 {
+		if resp.StatusCode != rec.Status {
+			err = &ErrorHttpStatus{StatusCode: resp.StatusCode, Method: method, Url: addr}
+		}
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		err = &ErrorHttpStatus{StatusCode: resp.StatusCode, Method: method, Url: addr}
+	}
+	return
+}
+
+//
+func (d *ActionReplay) RunBefore(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionReplay) RunAfter(u *Robot, step, batch int) (err error) {
+	return
+}
+
+//
+func (d *ActionReplay) GetName() (ret string) {
+	return d.Name
+}
+
+// 取请求地址: 设置了Target时替换协议与域名
+func (d *ActionReplay) GetUrl(rec *ReplayRecord) (ret string, err error) {
+	if len(d.Target) == 0 {
+		return rec.Url, nil
+	}
+	var u *url.URL
+	if u, err = url.Parse(rec.Url); err != nil {
+		return
+	}
+	ret = d.Target + u.RequestURI()
+	return
+}
+
+// 取机器人的回放客户端, 不跟随跳转: 日志中跳转后的请求另有记录
+func (d *ActionReplay) GetClient(u *Robot) (ret *http.Client) {
+	return u.GetStore(actionReplayStoreClient, func() interface{} {
+		return &http.Client{
+			Transport: d.Transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}).(*http.Client)
+}
+
+// 运行日志回放
+func (s *Scene) runReplay(form *FormReplay, cache chan *ResultScene) (ret []*ResultScene, err error) {
+	var formScene *FormScene
+	if formScene, err = form.GetForm(); err != nil {
+		return
+	}
+	if err = s.initDefaultRobot(); err != nil {
+		return
+	}
+	s.resetControl()
+	s.initSeed()
+	s.Breaker.reset()
+	records := form.Records
+	if len(records) == 0 {
+		if records, err = LoadReplay(form.Path, form.Format); err != nil {
+			return
+		}
+	} else {
+		SortReplay(records)
+	}
+
+	//
+	var (
+		speed       = form.GetSpeed()            // 倍速
+		periodScene = formScene.GetPeriodScene() // 每轮的日志时间跨度
+		numRobot    = formScene.NumInit          // 机器人池大小
+		//
+		data        []*ResultScene                // 测试报告
+		batches     [][]*ReplayRecord             // 按日志时间分轮
+		pool        []*Robot                      // 机器人池
+		idle        = make(chan *Robot, numRobot) // 空闲的机器人
+		slots       = &clockSem{size: numRobot}   // 空闲机器人的名额, 取得后idle中必有机器人
+		lastError   error                         // 最后一个错误
+		concurrency concurrencyCounter            // 并发计数
+		fnAt        = func(offset time.Duration) (ret time.Duration) { return time.Duration(float64(offset) / speed) }
+	)
+	sink := s.newSink(cache)
+	defer s.closeSink(sink)
+	sig := s.watchSignal(sink)
+	defer sig.close()
+	count := func(add int64) {
+		concurrency.add(add)
+		sink.OnConcurrency(add)
+	}
+
+	// 分轮: 跳过没有请求的时间段
+	for i, rec := range records {
+		if i == 0 || (periodScene > 0 && rec.Offset/periodScene != records[i-1].Offset/periodScene) {
+			batches = append(batches, nil)
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], rec)
+	}
+	if formScene.BatchMax > 0 && len(batches) > formScene.BatchMax {
+		batches = batches[:formScene.BatchMax]
+	}
+	formScene.BatchMax = len(batches)
+
+	// log打印运行前参数
+	s.Log.Infof(`[scene-run] params: %v speed: %v records: %d`, PubJsonMust(formScene), speed, len(records))
+
+	// 执行与统计
+	if s.FnBefore != nil {
+		if err = s.FnBefore(s); err != nil {
+			return
+		}
+	}
+
+	// 机器人池
+	for i := 0; i < numRobot; i++ {
+		robot, _err := s.DefaultRobot.Copy()
+		if _err != nil {
+			err = _err
+			return
+		}
+		robot.Serial = i
+		robot.Rand = s.newRand(0, int64(i))
+		robot.ResultArray = make([]*RobotActionResult, len(robot.ActionArray))
+		pool = append(pool, robot)
+		idle <- robot
+	}
+	defer func() {
+		for i, robot := range pool {
+			if _err := robot.Close(); _err != nil {
+				s.Log.Warnf(`[robot-close] replay %d/%d`, i+1, numRobot)
+			}
+		}
+	}()
+	clock := s.GetClock()
+	clockAdd(clock, 1) // 主协程参与虚拟时钟的推进, 见ClockFake.Add
+	defer clockAdd(clock, -1)
+	origin := clock.Now() // 第一条请求的计划发出时间
+	for batch, recs := range batches {
+		var (
+			report = &ResultScene{
+				// 执行参数
+				Category:    formScene.Category,
+				FailBreak:   formScene.FailBreak,
+				FailFast:    formScene.FailFast,
+				BatchMax:    formScene.BatchMax,
+				NumInit:     formScene.NumInit,
+				PeriodScene: formScene.PeriodScene,
+				Seed:        s.seed,
+				// 本轮统计
+				Scene:      s.Name,
+				Batch:      batch + 1,
+				BatchRobot: numRobot,
+				ReplayNum:  len(recs),
+				// 其它
+				Params: formScene,
+			}
+			units = make([][]*RobotActionResult, len(recs)) // 每条请求的动作结果
+			lags  = make([]time.Duration, len(recs))        // 每条请求落后于计划的时间
+			wg    sync.WaitGroup
+		)
+
+		// 上轮统计
+		if len(data) > 0 {
+			report.LastFailRate = data[len(data)-1].FailRate
+			report.LastPerfAvg = data[len(data)-1].PerfTimeAvg
+			report.LastPerf90Avg = data[len(data)-1].PerfTime90Avg
+		}
+
+		// 运行测试
+		report.TimeStart = clock.Now()
+		report.BatchText = fmt.Sprintf(`#%d. %s`, batch+1, report.TimeStart.Format("15:04:05"))
+		if periodScene > 0 {
+			report.TimeEndLine = origin.Add(fnAt((recs[0].Offset/periodScene + 1) * periodScene))
+		} else {
+			report.TimeEndLine = origin.Add(fnAt(recs[len(recs)-1].Offset))
+		}
+		s.Log.Infof(`[scene-run-%s] #%d/%d %dreq start %s`, report.Category, report.Batch, report.BatchMax,
+			report.ReplayNum, PubTimeToStr(report.TimeStart))
+		sink.OnBatchStart(report)
+		sig.begin(report)
+		s.monitor.begin()
+		for _i, _rec := range recs {
+			idx := _i
+			rec := _rec
+			at := origin.Add(fnAt(rec.Offset))
+			s.sleepControl(clock, at.Sub(clock.Now()))
+			if s.waitControl(clock) {
+				// 已停止: 不再发出之后的请求
+				units, lags, report.ReplayNum = units[:idx], lags[:idx], idx
+				break
+			}
+			slots.acquire(clock, nil) // 池中没有空闲机器人时等待, 计入落后时间
+			robot := <-idle
+			lags[idx] = clock.Now().Sub(at)
+			wg.Add(1)
+			clockAdd(clock, 1)
+			go func() {
+				defer wg.Done()
+				defer clockAdd(clock, -1)
+				defer slots.release(clock)
+				defer func() { idle <- robot }()
+				defer PanicRecover(s.Log)
+
+				robot.SetVar(ReplayVar, rec)
+				robot.Batch = batch
+				robot.TimeSpent = 0
+				robot.TimeCreate = clock.Now()
+				for i := range robot.ResultArray {
+					robot.ResultArray[i] = nil
+				}
+				s.runRobot(robot, batch, formScene.FailFast, sink, count, nil)
+				units[idx] = append([]*RobotActionResult{}, robot.ResultArray...)
+			}()
+		}
+		clockAdd(clock, -1)
+		wg.Wait()
+		clockAdd(clock, 1)
+		report.Generator = s.monitor.end()
+		if len(units) == 0 && s.IsStopped() {
+			// 轮间已停止: 本轮未发出请求, 不再输出
+			s.markStopped(data, sink, sig)
+			break
+		}
+
+		// 本轮统计: 耗时
+		report.TimeEnd = clock.Now()
+		report.TimeRun = report.TimeEnd.Sub(report.TimeStart)
+
+		// 本轮统计: 统计动作
+		if len(data) > 0 {
+			report.statUnits(units, data[len(data)-1])
+		} else {
+			report.statUnits(units, nil)
+		}
+		report.statActions(s.DefaultRobot.ActionArray, units)
+
+		// 本轮统计: 落后时间
+		if len(lags) == 0 {
+			lags = append(lags, 0)
+		}
+		sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+		total := time.Duration(0)
+		for _, d := range lags {
+			total += d
+		}
+		report.ReplayLagAvg = total / time.Duration(len(lags))
+		report.ReplayLag90 = lags[int(float64(len(lags)-1)*0.9)]
+		report.ReplayLagMax = lags[len(lags)-1]
+
+		// 本轮统计: 并发与错误
+		report.Concurrency = concurrency.takeMax()
+		if lastError = lastUnitError(units); lastError != nil {
+			report.ErrText = lastError.Error()
+		}
+
+		// 统计完成
+		data = append(data, report)
+
+		// 退出条件0: 手动停止
+		if s.IsStopped() {
+			report.Status = s.getStopStatus()
+			report.Reason = s.GetStopReason()
+		}
+		// 退出条件1: 出现了错误
+		if report.Status == SceneStatusNormal && lastError != nil && formScene.FailBreak {
+			s.Log.Errorf(`[scene-break] #%d failsRate:%.4f%% lastErr: %v`, batch+1, report.FailRate*100, lastError)
+			report.Status = SceneStatusFailBreak
+		}
+		// 退出条件2: 回放完成
+		if report.Status == SceneStatusNormal && batch >= len(batches)-1 {
+			report.Status = SceneStatusBatchMax
+		}
+
+		// 统计输出
+		sink.OnBatch(report)
+		sig.done(report)
+
+		// 退出
+		if report.Status != SceneStatusNormal {
+			break
+		}
+		lastError = nil
+	}
+	if s.FnAfter != nil {
+		if err = s.FnAfter(s); err != nil {
+			return
+		}
+	}
+
+	// finish
+	ret = data
+	return
+}
@@ -0,0 +1,150 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试日志解析
+func Test_ReplayParse(t *testing.T) {
+	as := require.New(t)
+
+	// combined/common
+	data, err := ParseReplay(strings.NewReader(`
+127.0.0.1 - - [10/Oct/2000:13:55:37 -0700] "POST /login HTTP/1.1" 302 0 "http://a.test/" "Mozilla/5.0 \"x\""
+127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a.gif?x=1 HTTP/1.0" 200 2326
+127.0.0.1 - - [10/Oct/2000:13:55:38 -0700] "-" 400 0 "-" "-"
+`), "")
+	as.Nil(err)
+	as.Len(data, 2)
+	as.Equal("/a.gif?x=1", data[0].Url)
+	as.Equal(200, data[0].Status)
+	as.Equal("POST", data[1].Method)
+	as.Equal(time.Second, data[1].Offset)
+	as.Equal(`Mozilla/5.0 "x"`, data[1].Header["User-Agent"])
+	as.Equal("http://a.test/", data[1].Header["Referer"])
+
+	// jsonl
+	data, err = ParseReplay(strings.NewReader(`{"time":"2019-10-01T10:00:00.5Z","method":"PUT","url":"/b","body":"{}"}
+{"time":1569924000,"url":"/a"}
+`), "")
+	as.Nil(err)
+	as.Len(data, 2)
+	as.Equal("/a", data[0].Url)
+	as.Equal(500*time.Millisecond, data[1].Offset)
+
+	// 错误行
+	_, err = ParseReplay(strings.NewReader("not a log"), ReplayFormatCombined)
+	as.NotNil(err)
+}
+
+// 测试回放: 按倍速调度, 机器人池不足时记录落后时间
+func Test_ReplayScene(t *testing.T) {
+	as := require.New(t)
+	var (
+		lock  sync.Mutex
+		paths []string
+		start = time.Now()
+		times []time.Duration
+	)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		times = append(times, time.Since(start))
+		lock.Unlock()
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	base := time.Now()
+	var records []*ReplayRecord
+	for i, p := range []string{"/a?i=0", "/a?i=1", "/missing", "/a?i=3"} {
+		records = append(records, &ReplayRecord{Time: base.Add(time.Duration(i) * 200 * time.Millisecond), Url: "http://prod.test" + p, Status: 200})
+	}
+	act, err := NewActionReplay(&ActionReplay{Name: "replay", Target: svr.URL})
+	as.Nil(err)
+	robot := NewRobot(&Robot{Name: "replay"})
+	as.Nil(robot.AddAction(act))
+	scene := NewScene(&Scene{DefaultRobot: robot})
+	scene.Log.SetLevel(2)
+
+	// 两倍速, 每400ms日志时间为一轮
+	start = time.Now()
+	ret, err := scene.RunReplay(&FormReplay{Records: records, Speed: 2, PeriodScene: 400}, nil)
+	as.Nil(err)
+	as.Len(ret, 2)
+	as.Equal([]string{"/a?i=0", "/a?i=1", "/missing", "/a?i=3"}, paths)
+	as.True(times[3] >= 300*time.Millisecond && times[3] < 450*time.Millisecond, times[3])
+	as.Equal(2, ret[0].ReplayNum)
+	as.Equal(0.0, ret[0].FailRate)
+	as.Equal(0.5, ret[1].FailRate)
+	as.Contains(ret[1].ErrText, "404")
+	as.Equal(SceneStatusBatchMax, ret[1].Status)
+	as.True(ret[1].ReplayLagMax < 50*time.Millisecond, ret[1].ReplayLagMax)
+
+	// 轮间停止: 不再开始新的一轮
+	var (
+		cache    = make(chan *ResultScene)
+		received []*ResultScene
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range cache {
+			if len(received) == 0 {
+				scene.Stop("between")
+			}
+			received = append(received, r)
+		}
+	}()
+	ret, err = scene.RunReplay(&FormReplay{Records: records, PeriodScene: 400}, cache)
+	as.Nil(err)
+	close(cache)
+	wg.Wait()
+	as.Len(ret, 1)
+	as.Equal(SceneStatusStop, ret[0].Status)
+	as.Equal("between", ret[0].Reason)
+	as.Equal(2, ret[0].ReplayNum)
+	as.Len(received, 2)
+	as.Equal(1, received[1].Batch)
+
+	// FnBefore中停止: 不发出请求
+	lock.Lock()
+	sent := len(paths)
+	lock.Unlock()
+	scene.FnBefore = func(s *Scene) (err error) {
+		s.Stop("before")
+		return
+	}
+	ret, err = scene.RunReplay(&FormReplay{Records: records}, nil)
+	as.Nil(err)
+	as.Len(ret, 0)
+	lock.Lock()
+	as.Len(paths, sent)
+	lock.Unlock()
+	scene.FnBefore = nil
+
+	// 一个机器人, 同时到达的慢请求依次落后
+	records = records[:0]
+	for i := 0; i < 3; i++ {
+		records = append(records, &ReplayRecord{Time: base, Url: "/slow"})
+	}
+	ret, err = scene.RunReplay(&FormReplay{Records: records, Robots: 1}, nil)
+	as.Nil(err)
+	as.Len(ret, 1)
+	as.EqualValues(1, ret[0].Concurrency)
+	as.True(ret[0].ReplayLagMax >= 200*time.Millisecond, ret[0].ReplayLagMax)
+	as.True(ret[0].ReplayLagAvg >= 100*time.Millisecond, ret[0].ReplayLagAvg)
+}
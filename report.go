@@ -0,0 +1,62 @@
+package box
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// 报告格式版本, 字段有不兼容变化时递增
+const ReportVersion = 1
+
+// 报告格式
+const (
+	ReportFormatJson  = "json"  // 带版本的完整报告
+	ReportFormatCsv   = "csv"   // 每轮一行, 含各动作耗时列
+	ReportFormatJunit = "junit" // JUnit XML, 每轮一个用例, 供CI展示
+	ReportFormatHtml  = "html"  // 独立网页, 含耗时与吞吐图表
+)
+
+// 报告结论
+const (
+	ReportVerdictPass = "pass" // 通过
+	ReportVerdictFail = "fail" // 不通过
+)
+
+// 完整测试报告
+type Report struct {
+	Version   int            `json:"version"`   // 报告格式版本 ReportVersion
+	Name      string         `json:"name"`      // 场景名
+	Category  string         `json:"category"`  // 测试类型
+	Params    *FormScene     `json:"params"`    // 执行参数
+	TimeStart time.Time      `json:"timeStart"` // 开始时间
+	TimeEnd   time.Time      `json:"timeEnd"`   // 结束时间
+	Status    int            `json:"status"`    // 最后一轮的场景状态
+	Verdict   string         `json:"verdict"`   // 结论 pass|fail
+	Reason    string         `json:"reason"`    // 不通过的原因
+	Batches   []*ReportBatch `json:"batches"`   // 每轮结果
+}
+
+// 报告中的一轮结果
+type ReportBatch struct {
+	*ResultScene
+	Throughput float64                 `json:"throughput"` // 每秒完成的动作数
+	Actions    []*ResultCapacityAction `json:"actions"`    // 各动作统计
+	Error      string                  `json:"error"`      // 本轮未通过阀值的原因
+}
+
+// 报告写入函数
+type ReportWriter func(d *Report, w io.Writer) (err error)
+
+var (
+	reportWriters     = map[string]ReportWriter{} // 已注册的报告格式
+	reportWritersLock sync.RWMutex                //
+	// 文件扩展名对应的报告格式
+	reportExts = map[string]string{
+		".json": ReportFormatJson,
+		".csv":  ReportFormatCsv,
+		".xml":  ReportFormatJunit,
+		".html": ReportFormatHtml,
+		".htm":  ReportFormatHtml,
+	}
+)
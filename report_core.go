@@ -0,0 +1,181 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterReportFormat(ReportFormatJson, (*Report).WriteJson)
+	RegisterReportFormat(ReportFormatCsv, (*Report).WriteCsv)
+	RegisterReportFormat(ReportFormatJunit, (*Report).WriteJunit)
+	RegisterReportFormat(ReportFormatHtml, (*Report).WriteHtml)
+}
+
+// 注册报告格式, 同名格式将被覆盖
+func RegisterReportFormat(format string, fn ReportWriter) {
+	reportWritersLock.Lock()
+	reportWriters[format] = fn
+	reportWritersLock.Unlock()
+}
+
+// 由测试结果生成报告, 未给出阀值时以场景状态判断结论: 出现错误而中断即不通过
+func NewReport(name string, data []*ResultScene) (ret *Report) {
+	ret = &Report{
+		Version: ReportVersion,
+		Name:    name,
+		Verdict: ReportVerdictPass,
+	}
+	for _, r := range data {
+		b := &ReportBatch{ResultScene: r, Actions: r.ActionArray, Throughput: r.GetThroughput()}
+		ret.Batches = append(ret.Batches, b)
+	}
+	if len(data) > 0 {
+		first, last := data[0], data[len(data)-1]
+		ret.Category = first.Category
+		ret.Params = first.Params
+		ret.TimeStart = first.TimeStart
+		ret.TimeEnd = last.TimeEnd
+		ret.Status = last.Status
+		if last.Status == SceneStatusFailBreak {
+			ret.SetVerdict(fmt.Errorf(`#%d status %d: %s`, last.Batch, last.Status, last.ErrText))
+		} else if last.Status == SceneStatusBreak || last.Status == SceneStatusInterrupt {
+			ret.SetVerdict(fmt.Errorf(`#%d status %d: %s`, last.Batch, last.Status, last.Reason))
+		}
+	} else {
+		ret.SetVerdict(fmt.Errorf(`no result`))
+	}
+	return
+}
+
+// 读取json报告
+func LoadReport(reportPath string) (ret *Report, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(reportPath); err != nil {
+		return
+	}
+	ret = new(Report)
+	if err = json.Unmarshal(b, ret); err != nil {
+		return nil, contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`report "%s": %v`, reportPath, err))
+	}
+	if ret.Version > ReportVersion {
+		return nil, contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`report version %d`, ret.Version))
+	}
+	return
+}
+
+// 取各轮结果, 含各动作统计
+func (d *Report) GetData() (ret []*ResultScene) {
+	for _, b := range d.Batches {
+		if b.ResultScene == nil {
+			continue
+		}
+		b.ResultScene.ActionArray = b.Actions
+		b.ResultScene.Params = d.Params
+		ret = append(ret, b.ResultScene)
+	}
+	return
+}
+
+// 设置结论, err为空即通过
+func (d *Report) SetVerdict(err error) {
+	if err != nil {
+		d.Verdict = ReportVerdictFail
+		d.Reason = err.Error()
+	} else {
+		d.Verdict = ReportVerdictPass
+		d.Reason = ""
+	}
+}
+
+// 是否通过
+func (d *Report) IsPass() bool {
+	return d.Verdict == ReportVerdictPass
+}
+
+// 按格式写入
+func (d *Report) Write(w io.Writer, format string) (err error) {
+	reportWritersLock.RLock()
+	fn := reportWriters[format]
+	reportWritersLock.RUnlock()
+	if fn == nil {
+		return contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`report format "%s"`, format))
+	}
+	return fn(d, w)
+}
+
+// 保存到文件, 按扩展名选择格式: .json .csv .xml(junit) .html
+func (d *Report) Save(reportPath string) (err error) {
+	format, ok := reportExts[strings.ToLower(filepath.Ext(reportPath))]
+	if !ok {
+		return contrib.ErrParamInvalid.SetVars(fmt.Sprintf(`report "%s"`, reportPath))
+	}
+	var f *os.File
+	if f, err = os.Create(reportPath); err != nil {
+		return
+	}
+	if err = d.Write(f, format); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// 写入带版本的json
+func (d *Report) WriteJson(w io.Writer) (err error) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// 写入csv, 每轮一行, 耗时单位毫秒; 之后每个动作追加 次数/错误率/平均/p90/p99 五列
+func (d *Report) WriteCsv(w io.Writer) (err error) {
+	var (
+		c    = csv.NewWriter(w)
+		head = []string{"batch", "batchText", "robots", "status", "timeStart", "timeRun", "concurrency",
+			"failRate", "throughput", "tpsAvg", "tps90Avg", "perfTimeAvg", "perfTime90Avg", "perfLossRate",
+			"respFastest", "respSlowest", "replayLag90", "error", "errText"}
+		fnMs = func(v interface{ Seconds() float64 }) string {
+			return strconv.FormatFloat(v.Seconds()*1000, 'f', 3, 64)
+		}
+		fnFloat = func(v float64) string {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	)
+	if len(d.Batches) > 0 {
+		for _, a := range d.Batches[0].Actions {
+			for _, col := range []string{"count", "failRate", "timeAvg", "timeP90", "timeP99"} {
+				head = append(head, a.Name+"."+col)
+			}
+		}
+	}
+	if err = c.Write(head); err != nil {
+		return
+	}
+	for _, b := range d.Batches {
+		row := []string{
+			strconv.Itoa(b.Batch), b.BatchText, strconv.Itoa(b.BatchRobot), strconv.Itoa(b.Status),
+			b.TimeStart.Format("2006-01-02 15:04:05.000"), fnMs(b.TimeRun), strconv.FormatInt(b.Concurrency, 10),
+			fnFloat(b.FailRate), fnFloat(b.Throughput), fnFloat(b.TpsAvg), fnFloat(b.Tps90Avg),
+			fnMs(b.PerfTimeAvg), fnMs(b.PerfTime90Avg), fnFloat(b.PerfLossRate),
+			fnMs(b.RespFastest), fnMs(b.RespSlowest), fnMs(b.ReplayLag90), b.Error, b.ErrText,
+		}
+		for _, a := range b.Actions {
+			row = append(row, strconv.Itoa(a.Count), fnFloat(a.FailRate), fnMs(a.TimeAvg), fnMs(a.TimeP90), fnMs(a.TimeP99))
+		}
+		if err = c.Write(row); err != nil {
+			return
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,271 @@
+package box
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+)
+
+// 图表尺寸
+const (
+	reportChartWidth  = 640
+	reportChartHeight = 260
+	reportChartLeft   = 56
+	reportChartRight  = 16
+	reportChartTop    = 16
+	reportChartBottom = 36
+)
+
+// 图表配色, 按序列循环使用
+var reportChartColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"}
+
+// 一张折线图, 坐标已换算为svg像素
+type reportChart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Width  int
+	Height int
+	Left   int
+	Bottom int
+	Right  int
+	Top    int
+	Series []*reportSeries
+	XTicks []*reportTick
+	YTicks []*reportTick
+}
+type reportSeries struct {
+	Name   string
+	Color  string
+	Points string // polyline坐标 "x,y x,y"
+	Dots   []*reportTick
+}
+type reportTick struct {
+	X     float64
+	Y     float64
+	Label string
+}
+
+// 生成折线图, xs为横轴取值, 每个序列的取值与xs一一对应
+func newReportChart(title, xLabel, yLabel string, xs []float64, names []string, values [][]float64) (ret *reportChart) {
+	ret = &reportChart{
+		Title:  title,
+		XLabel: xLabel,
+		YLabel: yLabel,
+		Width:  reportChartWidth,
+		Height: reportChartHeight,
+		Left:   reportChartLeft,
+		Right:  reportChartWidth - reportChartRight,
+		Top:    reportChartTop,
+		Bottom: reportChartHeight - reportChartBottom,
+	}
+	var (
+		xMin, xMax = math.Inf(1), math.Inf(-1)
+		yMax       = 0.0
+	)
+	for _, x := range xs {
+		xMin = math.Min(xMin, x)
+		xMax = math.Max(xMax, x)
+	}
+	for _, vals := range values {
+		for _, v := range vals {
+			yMax = math.Max(yMax, v)
+		}
+	}
+	if len(xs) == 0 {
+		return
+	}
+	if yMax <= 0 {
+		yMax = 1
+	}
+	yMax *= 1.1
+	fnX := func(x float64) float64 {
+		if xMax == xMin {
+			return float64(ret.Left+ret.Right) / 2
+		}
+		return float64(ret.Left) + (x-xMin)/(xMax-xMin)*float64(ret.Right-ret.Left)
+	}
+	fnY := func(y float64) float64 {
+		return float64(ret.Bottom) - y/yMax*float64(ret.Bottom-ret.Top)
+	}
+
+	// 刻度
+	step := 1
+	if len(xs) > 10 {
+		step = (len(xs) + 9) / 10
+	}
+	for i := 0; i < len(xs); i += step {
+		ret.XTicks = append(ret.XTicks, &reportTick{X: fnX(xs[i]), Y: float64(ret.Bottom), Label: reportNum(xs[i])})
+	}
+	for i := 0; i <= 4; i++ {
+		v := yMax / 4 * float64(i)
+		ret.YTicks = append(ret.YTicks, &reportTick{X: float64(ret.Left), Y: fnY(v), Label: reportNum(v)})
+	}
+
+	// 序列
+	for i, vals := range values {
+		s := &reportSeries{Name: names[i], Color: reportChartColors[i%len(reportChartColors)]}
+		var pts []string
+		for j, v := range vals {
+			if j >= len(xs) {
+				break
+			}
+			x, y := fnX(xs[j]), fnY(v)
+			pts = append(pts, fmt.Sprintf(`%.1f,%.1f`, x, y))
+			s.Dots = append(s.Dots, &reportTick{X: x, Y: y, Label: fmt.Sprintf(`%s: %s`, names[i], reportNum(v))})
+		}
+		s.Points = strings.Join(pts, " ")
+		ret.Series = append(ret.Series, s)
+	}
+	return
+}
+
+// 图表中的数值文本
+func reportNum(v float64) string {
+	switch {
+	case v == 0:
+		return "0"
+	case math.Abs(v) >= 100:
+		return fmt.Sprintf(`%.0f`, v)
+	case math.Abs(v) >= 1:
+		return fmt.Sprintf(`%.1f`, v)
+	default:
+		return fmt.Sprintf(`%.3f`, v)
+	}
+}
+
+// 写入独立网页: 不依赖外部资源, 图表为内嵌svg
+func (d *Report) WriteHtml(w io.Writer) (err error) {
+	var (
+		xs      []float64
+		xLabel  = "robots"
+		latency = [][]float64{nil, nil}
+		names   = []string{"avg", "90% avg"}
+		tps     = [][]float64{nil}
+		fail    = [][]float64{nil}
+	)
+	if d.Category == SceneCateReplay || d.Category == SceneCateStable {
+		// 机器人数不变, 按轮次展示
+		xLabel = "batch"
+	}
+	if len(d.Batches) > 0 {
+		for _, a := range d.Batches[0].Actions {
+			names = append(names, a.Name+" p90")
+			latency = append(latency, nil)
+		}
+	}
+	for _, b := range d.Batches {
+		if xLabel == "batch" {
+			xs = append(xs, float64(b.Batch))
+		} else {
+			xs = append(xs, float64(b.BatchRobot))
+		}
+		latency[0] = append(latency[0], b.PerfTimeAvg.Seconds()*1000)
+		latency[1] = append(latency[1], b.PerfTime90Avg.Seconds()*1000)
+		for i, a := range b.Actions {
+			if i+2 < len(latency) {
+				latency[i+2] = append(latency[i+2], a.TimeP90.Seconds()*1000)
+			}
+		}
+		tps[0] = append(tps[0], b.Throughput)
+		fail[0] = append(fail[0], b.FailRate*100)
+	}
+	data := map[string]interface{}{
+		"Report": d,
+		"Charts": []*reportChart{
+			newReportChart("Latency", xLabel, "ms", xs, names, latency),
+			newReportChart("Throughput", xLabel, "actions/s", xs, []string{"throughput"}, tps),
+			newReportChart("Errors", xLabel, "%", xs, []string{"fail rate"}, fail),
+		},
+	}
+	return reportHtmlTemplate.Execute(w, data)
+}
+
+var reportHtmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(v interface{ Seconds() float64 }) string {
+		return fmt.Sprintf(`%.2f`, v.Seconds()*1000)
+	},
+	"pct": func(v float64) string {
+		return fmt.Sprintf(`%.2f%%`, v*100)
+	},
+	"time": func(v interface{ Format(string) string }) string {
+		return v.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Report.Name}} - go-box report</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;margin:24px;color:#222}
+h1{font-size:22px;margin:0 0 8px}
+h2{font-size:17px;margin:28px 0 8px}
+table{border-collapse:collapse;font-size:13px}
+th,td{border:1px solid #ddd;padding:4px 8px;text-align:right}
+th{background:#f5f5f5}
+td.l,th.l{text-align:left}
+.pass{background:#2ca02c;color:#fff;padding:2px 8px;border-radius:3px}
+.fail{background:#d62728;color:#fff;padding:2px 8px;border-radius:3px}
+tr.bad td{background:#fdecea}
+.charts{display:flex;flex-wrap:wrap;gap:16px}
+svg text{font-size:11px;fill:#555}
+details{margin:6px 0}
+</style>
+</head>
+<body>
+{{with .Report}}
+<h1>{{.Name}} <small>{{.Category}}</small> <span class="{{.Verdict}}">{{.Verdict}}</span></h1>
+<div>{{time .TimeStart}} ~ {{time .TimeEnd}}, status {{.Status}}, report v{{.Version}}</div>
+{{if .Reason}}<p><b>reason:</b> {{.Reason}}</p>{{end}}
+{{with .Params}}
+<h2>Params</h2>
+<table>
+<tr><th class="l">failBreak</th><td>{{.FailBreak}}</td><th class="l">failFast</th><td>{{.FailFast}}</td><th class="l">failPerf</th><td>{{.FailPerf}}</td><th class="l">batchMax</th><td>{{.BatchMax}}</td></tr>
+<tr><th class="l">numInit</th><td>{{.NumInit}}</td><th class="l">numStep</th><td>{{.NumStep}}</td><th class="l">periodAction</th><td>{{.PeriodAction}}ms</td><th class="l">periodScene</th><td>{{.PeriodScene}}ms</td></tr>
+</table>
+{{end}}
+{{end}}
+<h2>Charts</h2>
+<div class="charts">
+{{range .Charts}}
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
+<text x="{{.Left}}" y="11" style="font-weight:bold;fill:#222">{{.Title}} ({{.YLabel}})</text>
+{{$c := .}}{{range .YTicks}}<line x1="{{.X}}" x2="{{$c.Right}}" y1="{{.Y}}" y2="{{.Y}}" stroke="#eee"/><text x="{{.X}}" y="{{.Y}}" dx="-4" dy="4" text-anchor="end">{{.Label}}</text>{{end}}
+{{range .XTicks}}<text x="{{.X}}" y="{{.Y}}" dy="14" text-anchor="middle">{{.Label}}</text>{{end}}
+<line x1="{{.Left}}" x2="{{.Right}}" y1="{{.Bottom}}" y2="{{.Bottom}}" stroke="#999"/>
+<line x1="{{.Left}}" x2="{{.Left}}" y1="{{.Top}}" y2="{{.Bottom}}" stroke="#999"/>
+<text x="{{.Right}}" y="{{.Height}}" dy="-4" text-anchor="end">{{.XLabel}}</text>
+{{range $i, $s := .Series}}
+<polyline fill="none" stroke="{{$s.Color}}" stroke-width="2" points="{{$s.Points}}"/>
+{{range $s.Dots}}<circle cx="{{.X}}" cy="{{.Y}}" r="3" fill="{{$s.Color}}"><title>{{.Label}}</title></circle>{{end}}
+<text x="{{$c.Right}}" y="{{$c.Top}}" dy="{{$i}}em" text-anchor="end" style="fill:{{$s.Color}}">{{$s.Name}}</text>
+{{end}}
+</svg>
+{{end}}
+</div>
+{{with .Report}}
+<h2>Batches</h2>
+<table>
+<tr><th>#</th><th>robots</th><th>status</th><th>time (s)</th><th>concurrency</th><th>fail rate</th><th>throughput</th><th>avg (ms)</th><th>90% avg (ms)</th><th>loss</th><th>fastest (ms)</th><th>slowest (ms)</th><th class="l">error</th></tr>
+{{range .Batches}}
+<tr{{if or .Error .ErrText}} class="bad"{{end}}><td>{{.Batch}}</td><td>{{.BatchRobot}}</td><td>{{.Status}}</td><td>{{printf "%.2f" .TimeRun.Seconds}}</td><td>{{.Concurrency}}</td><td>{{pct .FailRate}}</td><td>{{printf "%.2f" .Throughput}}</td><td>{{ms .PerfTimeAvg}}</td><td>{{ms .PerfTime90Avg}}</td><td>{{pct .PerfLossRate}}</td><td>{{ms .RespFastest}}</td><td>{{ms .RespSlowest}}</td><td class="l">{{.Error}} {{.ErrText}}</td></tr>
+{{end}}
+</table>
+<h2>Actions</h2>
+{{range .Batches}}
+<details{{if eq .Batch (len $.Report.Batches)}} open{{end}}>
+<summary>#{{.Batch}} {{.BatchRobot}} robots</summary>
+<table>
+<tr><th class="l">action</th><th>count</th><th>fail</th><th>skip</th><th>fail rate</th><th>avg</th><th>min</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>max</th><th>connect</th><th>first byte</th><th>limit wait</th><th class="l">error</th></tr>
+{{range .Actions}}
+<tr{{if .Fail}} class="bad"{{end}}><td class="l">{{.Name}}</td><td>{{.Count}}</td><td>{{.Fail}}</td><td>{{.Skip}}</td><td>{{pct .FailRate}}</td><td>{{ms .TimeAvg}}</td><td>{{ms .TimeMin}}</td><td>{{ms .TimeP50}}</td><td>{{ms .TimeP90}}</td><td>{{ms .TimeP95}}</td><td>{{ms .TimeP99}}</td><td>{{ms .TimeMax}}</td><td>{{ms .TimeConnect}}</td><td>{{ms .TimeFirstByte}}</td><td>{{ms .TimeLimit}}</td><td class="l">{{.ErrText}}</td></tr>
+{{end}}
+</table>
+</details>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
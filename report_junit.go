@@ -0,0 +1,90 @@
+package box
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// JUnit XML
+type reportJunitSuites struct {
+	XMLName  xml.Name           `xml:"testsuites"`
+	Name     string             `xml:"name,attr"`
+	Tests    int                `xml:"tests,attr"`
+	Failures int                `xml:"failures,attr"`
+	Time     float64            `xml:"time,attr"`
+	Suites   []reportJunitSuite `xml:"testsuite"`
+}
+type reportJunitSuite struct {
+	Name      string            `xml:"name,attr"`
+	Tests     int               `xml:"tests,attr"`
+	Failures  int               `xml:"failures,attr"`
+	Time      float64           `xml:"time,attr"`
+	Timestamp string            `xml:"timestamp,attr,omitempty"`
+	Cases     []reportJunitCase `xml:"testcase"`
+}
+type reportJunitCase struct {
+	Name      string              `xml:"name,attr"`
+	ClassName string              `xml:"classname,attr"`
+	Time      float64             `xml:"time,attr"`
+	Failure   *reportJunitFailure `xml:"failure,omitempty"`
+	SystemOut string              `xml:"system-out,omitempty"`
+}
+type reportJunitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// 写入JUnit XML: 每轮一个用例, 未通过阀值即失败; 最后一个用例为整体结论
+func (d *Report) WriteJunit(w io.Writer) (err error) {
+	name := d.Name
+	if len(name) == 0 {
+		name = "box"
+	}
+	suite := reportJunitSuite{Name: fmt.Sprintf(`%s.%s`, name, d.Category)}
+	if !d.TimeStart.IsZero() {
+		suite.Timestamp = d.TimeStart.Format("2006-01-02T15:04:05")
+	}
+	for _, b := range d.Batches {
+		c := reportJunitCase{
+			Name:      fmt.Sprintf(`#%d %d robots`, b.Batch, b.BatchRobot),
+			ClassName: suite.Name,
+			Time:      b.TimeRun.Seconds(),
+			SystemOut: b.String(),
+		}
+		if len(b.Error) > 0 {
+			c.Failure = &reportJunitFailure{Message: b.Error, Type: "threshold", Text: b.ErrText}
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Time += c.Time
+	}
+	verdict := reportJunitCase{Name: "verdict", ClassName: suite.Name}
+	if !d.IsPass() {
+		verdict.Failure = &reportJunitFailure{Message: d.Reason, Type: "verdict"}
+	}
+	suite.Cases = append(suite.Cases, verdict)
+	for _, c := range suite.Cases {
+		suite.Tests += 1
+		if c.Failure != nil {
+			suite.Failures += 1
+		}
+	}
+	suites := reportJunitSuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []reportJunitSuite{suite},
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(suites); err != nil {
+		return
+	}
+	_, err = io.WriteString(w, "\n")
+	return
+}
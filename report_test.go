@@ -0,0 +1,111 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试动作统计与各格式报告
+func Test_Report(t *testing.T) {
+	as := require.New(t)
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			time.Sleep(time.Millisecond * 5)
+			if u.Serial%2 == 1 {
+				err = fmt.Errorf("login fail %d", u.Serial)
+			}
+			return
+		},
+	})))
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "query",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			time.Sleep(time.Millisecond * 10)
+			return
+		},
+	})))
+	scene := NewScene(&Scene{DefaultRobot: robot})
+	scene.Log.SetLevel(2)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 4, BatchMax: 2}, nil)
+	as.Nil(err)
+	as.Len(data, 2)
+
+	// 动作统计
+	acts := data[0].ActionArray
+	as.Len(acts, 2)
+	as.Equal("login", acts[0].Name)
+	as.Equal(4, acts[0].Count)
+	as.Equal(2, acts[0].Fail)
+	as.Equal(0.5, acts[0].FailRate)
+	as.Contains(acts[0].ErrText, "login fail")
+	as.Equal(2, acts[1].Count)
+	as.Equal(2, acts[1].Skip)
+	as.True(acts[1].TimeP90 >= 10*time.Millisecond)
+	as.True(acts[1].TimeMin <= acts[1].TimeP50 && acts[1].TimeP50 <= acts[1].TimeMax)
+
+	// 按阀值给出结论
+	plan := &Plan{Name: "demo", Threshold: &PlanThreshold{FailRate: 0.1}}
+	report := plan.NewReport(data)
+	as.False(report.IsPass())
+	as.Contains(report.Reason, "failRate")
+	as.Contains(report.Batches[0].Error, "failRate")
+	as.True(report.Batches[0].Throughput > 0)
+	as.True(NewReport("demo", data).IsPass())
+
+	// json
+	var buf bytes.Buffer
+	as.Nil(report.Write(&buf, ReportFormatJson))
+	var doc map[string]interface{}
+	as.Nil(json.Unmarshal(buf.Bytes(), &doc))
+	as.EqualValues(ReportVersion, doc["version"])
+	as.Equal(ReportVerdictFail, doc["verdict"])
+	batch := doc["batches"].([]interface{})[0].(map[string]interface{})
+	as.EqualValues(4, batch["batchRobot"])
+	as.Len(batch["actions"], 2)
+	as.NotNil(doc["params"])
+
+	// csv
+	buf.Reset()
+	as.Nil(report.Write(&buf, ReportFormatCsv))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	as.Nil(err)
+	as.Len(rows, 3)
+	as.Contains(rows[0], "query.timeP90")
+	as.Equal(len(rows[0]), len(rows[1]))
+
+	// junit
+	buf.Reset()
+	as.Nil(report.Write(&buf, ReportFormatJunit))
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+	}
+	as.Nil(xml.Unmarshal(buf.Bytes(), &suites))
+	as.Equal(3, suites.Tests)
+	as.Equal(3, suites.Failures)
+
+	// html
+	buf.Reset()
+	as.Nil(report.Write(&buf, ReportFormatHtml))
+	as.Equal(3, strings.Count(buf.String(), "<svg"))
+	as.Contains(buf.String(), "query p90")
+
+	// 按扩展名保存
+	dir := t.TempDir()
+	as.Nil(plan.SaveReport(filepath.Join(dir, "r.json")+","+filepath.Join(dir, "r.html"), data))
+	_, err = os.Stat(filepath.Join(dir, "r.html"))
+	as.Nil(err)
+	as.NotNil(report.Save(filepath.Join(dir, "r.txt")))
+}
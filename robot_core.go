@@ -2,6 +2,7 @@ package box
 
 import (
 	"fmt"
+	"io"
 )
 
 // 机器人关闭
@@ -24,6 +25,7 @@ func (d *Robot) Copy() (ret *Robot, err error) {
 	data.ResultArray = []*RobotActionResult{}
 	data.Scene = d.Scene
 	data.FnClose = d.FnClose
+	data.Vars = d.GetVars()
 	data.IsCopy = true
 
 	//
@@ -42,10 +44,73 @@ func (d *Robot) AddAction(a Action) (err error) {
 	return
 }
 
-// 关闭
+// 关闭: 执行FnClose, 并关闭私有存储中的连接(io.Closer)
 func (d *Robot) Close() (err error) {
 	if d.FnClose != nil {
-		return d.FnClose(d)
+		err = d.FnClose(d)
 	}
+	d.lockVars.Lock()
+	for k, v := range d.store {
+		if c, ok := v.(io.Closer); ok {
+			if _err := c.Close(); _err != nil && err == nil {
+				err = _err
+			}
+		}
+		delete(d.store, k)
+	}
+	d.lockVars.Unlock()
+	return
+}
+
+// 设置变量
+func (d *Robot) SetVar(key string, val interface{}) {
+	d.lockVars.Lock()
+	if d.Vars == nil {
+		d.Vars = map[string]interface{}{}
+	}
+	d.Vars[key] = val
+	d.lockVars.Unlock()
+}
+
+// 取变量
+func (d *Robot) GetVar(key string) (ret interface{}) {
+	d.lockVars.RLock()
+	ret = d.Vars[key]
+	d.lockVars.RUnlock()
+	return
+}
+
+// 取变量副本
+func (d *Robot) GetVars() (ret map[string]interface{}) {
+	d.lockVars.RLock()
+	ret = make(map[string]interface{}, len(d.Vars))
+	for k, v := range d.Vars {
+		ret[k] = v
+	}
+	d.lockVars.RUnlock()
 	return
 }
+
+// 取私有存储, 不存在时用fn创建
+func (d *Robot) GetStore(key string, fn func() interface{}) (ret interface{}) {
+	d.lockVars.Lock()
+	defer d.lockVars.Unlock()
+	if ret = d.store[key]; ret == nil && fn != nil {
+		if d.store == nil {
+			d.store = map[string]interface{}{}
+		}
+		ret = fn()
+		d.store[key] = ret
+	}
+	return
+}
+
+// 设置私有存储
+func (d *Robot) SetStore(key string, val interface{}) {
+	d.lockVars.Lock()
+	if d.store == nil {
+		d.store = map[string]interface{}{}
+	}
+	d.store[key] = val
+	d.lockVars.Unlock()
+}
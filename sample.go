@@ -0,0 +1,44 @@
+package box
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// 样本文件
+const (
+	SampleFileHead = "# gobox samples v1" // 首行
+	//
+	sampleLineSample = "s" // 动作样本行
+	sampleLineBatch  = "b" // 每轮结果行
+)
+
+// 以制表符分隔的紧凑文本逐行写入样本文件, 供AnalyzeSamples离线重新统计
+//
+// 样本行: s 轮次 编号 动作位置 开始(unix微秒) 耗时(纳秒) 状态 错误分类 机器人名 动作名 错误文本
+// 每轮行: b 轮次 最大轮次 机器人数 场景状态 开始 结束 期望结束 场景名 测试类型 错误文本
+// 轮次1起始, 跳过的动作开始时间为0, 文本字段以Go字符串字面量写入
+type SinkSample struct {
+	Path   string    // 文件地址, 追加写入
+	Writer io.Writer // 未设置Path时写入这里
+	//
+	file   *os.File
+	buf    *bufio.Writer
+	head   bool // 已写入首行
+	closed bool // 已关闭, 之后的写入丢弃
+	lock   sync.Mutex
+}
+
+// 由样本文件解析出的一个执行单元: 一个机器人一次执行的全部动作
+type analyzeUnit struct {
+	batch   int
+	samples []*ResultSample
+}
+
+// 按顺序解析一行的字段, 出错后不再解析
+type sampleParser struct {
+	fields []string
+	err    error
+}
@@ -0,0 +1,486 @@
+package box
+
+import (
+	"github.com/suboat/go-contrib"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 创建样本文件输出, 追加写入
+func NewSinkSample(filePath string) (d *SinkSample, err error) {
+	d = &SinkSample{Path: filePath}
+	if d.file, err = os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666); err != nil {
+		return nil, err
+	}
+	d.buf = bufio.NewWriterSize(d.file, 64*1024)
+	if info, _err := d.file.Stat(); _err == nil && info.Size() > 0 {
+		d.head = true
+	}
+	return
+}
+
+// 写入一行
+func (d *SinkSample) write(fields ...string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return
+	}
+	if d.buf == nil {
+		if d.Writer == nil {
+			return
+		}
+		d.buf = bufio.NewWriterSize(d.Writer, 64*1024)
+	}
+	if !d.head {
+		d.head = true
+		d.buf.WriteString(SampleFileHead)
+		d.buf.WriteByte('\n')
+	}
+	d.buf.WriteString(strings.Join(fields, "\t"))
+	d.buf.WriteByte('\n')
+}
+
+//
+func (d *SinkSample) OnSample(r *ResultSample) {
+	d.write(sampleLineSample,
+		strconv.Itoa(r.Batch+1),
+		strconv.Itoa(r.Serial),
+		strconv.Itoa(r.Step),
+		sampleTime(r.TimeStart),
+		strconv.FormatInt(int64(r.TimeSpent), 10),
+		strconv.Itoa(r.Status),
+		strconv.Quote(r.ErrClass),
+		strconv.Quote(r.Robot),
+		strconv.Quote(r.Action),
+		strconv.Quote(r.ErrText))
+}
+
+// 每轮结果写入后刷新
+func (d *SinkSample) OnBatch(r *ResultScene) {
+	d.write(sampleLineBatch,
+		strconv.Itoa(r.Batch),
+		strconv.Itoa(r.BatchMax),
+		strconv.Itoa(r.BatchRobot),
+		strconv.Itoa(r.Status),
+		sampleTime(r.TimeStart),
+		sampleTime(r.TimeEnd),
+		sampleTime(r.TimeEndLine),
+		strconv.Quote(r.Scene),
+		strconv.Quote(r.Category),
+		strconv.Quote(r.ErrText))
+	d.lock.Lock()
+	if d.buf != nil {
+		d.buf.Flush()
+	}
+	d.lock.Unlock()
+}
+
+// 写出缓冲
+func (d *SinkSample) Flush() (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.buf != nil {
+		err = d.buf.Flush()
+	}
+	return
+}
+
+// 关闭后的写入丢弃
+func (d *SinkSample) Close() (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = true
+	if d.buf != nil {
+		err = d.buf.Flush()
+	}
+	d.buf = nil
+	if d.file != nil {
+		if _err := d.file.Close(); err == nil {
+			err = _err
+		}
+		d.file = nil
+	}
+	return
+}
+
+// 时间写为unix微秒, 空时间为0
+func sampleTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano()/1e3, 10)
+}
+
+// 取下一个字段
+func (p *sampleParser) next() (ret string) {
+	if p.err == nil && len(p.fields) == 0 {
+		p.err = io.ErrUnexpectedEOF
+	}
+	if p.err != nil {
+		return
+	}
+	ret, p.fields = p.fields[0], p.fields[1:]
+	return
+}
+
+//
+func (p *sampleParser) int64() (ret int64) {
+	if s := p.next(); p.err == nil {
+		ret, p.err = strconv.ParseInt(s, 10, 64)
+	}
+	return
+}
+
+//
+func (p *sampleParser) int() int {
+	return int(p.int64())
+}
+
+// unix微秒, 0为空时间
+func (p *sampleParser) time() (ret time.Time) {
+	if v := p.int64(); v != 0 {
+		ret = time.Unix(0, v*1e3)
+	}
+	return
+}
+
+// Go字符串字面量
+func (p *sampleParser) str() (ret string) {
+	if s := p.next(); p.err == nil {
+		ret, p.err = strconv.Unquote(s)
+	}
+	return
+}
+
+// 逐行读取样本文件, 每轮行的各项以ResultScene给出, 仅执行参数与时间等基本信息有效
+func ReadSamples(r io.Reader, fnSample func(d *ResultSample), fnBatch func(d *ResultScene)) (err error) {
+	var (
+		scanner = bufio.NewScanner(r)
+		line    = 0
+	)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line += 1
+		text := scanner.Text()
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		var (
+			fields = strings.Split(text, "\t")
+			p      = &sampleParser{fields: fields[1:]}
+		)
+		switch {
+		case fields[0] == sampleLineSample && len(fields) == 11:
+			d := &ResultSample{
+				Batch:     p.int() - 1,
+				Serial:    p.int(),
+				Step:      p.int(),
+				TimeStart: p.time(),
+				TimeSpent: time.Duration(p.int64()),
+				Status:    p.int(),
+				ErrClass:  p.str(),
+				Robot:     p.str(),
+				Action:    p.str(),
+				ErrText:   p.str(),
+			}
+			if p.err == nil {
+				if fnSample != nil {
+					fnSample(d)
+				}
+				continue
+			}
+		case fields[0] == sampleLineBatch && len(fields) == 11:
+			d := &ResultScene{
+				Batch:       p.int(),
+				BatchMax:    p.int(),
+				BatchRobot:  p.int(),
+				Status:      p.int(),
+				TimeStart:   p.time(),
+				TimeEnd:     p.time(),
+				TimeEndLine: p.time(),
+				Scene:       p.str(),
+				Category:    p.str(),
+				ErrText:     p.str(),
+			}
+			if p.err == nil {
+				if fnBatch != nil {
+					fnBatch(d)
+				}
+				continue
+			}
+		}
+		return contrib.ErrParamInvalid.SetVars(fmt.Sprintf("line %d", line))
+	}
+	return scanner.Err()
+}
+
+// 读取样本文件并重新统计
+func AnalyzeSampleFile(filePath string, form *FormAnalyze) (ret []*ResultScene, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return AnalyzeSamples(f, form)
+}
+
+// 由样本重新统计各轮结果: 按原轮次或按时间窗口分组, 可按时间/轮次/动作/机器人过滤
+func AnalyzeSamples(r io.Reader, form *FormAnalyze) (ret []*ResultScene, err error) {
+	if form == nil {
+		form = new(FormAnalyze)
+	}
+	if err = form.Valid(); err != nil {
+		return
+	}
+
+	// 按机器人划分执行单元: 同一机器人的动作位置不再递增即开始新一次执行
+	var (
+		batches = map[int]*ResultScene{}
+		units   []*analyzeUnit
+		current = map[string]*analyzeUnit{}
+		origin  time.Time
+	)
+	if err = ReadSamples(r, func(d *ResultSample) {
+		key := fmt.Sprintf("%d/%d/%s", d.Batch, d.Serial, d.Robot)
+		u := current[key]
+		if u == nil || u.samples[len(u.samples)-1].Step >= d.Step {
+			u = &analyzeUnit{batch: d.Batch + 1}
+			current[key] = u
+			units = append(units, u)
+		}
+		u.samples = append(u.samples, d)
+		if !d.TimeStart.IsZero() && (origin.IsZero() || d.TimeStart.Before(origin)) {
+			origin = d.TimeStart
+		}
+	}, func(d *ResultScene) {
+		batches[d.Batch] = d
+	}); err != nil {
+		return
+	}
+
+	// 场景名与测试类型取自首轮
+	var (
+		scene, category string
+		first           = -1
+	)
+	for k, b := range batches {
+		if first < 0 || k < first {
+			first, scene, category = k, b.Scene, b.Category
+		}
+	}
+
+	// 过滤并分组
+	var (
+		groups = map[int][]*analyzeUnit{}
+		keys   []int
+		window = time.Duration(form.Window) * time.Millisecond
+	)
+	for _, u := range units {
+		start := u.start()
+		if len(form.Batches) > 0 && !sampleHasInt(form.Batches, u.batch) {
+			continue
+		}
+		if len(form.Robots) > 0 && !sampleHasString(form.Robots, u.samples[0].Robot) {
+			continue
+		}
+		if form.From > 0 || form.To > 0 {
+			offset := start.Sub(origin)
+			if start.IsZero() || offset < time.Duration(form.From)*time.Millisecond ||
+				(form.To > 0 && offset >= time.Duration(form.To)*time.Millisecond) {
+				continue
+			}
+		}
+		if len(form.Actions) > 0 {
+			var samples []*ResultSample
+			for _, d := range u.samples {
+				if sampleHasString(form.Actions, d.Action) {
+					samples = append(samples, d)
+				}
+			}
+			if len(samples) == 0 {
+				continue
+			}
+			u = &analyzeUnit{batch: u.batch, samples: samples}
+		}
+		key := u.batch
+		if window > 0 {
+			if start.IsZero() {
+				continue
+			}
+			key = int(start.Sub(origin)/window) + 1
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], u)
+	}
+	sort.Ints(keys)
+
+	// 统计
+	for _, key := range keys {
+		report, reportUnits := analyzeGroup(groups[key], form)
+		report.Batch = key
+		if b := batches[key]; window == 0 && b != nil {
+			report.Status = b.Status
+			report.BatchMax = b.BatchMax
+			report.TimeEndLine = b.TimeEndLine
+			if len(report.ErrText) == 0 {
+				report.ErrText = b.ErrText
+			}
+		} else if window > 0 {
+			report.BatchMax = len(keys)
+			report.TimeEndLine = origin.Add(window * time.Duration(key))
+		} else {
+			report.TimeEndLine = report.TimeEnd
+		}
+		report.Scene, report.Category = scene, category
+		report.BatchText = fmt.Sprintf(`#%d. %s`, key, report.TimeStart.Format("15:04:05"))
+		if len(ret) > 0 {
+			report.statUnits(reportUnits, ret[len(ret)-1])
+		} else {
+			report.statUnits(reportUnits, nil)
+		}
+		ret = append(ret, report)
+	}
+	return
+}
+
+// 统计一组执行单元: 时间, 并发, 各动作
+func analyzeGroup(group []*analyzeUnit, form *FormAnalyze) (ret *ResultScene, units [][]*RobotActionResult) {
+	ret = &ResultScene{BatchRobot: len(group)}
+
+	// 动作位置
+	var (
+		names = map[int]string{}
+		steps []int
+	)
+	for _, u := range group {
+		for _, d := range u.samples {
+			if _, ok := names[d.Step]; !ok {
+				names[d.Step] = d.Action
+				steps = append(steps, d.Step)
+			}
+		}
+	}
+	sort.Ints(steps)
+	var (
+		pos     = map[int]int{}
+		actions = make([]Action, len(steps))
+		events  []time.Time // 开始与结束, 用于计算并发
+		ends    = map[int]bool{}
+	)
+	for i, step := range steps {
+		pos[step] = i
+		actions[i] = &ActionOne{Name: names[step]}
+	}
+	units = make([][]*RobotActionResult, len(group))
+	for i, u := range group {
+		units[i] = make([]*RobotActionResult, len(steps))
+		for _, d := range u.samples {
+			record := &RobotActionResult{
+				Status:     d.Status,
+				TimeCreate: d.TimeStart,
+				TimeSpent:  d.TimeSpent,
+				ErrClass:   d.ErrClass,
+			}
+			if len(d.ErrText) > 0 {
+				record.Error = errors.New(d.ErrText)
+				ret.ErrText = d.ErrText
+			}
+			if !d.TimeStart.IsZero() {
+				record.TimeFinish = d.TimeStart.Add(d.TimeSpent)
+				if ret.TimeStart.IsZero() || d.TimeStart.Before(ret.TimeStart) {
+					ret.TimeStart = d.TimeStart
+				}
+				if record.TimeFinish.After(ret.TimeEnd) {
+					ret.TimeEnd = record.TimeFinish
+				}
+				ends[len(events)+1] = true
+				events = append(events, d.TimeStart, record.TimeFinish)
+			}
+			units[i][pos[d.Step]] = record
+		}
+	}
+	ret.TimeRun = ret.TimeEnd.Sub(ret.TimeStart)
+
+	// 最大并发: 同一时刻先结束后开始
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := events[order[i]], events[order[j]]
+		if a.Equal(b) {
+			return ends[order[i]] && !ends[order[j]]
+		}
+		return a.Before(b)
+	})
+	var now int64
+	for _, i := range order {
+		if ends[i] {
+			now -= 1
+		} else if now += 1; now > ret.Concurrency {
+			ret.Concurrency = now
+		}
+	}
+
+	ret.statActions(actions, units)
+	if len(form.Percentiles) > 0 {
+		for i, item := range ret.ActionArray {
+			var spent []time.Duration
+			for _, unit := range units {
+				if r := unit[i]; r != nil && !(r.Status == ActionStatusClose && r.TimeCreate.IsZero()) {
+					spent = append(spent, r.TimeSpent)
+				}
+			}
+			if len(spent) == 0 {
+				continue
+			}
+			sort.Slice(spent, func(i, j int) bool { return spent[i] < spent[j] })
+			item.TimeCustom = map[string]time.Duration{}
+			for _, p := range form.Percentiles {
+				item.TimeCustom["p"+strconv.FormatFloat(p, 'f', -1, 64)] = spent[int(float64(len(spent)-1)*p/100)]
+			}
+		}
+	}
+	return
+}
+
+// 单元开始时间
+func (d *analyzeUnit) start() (ret time.Time) {
+	for _, s := range d.samples {
+		if !s.TimeStart.IsZero() {
+			return s.TimeStart
+		}
+	}
+	return
+}
+
+//
+func sampleHasInt(arr []int, v int) bool {
+	for _, a := range arr {
+		if a == v {
+			return true
+		}
+	}
+	return false
+}
+
+//
+func sampleHasString(arr []string, v string) bool {
+	for _, a := range arr {
+		if a == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试样本文件写入与离线重新统计
+func Test_AnalyzeSamples(t *testing.T) {
+	as := require.New(t)
+	var buf bytes.Buffer
+	robot := NewRobot(&Robot{Name: "robot\tx"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "login",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			time.Sleep(time.Millisecond * time.Duration(5+u.Serial))
+			if u.Serial == 0 {
+				err = fmt.Errorf("bad\npassword")
+			}
+			return
+		},
+	})))
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "home"})))
+	scene := NewScene(&Scene{Name: "analyze", DefaultRobot: robot, Sink: &SinkSample{Writer: &buf}})
+	scene.Log.SetLevel(2)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 4, BatchMax: 2}, nil)
+	as.Nil(err)
+	as.Len(data, 2)
+	as.True(strings.HasPrefix(buf.String(), SampleFileHead+"\n"))
+
+	// 按原轮次统计与执行时一致
+	ret, err := AnalyzeSamples(bytes.NewReader(buf.Bytes()), &FormAnalyze{Percentiles: []float64{99.9}})
+	as.Nil(err)
+	as.Len(ret, 2)
+	for i, r := range ret {
+		as.Equal("analyze", r.Scene)
+		as.Equal(data[i].Category, r.Category)
+		as.Equal(data[i].Batch, r.Batch)
+		as.Equal(data[i].BatchRobot, r.BatchRobot)
+		as.Equal(data[i].FailRate, r.FailRate)
+		as.Equal(data[i].PerfTimeAvg, r.PerfTimeAvg)
+		as.Equal(data[i].PerfTime90Avg, r.PerfTime90Avg)
+		as.True(r.Concurrency >= 1 && r.Concurrency <= 4, r.Concurrency)
+		as.Len(r.ActionArray, 2)
+		as.Equal(data[i].ActionArray[0].TimeP90, r.ActionArray[0].TimeP90)
+		as.Equal(3, r.ActionArray[1].Count)
+		as.Equal(1, r.ActionArray[1].Skip)
+		as.Equal("bad\npassword", r.ActionArray[0].ErrText)
+		as.Equal(r.ActionArray[0].TimeP99, r.ActionArray[0].TimeCustom["p99.9"])
+	}
+
+	// 过滤: 轮次, 动作, 机器人
+	ret, err = AnalyzeSamples(bytes.NewReader(buf.Bytes()), &FormAnalyze{Batches: []int{2}, Actions: []string{"home"}})
+	as.Nil(err)
+	as.Len(ret, 1)
+	as.Equal(2, ret[0].Batch)
+	as.Len(ret[0].ActionArray, 1)
+	as.Equal("home", ret[0].ActionArray[0].Name)
+	as.Equal(0.25, ret[0].FailRate) // 被跳过的动作
+	ret, err = AnalyzeSamples(bytes.NewReader(buf.Bytes()), &FormAnalyze{Robots: []string{"nobody"}})
+	as.Nil(err)
+	as.Len(ret, 0)
+
+	// 时间窗口: 全部落入一个足够大的窗口
+	ret, err = AnalyzeSamples(bytes.NewReader(buf.Bytes()), &FormAnalyze{Window: 3600 * 1000})
+	as.Nil(err)
+	as.Len(ret, 1)
+	as.Equal(8, ret[0].BatchRobot)
+	as.Equal(0.25, ret[0].FailRate)
+
+	// 参数与格式错误
+	_, err = AnalyzeSamples(bytes.NewReader(buf.Bytes()), &FormAnalyze{From: 10, To: 5})
+	as.NotNil(err)
+	_, err = AnalyzeSamples(strings.NewReader("s\t1\t2\n"), nil)
+	as.NotNil(err)
+}
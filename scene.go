@@ -5,6 +5,7 @@ import (
 
 	"context"
 	"fmt"
+	"math/rand"
 	"runtime"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ const (
 	SceneCateCapacity = "capacity" // 容量测试
 	SceneCateSurge    = "surge"    // 浪涌测试
 	SceneCateStable   = "stable"   // 稳定测试
+	SceneCateReplay   = "replay"   // 日志回放
 )
 
 // 场景状态
@@ -23,6 +25,9 @@ const (
 	SceneStatusFailBreak            // 1: 出现了错误
 	SceneStatusFailPerf             // 2: 性能下降超出预期
 	SceneStatusBatchMax             // 3: 执行到了最大周期
+	SceneStatusStop                 // 4: 被手动停止, 见Scene.Stop
+	SceneStatusBreak                // 5: 错误率达到熔断阀值, 本轮中途停止, 见Scene.Breaker
+	SceneStatusInterrupt            // 6: 被信号中断, 见Scene.Signal
 )
 
 // 动作状态
@@ -42,6 +47,9 @@ var (
 	DefaultSceneCapacityMaxLoop   = 1000             // 容量测试最大周期
 	DefaultSceneCapacityRobotStep = 5                // 容量测试每期递增人数
 	DefaultSceneCapacityBreakRate = 0.8              // 容量测试退出的衰减阀值
+	DefaultSceneReplayRobots      = 100              // 日志回放的机器人池大小
+	DefaultErrorTop               = 10               // 每轮列出的错误文本数
+	DefaultErrorDistinct          = 1000             // 每轮记录的不同错误文本上限, 超出后只计入分类
 )
 
 // 一个场景
@@ -53,22 +61,44 @@ type Scene struct {
 	//
 	NumCpu int // 程序并发数
 	//
-	Log          Logger // 日志
-	DefaultRobot *Robot // 默认机器人
+	Log             Logger          // 日志
+	DefaultRobot    *Robot          // 默认机器人
+	Metrics         *SceneMetrics   // 实时指标, 设置后在执行中更新, 可作为http处理器暴露
+	Sink            ResultSink      // 结果输出, 多个时使用SinkMulti; 异步调用, 每次执行结束时写出缓冲(见ResultSinkFlush), 由创建方关闭
+	Workers         []string        // 工作节点地址, 设置后本机只协调, 每轮机器人分摊到各节点执行, 见ClusterWorker
+	Dashboard       *SceneDashboard // 实时网页, 设置后在执行中更新, 可作为http处理器暴露
+	Progress        *SceneProgress  // 终端进度, 设置后在执行中刷新
+	ErrorClassifier ErrorClassifier // 错误分类, 为空或返回空时使用GetErrorClass
+	Streaming       bool            // true: 流式统计, 动作完成即计入直方图, 机器人完成后即回收, 内存不随机器人数增长; 百分位误差小于1%
+	Clock           Clock           // 时钟, 为空时为真实时钟; 测试中可设为ClockFake, 起始延时,轮间等待与动作耗时都按虚拟时间
+	Breaker         *Breaker        // 熔断, 本轮中错误率达到阀值时停止余下的动作并结束场景
+	Limiter         *Limiter        // 限流, 作用于所有动作; 单个动作的限流见ActionOne.Limiter
+	Seed            int64           // 随机种子, 决定起始延时等调度与各机器人的Rand; 为0时每次执行取当前时间, 实际种子见ResultScene.Seed
+	Signal          bool            // true: 执行中处理SIGINT/SIGTERM, 第一次停止发起新的动作, 本轮统计后执行FnAfter并返回; 第二次强制退出
+	FnExit          SceneFnExit     // 第二次信号强制退出前的收尾函数, 如保存报告; 中断的状态此前已输出到各结果输出
 	//
-	wg sync.WaitGroup // 机器人并行后集合
+	seed    int64            // 本次执行的随机种子
+	wg      sync.WaitGroup   // 机器人并行后集合
+	control sceneControl     // 执行控制
+	stream  sceneStream      // 流式统计中的本轮结果
+	monitor generatorMonitor // 压测机监控
 }
 type SceneFn func(s *Scene) (err error)
 
+// 强制退出前的收尾函数, data为已完成的各轮与被中断的本轮(仅有执行参数); 轮间中断时为标记为中断的最后一轮
+type SceneFnExit func(s *Scene, data []*ResultScene)
+
 // 一个用户
 type Robot struct {
-	Name         string               // 用户名
-	Batch        int                  // 批次
-	Serial       int                  // 编号
-	ActionWindow time.Time            // 动作执行区间,在多少时间内把动作做完
-	ActionArray  []Action             // 要做的动作
-	ResultArray  []*RobotActionResult // 动作执行结果
-	FnClose      RobotClose           // 关闭机器人
+	Name         string                 // 用户名
+	Batch        int                    // 批次
+	Serial       int                    // 编号
+	ActionWindow time.Time              // 动作执行区间,在多少时间内把动作做完
+	ActionArray  []Action               // 要做的动作
+	ResultArray  []*RobotActionResult   // 动作执行结果
+	FnClose      RobotClose             // 关闭机器人
+	Vars         map[string]interface{} // 机器人变量, 可在动作模板中引用, 复制时浅拷贝
+	Rand         *rand.Rand             // 随机数, 由场景种子与批次,编号派生, 种子相同时序列相同; 只在本机器人的动作中使用
 	//
 	TimeCreate time.Time     // 开始时间
 	TimeFinish time.Time     // 完成时间
@@ -77,9 +107,12 @@ type Robot struct {
 	Scene  *Scene // 父级场景
 	IsCopy bool   // true: 是复制而来
 	//
-	Context    context.Context //
-	LockResult sync.RWMutex    //
-	wg         sync.WaitGroup  //
+	Context context.Context //
+	// Deprecated: ResultArray只由机器人自身协程写入, 一轮结束后读取, 无需加锁; 保留该字段仅为兼容
+	LockResult sync.RWMutex
+	lockVars   sync.RWMutex           // 变量与存储锁
+	store      map[string]interface{} // 动作的私有存储, 如http客户端
+	wg         sync.WaitGroup         //
 }
 type RobotActionResult struct {
 	Result     interface{}   // 返回结果
@@ -88,6 +121,17 @@ type RobotActionResult struct {
 	TimeCreate time.Time     // 开始时间
 	TimeFinish time.Time     // 完成时间
 	TimeSpent  time.Duration // 耗时
+	ErrClass   string        // 错误分类, 见Scene.ErrorClassifier
+	TimeLimit  time.Duration // 开始前等待限流的时间, 不计入耗时
+	// 分段耗时: 动作结果实现ActionTiming时记录
+	TimeConnect   time.Duration // 建立连接耗时
+	TimeFirstByte time.Duration // 发出请求到收到首字节耗时
+}
+
+// 动作分段耗时, 由动作的返回结果实现
+type ActionTiming interface {
+	GetTimeConnect() time.Duration   // 建立连接耗时, 复用连接时为0
+	GetTimeFirstByte() time.Duration // 发出请求到收到首字节耗时
 }
 
 // 一个动作
@@ -111,33 +155,45 @@ type ResultScene struct {
 	NumStep      int     `json:"numStep"`      //
 	PeriodAction int64   `json:"periodAction"` //
 	PeriodScene  int64   `json:"periodScene"`  //
+	Seed         int64   `json:"seed"`         // 随机种子, 见Scene.Seed
 	// 上轮统计
 	LastFailRate  float64       `json:"lastFailRate"`  // 上一轮容量测试的错误率
 	LastPerfAvg   time.Duration `json:"lastPerfAvg"`   // 上一轮平均耗时
 	LastPerf90Avg time.Duration `json:"lastPerf90Avg"` // 上一轮90%平均耗时
 	// 本轮统计
-	Status        int           `json:"status"`        // 本轮测试状态
-	Batch         int           `json:"batch"`         // 本轮测试是第几周期
-	BatchRobot    int           `json:"batchRobot"`    // 本轮机器人数
-	BatchText     string        `json:"batchText"`     // 本轮名称
-	TimeStart     time.Time     `json:"timeStart"`     // 本轮开始时间
-	TimeEnd       time.Time     `json:"timeEnd"`       // 本轮结束时间
-	TimeEndLine   time.Time     `json:"timeEndLine"`   // 本轮期望结束时间
-	TimeRun       time.Duration `json:"timeRun"`       // 本轮运行时间
-	Concurrency   int64         `json:"concurrency"`   // 本轮最大并发
-	ErrText       string        `json:"errText"`       // 最后一个错误文本
-	FailRate      float64       `json:"failRate"`      // 本轮错误率
-	TpsMax        float64       `json:"tpsMax"`        // 高峰TPS
-	TpsMin        float64       `json:"tpsMin"`        // 谷底TPS
-	TpsAvg        float64       `json:"tpsAvg"`        // 平均TPS
-	Tps90Avg      float64       `json:"tps90Avg"`      // 90%平均TPS
-	PerfTimeAvg   time.Duration `json:"perfTimeAvg"`   // 请求平均耗时
-	PerfTime90Avg time.Duration `json:"perfTime90Avg"` // 90%请求耗时
-	PerfTime90Std time.Duration `json:"perfTime90Std"` // 90%请求的标准差
-	PerfLossRate  float64       `json:"perfLossRate"`  // 本轮性能下降率
-	RespTotal     time.Duration `json:"perfTimeTotal"` // 响应总耗时
-	RespFastest   time.Duration `json:"respFastest"`   // 响应最快请求
-	RespSlowest   time.Duration `json:"respSlowest"`   // 响应最慢请求
+	Scene         string         `json:"scene"`         // 场景名
+	Status        int            `json:"status"`        // 本轮测试状态
+	Batch         int            `json:"batch"`         // 本轮测试是第几周期
+	BatchRobot    int            `json:"batchRobot"`    // 本轮机器人数
+	BatchText     string         `json:"batchText"`     // 本轮名称
+	TimeStart     time.Time      `json:"timeStart"`     // 本轮开始时间
+	TimeEnd       time.Time      `json:"timeEnd"`       // 本轮结束时间
+	TimeEndLine   time.Time      `json:"timeEndLine"`   // 本轮期望结束时间
+	TimeRun       time.Duration  `json:"timeRun"`       // 本轮运行时间
+	Concurrency   int64          `json:"concurrency"`   // 本轮最大并发
+	ErrText       string         `json:"errText"`       // 最后一个错误文本
+	Reason        string         `json:"reason"`        // 本轮以非正常状态结束的原因, 如手动停止
+	ErrorClass    map[string]int `json:"errorClass"`    // 各错误分类的失败次数
+	ErrorTop      []*ResultError `json:"errorTop"`      // 次数最多的错误文本, 最多DefaultErrorTop个
+	FailRate      float64        `json:"failRate"`      // 本轮错误率
+	TpsMax        float64        `json:"tpsMax"`        // 高峰TPS
+	TpsMin        float64        `json:"tpsMin"`        // 谷底TPS
+	TpsAvg        float64        `json:"tpsAvg"`        // 平均TPS
+	Tps90Avg      float64        `json:"tps90Avg"`      // 90%平均TPS
+	PerfTimeAvg   time.Duration  `json:"perfTimeAvg"`   // 请求平均耗时
+	PerfTime90Avg time.Duration  `json:"perfTime90Avg"` // 90%请求耗时
+	PerfTime90Std time.Duration  `json:"perfTime90Std"` // 90%请求的标准差
+	PerfLossRate  float64        `json:"perfLossRate"`  // 本轮性能下降率
+	RespTotal     time.Duration  `json:"perfTimeTotal"` // 响应总耗时
+	RespFastest   time.Duration  `json:"respFastest"`   // 响应最快请求
+	RespSlowest   time.Duration  `json:"respSlowest"`   // 响应最慢请求
+	// 回放统计: 仅日志回放
+	ReplayNum    int           `json:"replayNum"`    // 本轮回放请求数
+	ReplayLagAvg time.Duration `json:"replayLagAvg"` // 实际发出时间落后于计划的平均值
+	ReplayLag90  time.Duration `json:"replayLag90"`  // 90%请求的落后时间上限
+	ReplayLagMax time.Duration `json:"replayLagMax"` // 最大落后时间
+	// 压测机
+	Generator *ResultGenerator `json:"generator"` // 压测机自身的状态, Bound为true时耗时可能偏大
 	// 累计统计
 	TotalTimeRun  time.Duration `json:"totalTime"`     // 累计运行时间
 	TotalTimeResp time.Duration `json:"totalTimeResp"` // 累计响应时间
@@ -146,6 +202,37 @@ type ResultScene struct {
 	ActionArray []*ResultCapacityAction `json:"-"` // 动作执行结果
 }
 type ResultCapacityAction struct {
+	Name          string        `json:"name"`          // 动作名
+	Step          int           `json:"step"`          // 动作位置, 0起始
+	Count         int           `json:"count"`         // 执行次数, 不含跳过
+	Fail          int           `json:"fail"`          // 失败次数
+	Skip          int           `json:"skip"`          // 因前序动作失败而跳过的次数
+	FailRate      float64       `json:"failRate"`      // 错误率: 失败次数/执行次数
+	TimeAvg       time.Duration `json:"timeAvg"`       // 平均耗时
+	TimeMin       time.Duration `json:"timeMin"`       // 最快
+	TimeMax       time.Duration `json:"timeMax"`       // 最慢
+	TimeP50       time.Duration `json:"timeP50"`       // 50%耗时上限
+	TimeP90       time.Duration `json:"timeP90"`       // 90%耗时上限
+	TimeP95       time.Duration `json:"timeP95"`       // 95%耗时上限
+	TimeP99       time.Duration `json:"timeP99"`       // 99%耗时上限
+	TimeStd       time.Duration `json:"timeStd"`       // 耗时标准差
+	TimeConnect   time.Duration `json:"timeConnect"`   // 平均建立连接耗时
+	TimeFirstByte time.Duration `json:"timeFirstByte"` // 平均首字节耗时
+	TimeLimit     time.Duration `json:"timeLimit"`     // 平均等待限流时间, 不计入耗时
+	ErrText       string        `json:"errText"`       // 最后一个错误文本
+	//
+	ErrorClass map[string]int           `json:"errorClass,omitempty"` // 各错误分类的失败次数
+	TimeCustom map[string]time.Duration `json:"timeCustom,omitempty"` // 离线分析时额外计算的百分位, 如p99.9
+}
+
+// 一种错误文本的统计
+type ResultError struct {
+	Class     string    `json:"class"`     // 错误分类
+	Action    string    `json:"action"`    // 首次出现的动作名
+	Text      string    `json:"text"`      // 错误文本
+	Count     int       `json:"count"`     // 次数
+	TimeFirst time.Time `json:"timeFirst"` // 首次出现时间
+	TimeLast  time.Time `json:"timeLast"`  // 最后出现时间
 }
 
 // 结果摘要
@@ -154,9 +241,27 @@ func (d *ResultScene) String() (ret string) {
 		d.Batch, d.BatchMax, d.Category, d.BatchRobot, d.Concurrency, d.PerfLossRate, d.Tps90Avg,
 		d.TimeEnd.Sub(d.TimeEndLine).Seconds(),
 		d.ErrText)
+	if d.Generator != nil && d.Generator.Bound {
+		ret += fmt.Sprintf(` generator-bound:%s`, d.Generator.BoundText)
+	}
+	if d.Category == SceneCateReplay {
+		ret += fmt.Sprintf(` req:%d lag:%fs/%fs`, d.ReplayNum, d.ReplayLag90.Seconds(), d.ReplayLagMax.Seconds())
+	}
 	return
 }
 
+// 本轮每秒完成的动作数, 不含跳过的动作
+func (d *ResultScene) GetThroughput() float64 {
+	if d.TimeRun <= 0 {
+		return 0
+	}
+	count := 0
+	for _, a := range d.ActionArray {
+		count += a.Count
+	}
+	return PubFloatRound(float64(count)/d.TimeRun.Seconds(), 4)
+}
+
 // 创建新场景
 func NewScene(s *Scene) (d *Scene) {
 	if s != nil {
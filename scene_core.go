@@ -4,180 +4,139 @@ import (
 	"github.com/suboat/go-contrib"
 
 	"fmt"
+	"math"
 	"math/rand"
 	"runtime"
 	"sort"
-	"sync"
 	"time"
 )
 
-// 容量测试中的并发统计
-func (s *Scene) countConcurrency(l *sync.RWMutex, add int64, now, max *int64) {
-	l.Lock()
-	*now += add
-	if *now > *max {
-		*max = *now
+// 确定本次执行的随机种子: 未设置时取当前时间, 记入日志以便复现
+func (s *Scene) initSeed() {
+	if s.seed = s.Seed; s.seed == 0 {
+		s.seed = time.Now().UnixNano()
 	}
-	l.Unlock()
-	return
+	s.Log.Infof(`[scene-seed] %d`, s.seed)
 }
 
-// 运行容量测试
-func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScene, err error) {
-	if err = form.Valid(); err != nil {
-		return
+// 由本次执行的种子与参数派生随机数, 种子与参数相同时序列相同
+func (s *Scene) newRand(v ...int64) *rand.Rand {
+	return rand.New(rand.NewSource(pubSeedMix(s.seed, v...)))
+}
+
+// 将参数依次混入种子(splitmix64), 相近的参数得到不相关的种子
+func pubSeedMix(seed int64, v ...int64) int64 {
+	x := uint64(seed)
+	for _, n := range v {
+		x += uint64(n) + 0x9e3779b97f4a7c15
+		x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+		x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+		x ^= x >> 31
 	}
+	return int64(x)
+}
+
+// 检查默认机器人
+func (s *Scene) initDefaultRobot() (err error) {
 	if s.DefaultRobot == nil {
 		// 未定义默认机器人
 		if len(s.RobotArray) == 0 {
-			return nil, contrib.ErrParamInvalid.SetVars("defaultRobot")
+			return contrib.ErrParamInvalid.SetVars("defaultRobot")
 		}
 		s.DefaultRobot = s.RobotArray[0]
 	}
 	if s.DefaultRobot.Scene == nil {
 		s.DefaultRobot.Scene = s
 	}
+	return
+}
+
+// 运行容量测试
+func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScene, err error) {
+	if err = form.Valid(); err != nil {
+		return
+	}
+	if err = s.initDefaultRobot(); err != nil {
+		return
+	}
+	s.resetControl()
+	s.initSeed()
+	s.Breaker.reset()
 
 	//
 	var (
 		//
-		category     = form.Category                            // 测试类型
-		failBreak    = form.FailBreak                           // true: 遇错退出
-		failFast     = form.FailFast                            // true: 遇到错误终止1个机器人
-		failPerf     = PubFloatRound(float64(form.FailPerf), 4) // 性能下降阀值
-		periodAction = form.GetPeriodAction()                   // 接口调用周期
-		periodScene  = form.GetPeriodScene()                    // 场景时间跨度
-		numInit      = form.NumInit                             // 每轮增加机器人数目
-		numStep      = form.NumStep                             // 每轮增加机器人数目
-		batchMax     = form.BatchMax                            // 最大运行轮数
+		category    = form.Category                            // 测试类型
+		failBreak   = form.FailBreak                           // true: 遇错退出
+		failPerf    = PubFloatRound(float64(form.FailPerf), 4) // 性能下降阀值
+		periodScene = form.GetPeriodScene()                    // 场景时间跨度
+		numInit     = form.NumInit                             // 每轮增加机器人数目
+		numStep     = form.NumStep                             // 每轮增加机器人数目
+		batchMax    = form.BatchMax                            // 最大运行轮数
 		//
-		data           []*ResultScene                   // 测试报告
-		robots         [][]*Robot                       // 机器人运行结果
-		batch          = 0                              // 目前运行第几轮
-		batchRobot     = numInit                        // 本轮机器人数
-		lastError      error                            // 最后一个错误
-		concurrencyMax int64          = 0               // 累计最大并发
-		concurrencyNow int64          = 0               // 当前并发
-		countLock                     = &sync.RWMutex{} // 并发计数锁
+		data        []*ResultScene     // 测试报告
+		batch       = 0                // 目前运行第几轮
+		batchRobot  = numInit          // 本轮机器人数
+		lastError   error              // 最后一个错误
+		concurrency concurrencyCounter // 并发计数
+		clock       = s.GetClock()     // 时钟
 	)
+	clockAdd(clock, 1) // 主协程参与虚拟时钟的推进, 见ClockFake.Add
+	defer clockAdd(clock, -1)
+
+	// 结果输出
+	sink := s.newSink(cache)
+	defer s.closeSink(sink)
+	sig := s.watchSignal(sink)
+	defer sig.close()
+
+	// 并发计数
+	count := func(add int64) {
+		concurrency.add(add)
+		sink.OnConcurrency(add)
+	}
 
-	// 运行
-	fnRun := func() {
-		// debug
-		lastError = nil
-		//s.Log.Debugf(`[scene-batch] #%d/%d robots:%d`, batch+1, batchMax, batchRobot)
-
-		// 初始化机器人
-		//s.wg.Add(batchRobot) // 机器人计数, 在执行前加好
-		for len(s.RobotArray) < batchRobot {
-			if _robot, _err := s.DefaultRobot.Copy(); _err != nil {
-				err = _err
-				return
-			} else {
-				_robot.Serial = len(s.RobotArray)
-				_robot.Batch = batch
-				s.RobotArray = append(s.RobotArray, _robot)
-			}
+	// 执行一轮并统计: 本机执行, 或设置了工作节点时分摊到各节点执行
+	fnBatch := func(report, last *ResultScene) (lastError error, err error) {
+		var (
+			units [][]*RobotActionResult
+			part  *ResultPart
+		)
+		s.monitor.begin()
+		if s.Streaming {
+			part, lastError, err = s.runBatchStream(form, batch, batchRobot, 0, report, last, sink, count)
+		} else {
+			units, lastError, err = s.runBatch(form, batch, batchRobot, 0, sink, count)
+		}
+		generator := s.monitor.end()
+		if err != nil {
+			return
 		}
 
-		// 遍历机器人
-		for _, _d := range s.RobotArray {
-			// 初始化结果槽
-			robot := _d
-			for len(robot.ResultArray) < len(robot.ActionArray) {
-				robot.ResultArray = append(robot.ResultArray, nil)
-			}
-
-			// 动作计数
-			robot.wg.Add(len(robot.ActionArray))
-			go func() {
-				// 机器人执行完动作后告知场景
-				robot.wg.Wait()
-				robot.Scene.wg.Done()
-			}()
-
-			// 动作执行
-			go func() {
-				defer PanicRecover(s.Log)
-
-				// 在时间周期内随机起始时间
-				if category == SceneCateCapacity || category == SceneCateStable {
-					delay := time.Duration(int64(rand.Intn(int(periodAction)))) // 在场景时间内随机延时
-					if delay > 0 {
-						time.Sleep(delay)
-					}
-				}
-				robot.TimeCreate = time.Now()
-
-				// 顺序执行动作
-				failNum := 0
-				for _i, _d := range robot.ActionArray {
-					idxAction := _i
-					action := _d
-					record := &RobotActionResult{
-						Status: ActionStatusNormal,
-					}
-
-					// 运行或跳过
-					if failNum > 0 && failFast {
-						// 由于上一个动作错误将导致下一个错误
-						record.Status = ActionStatusClose
-						//record.Error = fmt.Errorf("fail fast")
-					} else {
-						// 运行前的参数准备
-						if _err := action.RunBefore(robot, idxAction, batch); _err != nil {
-							s.Log.Warnf(`[action-run-before] %s %d-%d `, robot.GetName(), batch, idxAction)
-						}
-
-						// 运行
-						_start := time.Now()
-						s.countConcurrency(countLock, 1, &concurrencyNow, &concurrencyMax)
-						_ret, _err := action.Run(robot, idxAction, batch)
-						s.countConcurrency(countLock, -1, &concurrencyNow, &concurrencyMax)
-						_spent := time.Since(_start)
-						// 结果
-						record.Result = _ret
-						record.Error = _err
-						record.TimeCreate = _start
-						record.TimeFinish = _start.Add(_spent)
-						record.TimeSpent = _spent
-						if record.Error != nil {
-							record.Status = ActionStatusWarn
-						}
-
-						// 运行后的处理
-						if _err := action.RunAfter(robot, idxAction, batch); _err != nil {
-							s.Log.Warnf(`[action-run-after] %s %d-%d `, robot.GetName(), batch, idxAction)
-						}
-
-						// 统计耗时
-						robot.TimeSpent += record.TimeSpent
-					}
-
-					// 错误计数
-					if record.Status != ActionStatusNormal {
-						//if record.Error != nil {
-						failNum += 1
-						if record.Error != nil {
-							lastError = record.Error
-						}
-					}
+		// 本轮统计: 耗时
+		report.TimeEnd = clock.Now()
+		report.TimeRun = report.TimeEnd.Sub(report.TimeStart)
 
-					// 将动作结果放入列队
-					robot.LockResult.Lock()
-					robot.ResultArray[idxAction] = record
-					robot.LockResult.Unlock()
+		// 本轮统计: 统计动作, 流式统计时由直方图得出
+		if part != nil {
+			report.statParts([]*ResultPart{part}, last)
+		} else {
+			report.statUnits(units, last)
+			report.statActions(s.DefaultRobot.ActionArray, units)
+		}
 
-					// next
-					// 这个机器人完成了所有动作
-					if _i == len(robot.ActionArray)-1 {
-						robot.TimeFinish = time.Now()
-						//robot.TimeSpent = robot.TimeFinish.Sub(robot.TimeCreate)
-					}
-					robot.wg.Done()
-				}
-			}()
+		// 本轮统计: 并发统计
+		report.Concurrency = concurrency.takeMax()
+		report.Generator = generator
+		return
+	}
+	if len(s.Workers) > 0 {
+		coordinator := newClusterCoordinator(s, form)
+		if err = coordinator.start(); err != nil {
+			return
 		}
+		defer coordinator.finish()
+		fnBatch = coordinator.runBatch
 	}
 
 	// log打印运行前参数
@@ -203,7 +162,9 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 				NumStep:      form.NumStep,
 				PeriodAction: form.PeriodAction,
 				PeriodScene:  form.PeriodScene,
+				Seed:         s.seed,
 				// 本轮统计
+				Scene:      s.Name,     // 场景名
 				Batch:      batch + 1,  // 本轮测试是第几周期
 				BatchRobot: batchRobot, // 本轮机器人数
 				// 其它
@@ -222,12 +183,12 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 		if len(data) > 0 && periodScene > 0 {
 			// 与上一轮期望的跨度有负差异
 			if last := data[len(data)-1]; last.TimeEndLine.Unix() > 0 {
-				now := time.Now()
+				now := clock.Now()
 				if diff := last.TimeEndLine.Sub(now); diff > 0 {
 					// 比预期提前完成
 					s.Log.Infof(`[scene-run-sleep] #%d %s <- %s sleep %.4fs after turn.`,
 						last.Batch, PubTimeToStr(now), PubTimeToStr(last.TimeEndLine), diff.Seconds())
-					time.Sleep(diff)
+					s.sleepControl(clock, diff)
 				} else {
 					// 延迟完成
 					s.Log.Warnf(`[scene-run-overlap] #%d %s <- %s overlap %.4fs`,
@@ -236,138 +197,44 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 			}
 		}
 
-		// 运行测试
-		report.TimeStart = time.Now()
+		// 运行测试: 暂停中则等待; 轮间已停止时不再开始新的一轮
+		if s.waitControl(clock) {
+			s.markStopped(data, sink, sig)
+			break
+		}
+		report.TimeStart = clock.Now()
 		report.BatchText = fmt.Sprintf(`#%d. %s`, batch+1, report.TimeStart.Format("15:04:05"))
 		if periodScene > 0 {
 			report.TimeEndLine = report.TimeStart.Add(periodScene) // 期望结束的时间
 		}
 		s.Log.Infof(`[scene-run-%s] #%d/%d %du start %s`, report.Category, report.Batch, report.BatchMax,
 			report.BatchRobot, PubTimeToStr(report.TimeStart))
-		s.wg.Add(batchRobot) // 机器人计数
-		go fnRun()
-		//time.Sleep(time.Millisecond * 200) // 并发已发出 FIXME: 取更有说服力的sleep时间
-		s.wg.Wait() // 等待所有机器人执行完
-
-		// 运行测试: 将机器人与结果归档
-		robots = append(robots, s.RobotArray)
-		for i, robot := range s.RobotArray {
-			if _err := robot.Close(); _err != nil {
-				s.Log.Warnf(`[robot-close] %d-%d/%d"`, batch, i+1, batchRobot)
-			}
+		sink.OnBatchStart(report)
+		sig.begin(report)
+		var last *ResultScene
+		if len(data) > 0 {
+			last = data[len(data)-1]
 		}
-		s.RobotArray = []*Robot{}
-
-		// 本轮统计: 耗时
-		report.TimeEnd = time.Now()
-		report.TimeRun = report.TimeEnd.Sub(report.TimeStart)
-
-		// 本轮统计: 统计动作
-		if batchRobot > 0 {
-			var (
-				total      = time.Duration(0) // 总耗时
-				numFail    = 0                // 错误数目
-				spentArray []int              // 总耗时
-			)
-			for _, d := range robots[len(robots)-1] {
-				total += d.TimeSpent
-				isSuccess := true
-				// 机器人所有操作记录
-				for _, r := range d.ResultArray {
-					if r == nil || r.Status != ActionStatusNormal {
-						numFail += 1
-						isSuccess = false
-						break
-					}
-					if r != nil && r.TimeSpent > 0 {
-						if report.RespFastest == 0 {
-							report.RespFastest = r.TimeSpent
-						}
-						if report.RespSlowest == 0 {
-							report.RespSlowest = r.TimeSpent
-						}
-						if r.TimeSpent > report.RespSlowest {
-							report.RespSlowest = r.TimeSpent
-						}
-						if r.TimeSpent < report.RespFastest {
-							report.RespFastest = r.TimeSpent
-						}
-					}
-				}
-				if isSuccess && d.TimeSpent > 0 {
-					spentArray = append(spentArray, int(d.TimeSpent))
-				}
-			}
-			// 90%成功耗时
-			sort.Ints(spentArray)
-			from90 := int(float64(len(spentArray)) * 0.05)
-			to90 := int(float64(len(spentArray)) * 0.95)
-			if to90 < from90 {
-				to90 = from90
-			}
-			total90 := 0
-			for _, _d := range spentArray[from90:to90] {
-				total90 += _d
-			}
-			if to90 > from90 {
-				report.PerfTime90Avg = time.Duration(total90 / (to90 - from90))
-			} else {
-				report.PerfTime90Avg = time.Duration(total90)
-			}
-			// 统计耗时
-			report.RespTotal = total
-			report.PerfTimeAvg = total / time.Duration(batchRobot)
-			// 错误率统计
-			report.FailRate = PubFloatRound(float64(numFail)/float64(batchRobot), 4) // 4位小数
-			// 性能下降率统计
-			if len(data) > 0 {
-				oldPerf := float64(data[len(data)-1].PerfTimeAvg)
-				newPerf := float64(report.PerfTimeAvg)
-				if oldPerf > 0 {
-					report.PerfLossRate = PubFloatRound((newPerf-oldPerf)/oldPerf, 4)
-				}
-			}
+		if lastError, err = fnBatch(report, last); err != nil {
+			return
 		}
 
-		// 本轮统计: 并发统计
-		report.Concurrency = concurrencyMax
-		concurrencyMax = 0
-		concurrencyNow = 0
-
 		// 本轮统计: 最后一个错误文本
 		if lastError != nil {
 			report.ErrText = lastError.Error() // 最后一个错误文本
 		}
-
-		// 本轮统计: TPS
-		if report.RespSlowest > 0 {
-			report.TpsMin = PubFloatRoundAuto(time.Second.Seconds() / report.RespSlowest.Seconds())
-		}
-		if report.RespFastest > 0 {
-			report.TpsMax = PubFloatRoundAuto(time.Second.Seconds() / report.RespFastest.Seconds())
-		}
-		if report.PerfTimeAvg > 0 {
-			report.TpsAvg = PubFloatRoundAuto(time.Second.Seconds() / report.PerfTimeAvg.Seconds())
-		}
-		if report.PerfTime90Avg > 0 {
-			report.Tps90Avg = PubFloatRoundAuto(time.Second.Seconds() / report.PerfTime90Avg.Seconds())
-		}
-
-		// 累计统计: 累计耗时
-		report.TotalTimeResp = report.RespTotal
-		report.TotalTimeRun = report.TimeRun
-		if len(data) > 0 {
-			last := data[len(data)-1]
-			report.TotalTimeRun += last.TotalTimeRun
-			report.TotalTimeResp += last.TotalTimeResp
+		if g := report.Generator; g != nil && g.Bound {
+			s.Log.Warnf(`[scene-generator-bound] #%d %s, latency may be inflated`, report.Batch, g.BoundText)
 		}
 
 		// 统计完成
 		data = append(data, report)
-		if len(robots) > 1 {
-			robots[len(robots)-2] = nil // FIXME: 优化内存使用, 释放已统计的机器人
-		}
 
+		// 退出条件0: 手动停止
+		if s.IsStopped() {
+			report.Status = s.getStopStatus()
+			report.Reason = s.GetStopReason()
+		}
 		// 退出条件1: 出现了错误
 		if lastError != nil {
 			s.Log.Errorf(`[scene-break] #%d(this) failsRate:%.4f%% #%d(last) failsRate:%.4f%% lastErr: %v`,
@@ -394,11 +261,8 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 		}
 
 		// 统计输出
-		if cache != nil {
-			cache <- report
-		} else {
-			s.Log.Infof(`[scene-batch] %s`, report.String())
-		}
+		sink.OnBatch(report)
+		sig.done(report)
 
 		// 退出
 		if report.Status != SceneStatusNormal {
@@ -408,7 +272,11 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 		// 进入下一轮
 		lastError = nil
 		batch += 1
-		batchRobot += numStep
+		if n := s.takeRescale(); n > 0 {
+			batchRobot = n
+		} else {
+			batchRobot += numStep
+		}
 		runtime.GC() //
 	}
 	if s.FnAfter != nil {
@@ -421,3 +289,505 @@ func (s *Scene) run(form *FormScene, cache chan *ResultScene) (ret []*ResultScen
 	ret = data
 	return
 }
+
+// 轮间停止: 最后一轮已输出, 将标记为停止的副本再输出一次, 以最后输出的为准
+func (s *Scene) markStopped(data []*ResultScene, sink ResultSink, sig *sceneSignal) {
+	n := len(data)
+	if n == 0 {
+		return
+	}
+	last := *data[n-1]
+	last.Status = s.getStopStatus()
+	last.Reason = s.GetStopReason()
+	sink.OnBatch(&last)
+	sig.amend(&last)
+	data[n-1] = &last
+}
+
+// 执行一轮: 创建batchRobot个机器人, 编号从serial起; 全部执行完后关闭机器人, 返回各机器人的动作结果与最后一个错误
+func (s *Scene) runBatch(form *FormScene, batch, batchRobot, serial int, sink ResultSink, count func(add int64)) (units [][]*RobotActionResult, lastError error, err error) {
+	var (
+		category     = form.Category          // 测试类型
+		failFast     = form.FailFast          // true: 遇到错误终止1个机器人
+		periodAction = form.GetPeriodAction() // 接口调用周期
+		clock        = s.GetClock()           // 时钟
+	)
+
+	// 初始化机器人
+	for len(s.RobotArray) < batchRobot {
+		if _robot, _err := s.DefaultRobot.Copy(); _err != nil {
+			err = _err
+			return
+		} else {
+			_robot.Serial = serial + len(s.RobotArray)
+			_robot.Batch = batch
+			_robot.Rand = s.newRand(int64(batch), int64(_robot.Serial))
+			s.RobotArray = append(s.RobotArray, _robot)
+		}
+	}
+
+	// 遍历机器人
+	start := clock.Now()
+	s.wg.Add(len(s.RobotArray)) // 机器人计数
+	clockAdd(clock, len(s.RobotArray))
+	for _, _d := range s.RobotArray {
+		// 初始化结果槽
+		robot := _d
+		if robot.Rand == nil {
+			// 调用方预先放入RobotArray的机器人
+			robot.Rand = s.newRand(int64(batch), int64(robot.Serial))
+		}
+		for len(robot.ResultArray) < len(robot.ActionArray) {
+			robot.ResultArray = append(robot.ResultArray, nil)
+		}
+
+		// 动作计数
+		robot.wg.Add(len(robot.ActionArray))
+		go func() {
+			// 机器人执行完动作后告知场景
+			robot.wg.Wait()
+			robot.Scene.wg.Done()
+		}()
+
+		// 动作执行
+		go func() {
+			defer clockAdd(clock, -1)
+			defer PanicRecover(s.Log)
+
+			// 在时间周期内随机起始时间, 实际起始晚于计划的时间计入调度延迟
+			at := start
+			if (category == SceneCateCapacity || category == SceneCateStable) && periodAction > 0 {
+				at = start.Add(time.Duration(robot.Rand.Int63n(int64(periodAction)))) // 在场景时间内随机延时
+				s.sleepControl(clock, at.Sub(clock.Now()))
+			}
+			robot.TimeCreate = clock.Now()
+			s.monitor.addLag(robot.TimeCreate.Sub(at))
+
+			// 顺序执行动作
+			s.runRobot(robot, batch, failFast, sink, count, func(idx int, record *RobotActionResult) {
+				robot.wg.Done()
+			})
+		}()
+	}
+	clockAdd(clock, -1) // 等待期间只由机器人推进虚拟时钟; 调用者已登记
+	s.wg.Wait()         // 等待所有机器人执行完
+	clockAdd(clock, 1)
+
+	// 将机器人与结果归档
+	for i, robot := range s.RobotArray {
+		if _err := robot.Close(); _err != nil {
+			s.Log.Warnf(`[robot-close] %d-%d/%d"`, batch, i+1, batchRobot)
+		}
+		units = append(units, robot.ResultArray)
+	}
+	s.RobotArray = []*Robot{}
+	lastError = lastUnitError(units)
+	return
+}
+
+// 机器人顺序执行一遍动作, 结果写入ResultArray并输出样本, 每完成一个动作回调fn
+func (s *Scene) runRobot(robot *Robot, batch int, failFast bool, sink ResultSink, count func(add int64), fn func(idx int, record *RobotActionResult)) {
+	var (
+		failNum = 0
+		clock   = s.GetClock()
+		samples = sinkWantSamples(sink) // 无输出需要时不生成样本
+		name    string
+		records = make([]RobotActionResult, len(robot.ActionArray)) // 各动作结果一次分配
+	)
+	if samples {
+		name = robot.GetName()
+	}
+	for _i, _d := range robot.ActionArray {
+		idxAction := _i
+		action := _d
+		record := &records[idxAction]
+		record.Status = ActionStatusNormal
+
+		// 运行或跳过: 暂停中则等待, 已停止则跳过; 思考与等待限流后再检查一次, 期间停止的也跳过
+		var (
+			_limit   time.Duration
+			_release func()
+			stopped  = s.waitControl(clock)
+			failed   = failNum > 0 && failFast // 由于上一个动作错误将导致下一个错误
+		)
+		if a, ok := action.(ActionThinking); ok && !stopped && !failed && a.GetThink() > 0 {
+			// 思考在限流之前, 不占用名额
+			s.sleepControl(clock, a.GetThink())
+			stopped = s.IsStopped()
+		}
+		if !stopped && !failed {
+			var ok bool
+			_limit, _release, ok = s.waitLimit(action, clock)
+			stopped = !ok || s.IsStopped()
+		}
+		if stopped || failed {
+			record.Status = ActionStatusClose
+			//record.Error = fmt.Errorf("fail fast")
+			if _release != nil {
+				_release()
+			}
+		} else {
+			// 运行前的参数准备
+			if _err := action.RunBefore(robot, idxAction, batch); _err != nil {
+				s.Log.Warnf(`[action-run-before] %s %d-%d `, robot.GetName(), batch, idxAction)
+			}
+
+			// 运行: 限流等待之后开始计时
+			_start := clock.Now()
+			count(1)
+			_ret, _err := s.runAction(action, robot, idxAction, batch)
+			count(-1)
+			_spent := clock.Now().Sub(_start)
+			if _release != nil {
+				_release()
+			}
+			// 结果
+			record.Result = _ret
+			record.Error = _err
+			record.TimeCreate = _start
+			record.TimeFinish = _start.Add(_spent)
+			record.TimeSpent = _spent
+			record.TimeLimit = _limit
+			if t, ok := _ret.(ActionTiming); ok {
+				record.TimeConnect = t.GetTimeConnect()
+				record.TimeFirstByte = t.GetTimeFirstByte()
+			}
+			if record.Error != nil {
+				record.Status = GetActionErrorStatus(record.Error)
+				record.ErrClass = s.GetErrorClass(record.Error)
+			}
+
+			// 运行后的处理
+			if _err := action.RunAfter(robot, idxAction, batch); _err != nil {
+				s.Log.Warnf(`[action-run-after] %s %d-%d `, robot.GetName(), batch, idxAction)
+			}
+
+			// 统计耗时
+			robot.TimeSpent += record.TimeSpent
+
+			// 熔断: 按执行了的动作统计错误率
+			if s.Breaker != nil {
+				s.checkBreaker(clock.Now(), record.Status != ActionStatusNormal)
+			}
+		}
+
+		// 错误计数
+		if record.Status != ActionStatusNormal {
+			//if record.Error != nil {
+			failNum += 1
+		}
+
+		// 将动作结果放入列队: 只由本机器人协程写入, 执行结束后读取
+		robot.ResultArray[idxAction] = record
+		if samples {
+			sink.OnSample(newResultSample(name, robot, idxAction, batch, action, record))
+		}
+
+		// next
+		// 这个机器人完成了所有动作
+		if _i == len(robot.ActionArray)-1 {
+			robot.TimeFinish = clock.Now()
+			//robot.TimeSpent = robot.TimeFinish.Sub(robot.TimeCreate)
+		}
+		if fn != nil {
+			fn(idxAction, record)
+		}
+	}
+}
+
+// 执行一个动作: panic时恢复并作为ErrorPanic返回, 机器人继续后续动作
+func (s *Scene) runAction(action Action, robot *Robot, step, batch int) (ret interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := &ErrorPanic{Value: r, Where: panicIdentify()}
+			s.Log.Errorf(`[action-panic] %s %d-%d "%s" %v`, robot.GetName(), batch, step, e.Where, r)
+			err = e
+		}
+	}()
+	return action.Run(robot, step, batch)
+}
+
+// 取错误分类: 优先使用ErrorClassifier
+func (s *Scene) GetErrorClass(err error) (ret string) {
+	if err == nil {
+		return
+	}
+	if s.ErrorClassifier != nil {
+		if ret = s.ErrorClassifier(err); len(ret) > 0 {
+			return
+		}
+	}
+	return GetErrorClass(err)
+}
+
+// 统计一轮的动作结果, units: 每个执行单元(如一个机器人)的全部动作结果, last: 上一轮结果
+func (d *ResultScene) statUnits(units [][]*RobotActionResult, last *ResultScene) {
+	// 本轮统计: 统计动作
+	if len(units) > 0 {
+		var (
+			total      = time.Duration(0) // 总耗时
+			numFail    = 0                // 错误数目
+			spentArray []int              // 总耗时
+		)
+		for _, unit := range units {
+			spent := time.Duration(0)
+			for _, r := range unit {
+				if r != nil {
+					spent += r.TimeSpent
+				}
+			}
+			total += spent
+			isSuccess := true
+			// 单元所有操作记录
+			for _, r := range unit {
+				if r == nil || r.Status != ActionStatusNormal {
+					numFail += 1
+					isSuccess = false
+					break
+				}
+				if r != nil && r.TimeSpent > 0 {
+					if d.RespFastest == 0 {
+						d.RespFastest = r.TimeSpent
+					}
+					if d.RespSlowest == 0 {
+						d.RespSlowest = r.TimeSpent
+					}
+					if r.TimeSpent > d.RespSlowest {
+						d.RespSlowest = r.TimeSpent
+					}
+					if r.TimeSpent < d.RespFastest {
+						d.RespFastest = r.TimeSpent
+					}
+				}
+			}
+			if isSuccess && spent > 0 {
+				spentArray = append(spentArray, int(spent))
+			}
+		}
+		// 90%成功耗时
+		sort.Ints(spentArray)
+		from90 := int(float64(len(spentArray)) * 0.05)
+		to90 := int(float64(len(spentArray)) * 0.95)
+		if to90 < from90 {
+			to90 = from90
+		}
+		total90 := 0
+		for _, _d := range spentArray[from90:to90] {
+			total90 += _d
+		}
+		if to90 > from90 {
+			d.PerfTime90Avg = time.Duration(total90 / (to90 - from90))
+		} else {
+			d.PerfTime90Avg = time.Duration(total90)
+		}
+		d.statUnitsTotal(len(units), numFail, total, last)
+	}
+	d.statTps(last)
+}
+
+// 由执行单元数, 失败单元数与总耗时统计平均耗时, 错误率与性能下降率
+func (d *ResultScene) statUnitsTotal(num, numFail int, total time.Duration, last *ResultScene) {
+	// 统计耗时
+	d.RespTotal = total
+	d.PerfTimeAvg = total / time.Duration(num)
+	// 错误率统计
+	d.FailRate = PubFloatRound(float64(numFail)/float64(num), 4) // 4位小数
+	// 性能下降率统计
+	if last != nil {
+		oldPerf := float64(last.PerfTimeAvg)
+		newPerf := float64(d.PerfTimeAvg)
+		if oldPerf > 0 {
+			d.PerfLossRate = PubFloatRound((newPerf-oldPerf)/oldPerf, 4)
+		}
+	}
+}
+
+// 由最快最慢与平均耗时统计TPS, 并累计耗时
+func (d *ResultScene) statTps(last *ResultScene) {
+	// 本轮统计: TPS
+	if d.RespSlowest > 0 {
+		d.TpsMin = PubFloatRoundAuto(time.Second.Seconds() / d.RespSlowest.Seconds())
+	}
+	if d.RespFastest > 0 {
+		d.TpsMax = PubFloatRoundAuto(time.Second.Seconds() / d.RespFastest.Seconds())
+	}
+	if d.PerfTimeAvg > 0 {
+		d.TpsAvg = PubFloatRoundAuto(time.Second.Seconds() / d.PerfTimeAvg.Seconds())
+	}
+	if d.PerfTime90Avg > 0 {
+		d.Tps90Avg = PubFloatRoundAuto(time.Second.Seconds() / d.PerfTime90Avg.Seconds())
+	}
+
+	// 累计统计: 累计耗时
+	d.TotalTimeResp = d.RespTotal
+	d.TotalTimeRun = d.TimeRun
+	if last != nil {
+		d.TotalTimeRun += last.TotalTimeRun
+		d.TotalTimeResp += last.TotalTimeResp
+	}
+}
+
+// 按动作统计一轮的结果, actions: 机器人的动作, units: 每个执行单元的全部动作结果
+func (d *ResultScene) statActions(actions []Action, units [][]*RobotActionResult) {
+	errors := map[string]*ResultError{}
+	d.ActionArray = make([]*ResultCapacityAction, len(actions))
+	for i, a := range actions {
+		var (
+			item    = &ResultCapacityAction{Name: a.GetName(), Step: i}
+			spent   []time.Duration
+			total   time.Duration
+			connect time.Duration
+			first   time.Duration
+			limit   time.Duration
+		)
+		for _, unit := range units {
+			if i >= len(unit) || unit[i] == nil {
+				continue
+			}
+			r := unit[i]
+			if r.Status == ActionStatusClose && r.TimeCreate.IsZero() {
+				item.Skip += 1
+				continue
+			}
+			item.Count += 1
+			if r.Status != ActionStatusNormal {
+				item.Fail += 1
+				if r.Error != nil {
+					item.ErrText = r.Error.Error()
+				}
+				class := resultErrorClass(r)
+				if item.ErrorClass == nil {
+					item.ErrorClass = map[string]int{}
+				}
+				item.ErrorClass[class] += 1
+				addResultError(errors, item.Name, class, r)
+			}
+			spent = append(spent, r.TimeSpent)
+			total += r.TimeSpent
+			connect += r.TimeConnect
+			first += r.TimeFirstByte
+			limit += r.TimeLimit
+		}
+		if item.Count > 0 {
+			sort.Slice(spent, func(i, j int) bool { return spent[i] < spent[j] })
+			item.FailRate = PubFloatRound(float64(item.Fail)/float64(item.Count), 4)
+			item.TimeAvg = total / time.Duration(item.Count)
+			item.TimeMin = spent[0]
+			item.TimeMax = spent[len(spent)-1]
+			item.TimeP50 = spent[(len(spent)-1)*50/100]
+			item.TimeP90 = spent[(len(spent)-1)*90/100]
+			item.TimeP95 = spent[(len(spent)-1)*95/100]
+			item.TimeP99 = spent[(len(spent)-1)*99/100]
+			if item.Count > 1 {
+				var (
+					avg = float64(item.TimeAvg)
+					sum float64
+				)
+				for _, v := range spent {
+					sum += (float64(v) - avg) * (float64(v) - avg)
+				}
+				item.TimeStd = time.Duration(math.Sqrt(sum / float64(item.Count-1)))
+			}
+			item.TimeConnect = connect / time.Duration(item.Count)
+			item.TimeFirstByte = first / time.Duration(item.Count)
+			item.TimeLimit = limit / time.Duration(item.Count)
+		}
+		d.ActionArray[i] = item
+	}
+	d.statErrors(errors)
+}
+
+// 由各动作的错误分类与错误文本统计本轮的错误分类与最多的错误
+func (d *ResultScene) statErrors(errors map[string]*ResultError) {
+	d.ErrorClass = nil
+	for _, a := range d.ActionArray {
+		for k, v := range a.ErrorClass {
+			if d.ErrorClass == nil {
+				d.ErrorClass = map[string]int{}
+			}
+			d.ErrorClass[k] += v
+		}
+	}
+	d.ErrorTop = topResultErrors(errors, DefaultErrorTop)
+}
+
+// 失败动作的错误分类, 没有错误时为ErrorClassOther
+func resultErrorClass(r *RobotActionResult) (ret string) {
+	if ret = r.ErrClass; len(ret) == 0 {
+		if ret = GetErrorClass(r.Error); len(ret) == 0 {
+			ret = ErrorClassOther
+		}
+	}
+	return
+}
+
+// 按错误文本计入一个失败动作, 不同文本超出DefaultErrorDistinct后不再记录新文本
+func addResultError(errors map[string]*ResultError, action, class string, r *RobotActionResult) {
+	if r.Error == nil {
+		return
+	}
+	var (
+		text = r.Error.Error()
+		at   = r.TimeFinish
+	)
+	e, ok := errors[text]
+	if !ok {
+		if len(errors) >= DefaultErrorDistinct {
+			return
+		}
+		e = &ResultError{Class: class, Action: action, Text: text, TimeFirst: at, TimeLast: at}
+		errors[text] = e
+	}
+	e.Count += 1
+	if at.Before(e.TimeFirst) {
+		e.TimeFirst = at
+		e.Action = action
+	}
+	if at.After(e.TimeLast) {
+		e.TimeLast = at
+	}
+}
+
+// 合并错误文本统计
+func mergeResultErrors(dst, src map[string]*ResultError) {
+	for text, o := range src {
+		e, ok := dst[text]
+		if !ok {
+			if len(dst) >= DefaultErrorDistinct {
+				continue
+			}
+			e = &ResultError{}
+			*e = *o
+			dst[text] = e
+			continue
+		}
+		e.Count += o.Count
+		if o.TimeFirst.Before(e.TimeFirst) {
+			e.TimeFirst = o.TimeFirst
+			e.Action = o.Action
+		}
+		if o.TimeLast.After(e.TimeLast) {
+			e.TimeLast = o.TimeLast
+		}
+	}
+}
+
+// 次数最多的n个错误文本, 次数相同时先出现的在前
+func topResultErrors(errors map[string]*ResultError, n int) (ret []*ResultError) {
+	for _, e := range errors {
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		if !ret[i].TimeFirst.Equal(ret[j].TimeFirst) {
+			return ret[i].TimeFirst.Before(ret[j].TimeFirst)
+		}
+		return ret[i].Text < ret[j].Text
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return
+}
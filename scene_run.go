@@ -28,3 +28,8 @@ func (s *Scene) RunStable(form *FormStable, cache chan *ResultScene) (ret []*Res
 	}
 	return s.run(formScene, cache)
 }
+
+// 执行日志回放: 按日志中请求的相对时间(除以倍速)调度, 每条请求由机器人池中空闲的机器人执行一遍动作
+func (s *Scene) RunReplay(form *FormReplay, cache chan *ResultScene) (ret []*ResultScene, err error) {
+	return s.runReplay(form, cache)
+}
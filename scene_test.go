@@ -3,6 +3,8 @@ package box
 import (
 	"github.com/stretchr/testify/require"
 
+	"math/rand"
+	"sync"
 	"testing"
 	"time"
 )
@@ -83,3 +85,83 @@ func Test_Chan(t *testing.T) {
 	t.Log("haha")
 	time.Sleep(time.Second * 2000)
 }
+
+// 测试随机种子: 种子相同时各机器人的随机数与起始延时相同
+func Test_SceneSeed(t *testing.T) {
+	as := require.New(t)
+	run := func(seed int64, streaming bool) (values map[int]int64, report *ResultScene) {
+		var lock sync.Mutex
+		values = map[int]int64{}
+		robot := NewRobot(&Robot{Name: "robot"})
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "roll",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				lock.Lock()
+				values[batch*1000+u.Serial] = u.Rand.Int63()
+				lock.Unlock()
+				return
+			},
+		})))
+		scene := NewScene(&Scene{Name: "seed", DefaultRobot: robot, Seed: seed, Streaming: streaming})
+		scene.Log.SetLevel(1)
+		data, err := scene.RunCapacity(&FormCapacity{NumInit: 20, NumStep: 10, BatchMax: 2, PeriodAction: 1}, nil)
+		as.Nil(err)
+		as.Len(data, 2)
+		return values, data[0]
+	}
+
+	for _, streaming := range []bool{false, true} {
+		a, report := run(42, streaming)
+		b, _ := run(42, streaming)
+		c, _ := run(43, streaming)
+		as.Len(a, 50)
+		as.Equal(a, b)
+		as.NotEqual(a, c)
+		as.EqualValues(42, report.Seed)
+	}
+
+	// 未设置种子时取当前时间并记入报告
+	_, report := run(0, false)
+	as.NotZero(report.Seed)
+
+	// 派生的随机数由种子与参数决定
+	s := NewScene(&Scene{Seed: 7})
+	s.initSeed()
+	r1, r2 := s.newRand(1, 2), s.newRand(1, 2)
+	as.Equal(r1.Int63n(1000), r2.Int63n(1000))
+	as.NotEqual(pubSeedMix(7, 1, 2), pubSeedMix(7, 2, 1))
+	as.NotEqual(pubSeedMix(7, 1, 2), pubSeedMix(7, 1, 2, -1))
+
+	// 模板中的随机函数由机器人的随机数生成
+	tpl, err := NewActionTemplate(`{{randCode 8}} {{randCodeNum 4}} {{randInt 100}} {{uuid}}`)
+	as.Nil(err)
+	var texts []string
+	for _, r := range []*rand.Rand{s.newRand(1, 2), s.newRand(1, 2), s.newRand(1, 3)} {
+		text, _err := tpl.Render(NewRobot(&Robot{Name: "robot", Rand: r}), 0, 0)
+		as.Nil(_err)
+		texts = append(texts, text)
+	}
+	as.Equal(texts[0], texts[1])
+	as.NotEqual(texts[0], texts[2])
+	as.Regexp(`^[a-z0-9]{8} [0-9]{4} [0-9]+ [0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-`, texts[0])
+
+	// 周期为0时不延时
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "noop"})))
+	data, err := NewScene(&Scene{DefaultRobot: robot}).RunCapacity(&FormCapacity{NumInit: 5, BatchMax: 1}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+
+	// 调用方预先放入RobotArray的机器人也有Rand
+	scene := NewScene(&Scene{Name: "seed", Seed: 7})
+	scene.Log.SetLevel(1)
+	for i := 0; i < 3; i++ {
+		r := NewRobot(&Robot{Name: "robot", Serial: i, Scene: scene})
+		as.Nil(r.AddAction(NewActionOne(&ActionOne{Name: "noop"})))
+		scene.RobotArray = append(scene.RobotArray, r)
+	}
+	data, err = scene.RunCapacity(&FormCapacity{NumInit: 3, BatchMax: 1, PeriodAction: 10}, nil)
+	as.Nil(err)
+	as.Len(data, 1)
+	as.Equal(3, data[0].ActionArray[0].Count)
+}
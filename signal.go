@@ -0,0 +1,25 @@
+package box
+
+import (
+	"os"
+	"sync"
+)
+
+// 默认参数
+var (
+	DefaultSignalExitCode = 130 // 第二次信号强制退出时的退出码
+)
+
+// 强制退出, 测试中替换
+var signalExit = os.Exit
+
+// 执行中的信号处理, 见Scene.Signal
+type sceneSignal struct {
+	ch     chan os.Signal // 收到的信号
+	stop   chan struct{}  // 执行结束时关闭
+	sink   SinkMulti      // 本次执行的结果输出
+	data   []*ResultScene // 已输出的各轮
+	report *ResultScene   // 执行中的本轮, 开始时的副本
+	wg     sync.WaitGroup //
+	lock   sync.Mutex     //
+}
@@ -0,0 +1,118 @@
+package box
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 开始处理SIGINT/SIGTERM, 未设置Scene.Signal时返回空, 空值的方法均可调用
+func (s *Scene) watchSignal(sink SinkMulti) (w *sceneSignal) {
+	if !s.Signal {
+		return
+	}
+	w = &sceneSignal{
+		ch:   make(chan os.Signal, 2),
+		stop: make(chan struct{}),
+		sink: sink,
+	}
+	signal.Notify(w.ch, os.Interrupt, syscall.SIGTERM)
+	w.wg.Add(1)
+	go s.loopSignal(w)
+	return
+}
+
+// 第一次信号停止, 第二次输出已有结果后强制退出
+func (s *Scene) loopSignal(w *sceneSignal) {
+	defer w.wg.Done()
+	for num := 0; ; {
+		select {
+		case <-w.stop:
+			return
+		case sig := <-w.ch:
+			num += 1
+			if num == 1 {
+				s.Log.Warnf(`[scene-signal] %v, finishing this batch; send again to exit now`, sig)
+				s.stop(SceneStatusInterrupt, "signal: "+sig.String())
+				continue
+			}
+			s.Log.Warnf(`[scene-signal] %v again, exit now`, sig)
+			data := w.interrupt(s.GetClock().Now(), "signal: "+sig.String()+" again, exit")
+			s.closeSink(w.sink)
+			if s.FnExit != nil {
+				s.FnExit(s, data)
+			}
+			signalExit(DefaultSignalExitCode)
+			return
+		}
+	}
+}
+
+// 一轮开始
+func (w *sceneSignal) begin(report *ResultScene) {
+	if w == nil {
+		return
+	}
+	cp := *report
+	w.lock.Lock()
+	w.report = &cp
+	w.lock.Unlock()
+}
+
+// 一轮已输出
+func (w *sceneSignal) done(report *ResultScene) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	w.data = append(w.data, report)
+	w.report = nil
+	w.lock.Unlock()
+}
+
+// 最后一轮再次输出, 替换已有的
+func (w *sceneSignal) amend(report *ResultScene) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	if n := len(w.data); n > 0 {
+		w.data[n-1] = report
+	}
+	w.lock.Unlock()
+}
+
+// 将执行中的本轮标记为中断并输出, 返回已有的各轮
+func (w *sceneSignal) interrupt(now time.Time, reason string) (data []*ResultScene) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	data = append(data, w.data...)
+	if r := w.report; r != nil {
+		r.Status = SceneStatusInterrupt
+		r.Reason = reason
+		r.TimeEnd = now
+		r.TimeRun = r.TimeEnd.Sub(r.TimeStart)
+		w.sink.OnBatch(r)
+		data = append(data, r)
+		w.report = nil
+	} else if len(data) > 0 {
+		// 轮间: 最后一轮已输出, 将标记为中断的副本再输出一次, 以最后输出的为准
+		last := *data[len(data)-1]
+		last.Status = SceneStatusInterrupt
+		last.Reason = reason
+		w.sink.OnBatch(&last)
+		data[len(data)-1] = &last
+	}
+	return
+}
+
+// 执行结束, 停止处理信号
+func (w *sceneSignal) close() {
+	if w == nil {
+		return
+	}
+	signal.Stop(w.ch)
+	close(w.stop)
+	w.wg.Wait()
+}
@@ -0,0 +1,158 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试信号处理: 第一次结束本轮并执行FnAfter, 第二次输出已有结果后强制退出
+func Test_SceneSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signal")
+	}
+	as := require.New(t)
+	self, err := os.FindProcess(os.Getpid())
+	as.Nil(err)
+
+	// 第一次: 本轮余下的动作跳过, 以SceneStatusInterrupt结束
+	var (
+		once  sync.Once
+		after int
+	)
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "work",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			if batch == 1 {
+				once.Do(func() { self.Signal(os.Interrupt) })
+				for start := time.Now(); !u.Scene.IsStopped() && time.Since(start) < time.Second*5; {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			return
+		},
+	})))
+	for i := 0; i < 3; i++ {
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "next", Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			return
+		}})))
+	}
+	scene := NewScene(&Scene{Name: "signal", DefaultRobot: robot, Signal: true, FnAfter: func(s *Scene) (err error) {
+		after += 1
+		return
+	}})
+	scene.Log.SetLevel(1)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 5, BatchMax: 10}, nil)
+	as.Nil(err)
+	as.Len(data, 2)
+	as.Equal(1, after)
+	r := data[1]
+	as.Equal(SceneStatusInterrupt, r.Status)
+	as.Equal("signal: interrupt", r.Reason)
+	as.True(r.ActionArray[1].Skip > 0)
+	as.Equal("interrupted", progressStatus(r.Status))
+	as.Equal(ReportVerdictFail, NewReport("signal", data).Verdict)
+
+	// 轮间: 不再开始新的一轮, 最后一轮标记为中断后再次输出
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "work"})))
+	scene = NewScene(&Scene{Name: "signal", DefaultRobot: robot, Signal: true})
+	scene.Log.SetLevel(1)
+	var (
+		between  = make(chan *ResultScene)
+		received []*ResultScene
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range between {
+			if len(received) == 0 {
+				self.Signal(os.Interrupt)
+			}
+			received = append(received, r)
+		}
+	}()
+	data, err = scene.RunSurge(&FormSurge{NumInit: 3, BatchMax: 5, PeriodScene: 500}, between)
+	as.Nil(err)
+	close(between)
+	wg.Wait()
+	as.Len(data, 1)
+	as.Equal(SceneStatusInterrupt, data[0].Status)
+	as.Equal("signal: interrupt", data[0].Reason)
+	as.Zero(data[0].FailRate)
+	as.Len(received, 2)
+	as.Equal(SceneStatusNormal, received[0].Status)
+	as.Equal(1, received[1].Batch)
+	as.Equal(SceneStatusInterrupt, received[1].Status)
+
+	// 第二次: 输出被中断的本轮后调用FnExit并退出
+	exit := make(chan int, 1)
+	signalExit = func(code int) { exit <- code }
+	defer func() { signalExit = os.Exit }()
+	var (
+		lock   sync.Mutex
+		exited []*ResultScene
+	)
+	robot = NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+		Name: "work",
+		Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+			if u.Serial == 0 {
+				self.Signal(os.Interrupt)
+				time.Sleep(time.Millisecond * 50)
+				self.Signal(os.Interrupt)
+				select {
+				case code := <-exit:
+					as.Equal(DefaultSignalExitCode, code)
+				case <-time.After(time.Second * 5):
+					t.Error("no exit")
+				}
+			}
+			return
+		},
+	})))
+	scene = NewScene(&Scene{Name: "signal", DefaultRobot: robot, Signal: true, FnExit: func(s *Scene, data []*ResultScene) {
+		lock.Lock()
+		exited = data
+		lock.Unlock()
+	}})
+	scene.Log.SetLevel(1)
+	var (
+		cache  = make(chan *ResultScene, 10)
+		output []*ResultScene
+	)
+	data, err = scene.RunSurge(&FormSurge{NumInit: 3, BatchMax: 10}, cache)
+	as.Nil(err)
+	close(cache)
+	for r := range cache {
+		output = append(output, r)
+	}
+	lock.Lock()
+	as.Len(exited, 1)
+	as.Equal(SceneStatusInterrupt, exited[0].Status)
+	as.Equal("signal: interrupt again, exit", exited[0].Reason)
+	as.Equal(3, exited[0].BatchRobot)
+	lock.Unlock()
+	as.NotEmpty(output) // 测试中未真正退出, 之后还会输出本轮的统计
+	as.Equal(exited[0], output[0])
+	as.Len(data, 1)
+	as.Equal(SceneStatusInterrupt, data[0].Status)
+
+	// 轮间强制退出: 最后一轮标记为中断后再次输出
+	collect := new(testSink)
+	w := &sceneSignal{sink: SinkMulti{collect}}
+	w.done(&ResultScene{Batch: 1, Status: SceneStatusNormal})
+	got := w.interrupt(time.Now(), "signal: interrupt again, exit")
+	as.Len(got, 1)
+	as.Len(collect.batches, 1)
+	as.Equal(got[0], collect.batches[0])
+	as.Equal(SceneStatusInterrupt, collect.batches[0].Status)
+	as.Equal(1, collect.batches[0].Batch)
+	as.Equal(SceneStatusNormal, w.data[0].Status)
+}
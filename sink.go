@@ -0,0 +1,109 @@
+package box
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 默认参数
+var (
+	DefaultSinkAsyncSize = 8192 // 异步输出的队列长度, 超出后等待, 设置SinkAsync.Drop时丢弃样本
+)
+
+// 结果输出: 场景执行中逐个输出动作样本, 每轮结束输出统计
+type ResultSink interface {
+	OnSample(d *ResultSample) // 一个动作完成或被跳过, 在机器人协程中调用
+	OnBatch(d *ResultScene)   // 一轮统计完成
+	Close() error             // 关闭, 由创建方调用; Scene.Sink在执行结束时只Flush不关闭
+}
+
+// 写出缓冲, 结果输出可选实现; Scene.Sink在每次执行结束时调用, 之后仍可继续使用
+type ResultSinkFlush interface {
+	Flush() error // 写出缓冲的结果, 不关闭
+}
+
+// 是否需要动作样本, 结果输出可选实现, 未实现时视为需要; 都不需要时场景不生成样本
+type ResultSinkSamples interface {
+	WantSamples() bool
+}
+
+// 实时状态回调, 结果输出可选实现; 同步调用, 须快速返回
+type ResultSinkLive interface {
+	OnBatchStart(d *ResultScene) // 一轮开始, 仅执行参数与本轮机器人数有效
+	OnConcurrency(add int64)     // 并发变化
+}
+
+// 一个动作样本
+type ResultSample struct {
+	Robot         string             `json:"robot"`     // 机器人名
+	Serial        int                `json:"serial"`    // 机器人编号
+	Batch         int                `json:"batch"`     // 轮次, 0起始
+	Step          int                `json:"step"`      // 动作位置, 0起始
+	Action        string             `json:"action"`    // 动作名
+	TimeStart     time.Time          `json:"start"`     // 开始时间, 跳过的动作为空
+	TimeSpent     time.Duration      `json:"spent"`     // 耗时
+	TimeConnect   time.Duration      `json:"connect"`   // 建立连接耗时
+	TimeFirstByte time.Duration      `json:"firstByte"` // 首字节耗时
+	TimeLimit     time.Duration      `json:"limit"`     // 开始前等待限流的时间, 不计入耗时
+	Status        int                `json:"status"`    // 动作状态
+	ErrClass      string             `json:"class"`     // 错误分类, 见GetErrorClass
+	ErrText       string             `json:"error"`     // 错误文本
+	Record        *RobotActionResult `json:"-"`         // 原始结果
+}
+
+// 输出到通道: 每轮结果阻塞写入Cache, 设置Timeout后等待超时视为无人读取, 之后的结果直接丢弃; 样本非阻塞写入Samples, 通道满时丢弃
+type SinkChan struct {
+	Cache   chan *ResultScene  // 每轮结果
+	Samples chan *ResultSample // 动作样本, 可为空
+	Timeout time.Duration      // 写入每轮结果的最长等待, 0:一直等待
+	//
+	dropped int64 // 丢弃的每轮结果
+	stalled int32 // 1: 已超时
+}
+
+// 输出到日志: 每轮一行摘要, 失败的样本以调试级别输出
+type SinkLog struct {
+	Log     Logger // 日志
+	Samples bool   // true: 输出失败的样本
+}
+
+// 以json行写入文件: 样本与每轮结果各占一行, 以type区分
+type SinkFile struct {
+	Path    string    // 文件地址, 追加写入
+	Writer  io.Writer // 未设置Path时写入这里
+	Samples bool      // true: 写入样本
+	//
+	file   *os.File
+	buf    *bufio.Writer
+	closed bool // 已关闭, 之后的写入丢弃
+	lock   sync.Mutex
+}
+
+// 同时输出到多个
+type SinkMulti []ResultSink
+
+// 异步输出: 在独立协程中调用原输出, 队列未满时机器人不因输出慢而等待
+type SinkAsync struct {
+	Sink ResultSink // 原输出
+	Size int        // 队列长度, 默认DefaultSinkAsyncSize
+	Drop bool       // true: 队列满时丢弃样本 false: 等待队列空出, 不丢弃
+	//
+	dropped int64 // 队列满时丢弃的样本数
+	queue   []interface{}
+	samples int
+	busy    bool // 输出协程正在输出取出的队列
+	closed  bool
+	lock    sync.Mutex
+	cond    *sync.Cond // 入队或关闭时通知输出协程
+	idle    *sync.Cond // 队列输出完毕时通知Flush
+	space   *sync.Cond // 队列取出或关闭时通知等待入队的样本
+	done    chan struct{}
+}
+
+// 场景持有的Scene.Sink: 执行结束时只Flush, 由创建方关闭
+type sinkKeep struct {
+	ResultSink
+}
@@ -0,0 +1,491 @@
+package box
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 由动作结果生成样本
+func NewResultSample(u *Robot, step, batch int, action Action, record *RobotActionResult) (ret *ResultSample) {
+	return newResultSample(u.GetName(), u, step, batch, action, record)
+}
+
+// 由动作结果生成样本, 机器人名由调用方生成一次后复用
+func newResultSample(name string, u *Robot, step, batch int, action Action, record *RobotActionResult) (ret *ResultSample) {
+	ret = &ResultSample{
+		Robot:         name,
+		Serial:        u.Serial,
+		Batch:         batch,
+		Step:          step,
+		Action:        action.GetName(),
+		TimeStart:     record.TimeCreate,
+		TimeSpent:     record.TimeSpent,
+		TimeConnect:   record.TimeConnect,
+		TimeFirstByte: record.TimeFirstByte,
+		TimeLimit:     record.TimeLimit,
+		Status:        record.Status,
+		Record:        record,
+	}
+	if record.Error != nil {
+		ret.ErrClass = record.ErrClass
+		if len(ret.ErrClass) == 0 {
+			ret.ErrClass = GetErrorClass(record.Error)
+		}
+		ret.ErrText = record.Error.Error()
+	}
+	return
+}
+
+// 是否为因前序动作失败而跳过的样本
+func (d *ResultSample) IsSkip() bool {
+	return d.Status == ActionStatusClose && d.TimeStart.IsZero()
+}
+
+// 是否需要动作样本, 见ResultSinkSamples
+func sinkWantSamples(sink ResultSink) bool {
+	if w, ok := sink.(ResultSinkSamples); ok {
+		return w.WantSamples()
+	}
+	return sink != nil
+}
+
+// 创建通道输出
+func NewSinkChan(cache chan *ResultScene, timeout time.Duration) *SinkChan {
+	return &SinkChan{Cache: cache, Timeout: timeout}
+}
+
+//
+func (d *SinkChan) OnSample(r *ResultSample) {
+	if d.Samples != nil {
+		select {
+		case d.Samples <- r:
+		default:
+		}
+	}
+}
+
+//
+func (d *SinkChan) OnBatch(r *ResultScene) {
+	if d.Cache == nil {
+		return
+	}
+	if d.Timeout <= 0 {
+		d.Cache <- r
+		return
+	}
+	if atomic.LoadInt32(&d.stalled) == 0 {
+		t := time.NewTimer(d.Timeout)
+		defer t.Stop()
+		select {
+		case d.Cache <- r:
+			return
+		case <-t.C:
+			atomic.StoreInt32(&d.stalled, 1)
+		}
+	} else {
+		select {
+		case d.Cache <- r:
+			return
+		default:
+		}
+	}
+	atomic.AddInt64(&d.dropped, 1)
+}
+
+// 设置了Samples时需要样本
+func (d *SinkChan) WantSamples() bool {
+	return d.Samples != nil
+}
+
+// 取丢弃的每轮结果数
+func (d *SinkChan) GetDropped() int64 {
+	return atomic.LoadInt64(&d.dropped)
+}
+
+// 不关闭通道, 由调用方关闭
+func (d *SinkChan) Close() error {
+	return nil
+}
+
+// 创建日志输出, 输出失败的样本
+func NewSinkLog(log Logger) *SinkLog {
+	return &SinkLog{Log: log, Samples: true}
+}
+
+//
+func (d *SinkLog) OnSample(r *ResultSample) {
+	if d.Samples && r.Status != ActionStatusNormal && len(r.ErrText) > 0 {
+		d.Log.Debugf(`[scene-sample] #%d %s %s %s %s: %s`, r.Batch+1, r.Robot, r.Action, r.TimeSpent, r.ErrClass, r.ErrText)
+	}
+}
+
+//
+func (d *SinkLog) OnBatch(r *ResultScene) {
+	d.Log.Infof(`[scene-batch] %s`, r.String())
+}
+
+//
+func (d *SinkLog) Close() error {
+	return nil
+}
+
+//
+func (d *SinkLog) WantSamples() bool {
+	return d.Samples
+}
+
+// 创建文件输出, 追加写入
+func NewSinkFile(filePath string, samples bool) (d *SinkFile, err error) {
+	d = &SinkFile{Path: filePath, Samples: samples}
+	if d.file, err = os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666); err != nil {
+		return nil, err
+	}
+	d.buf = bufio.NewWriter(d.file)
+	return
+}
+
+// 写入一行
+func (d *SinkFile) write(kind string, v interface{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return
+	}
+	if d.buf == nil {
+		if d.Writer == nil {
+			return
+		}
+		d.buf = bufio.NewWriter(d.Writer)
+	}
+	b, err := json.Marshal(map[string]interface{}{"type": kind, "data": v})
+	if err != nil {
+		return
+	}
+	d.buf.Write(b)
+	d.buf.WriteByte('\n')
+}
+
+//
+func (d *SinkFile) OnSample(r *ResultSample) {
+	if d.Samples {
+		d.write("sample", r)
+	}
+}
+
+// 每轮结果写入后刷新
+func (d *SinkFile) OnBatch(r *ResultScene) {
+	d.write("batch", r)
+	d.lock.Lock()
+	if d.buf != nil {
+		d.buf.Flush()
+	}
+	d.lock.Unlock()
+}
+
+// 设置了Samples时需要样本
+func (d *SinkFile) WantSamples() bool {
+	return d.Samples
+}
+
+// 写出缓冲
+func (d *SinkFile) Flush() (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.buf != nil {
+		err = d.buf.Flush()
+	}
+	return
+}
+
+// 关闭后的写入丢弃
+func (d *SinkFile) Close() (err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = true
+	if d.buf != nil {
+		err = d.buf.Flush()
+	}
+	d.buf = nil
+	if d.file != nil {
+		if _err := d.file.Close(); err == nil {
+			err = _err
+		}
+		d.file = nil
+	}
+	return
+}
+
+//
+func (d SinkMulti) OnSample(r *ResultSample) {
+	for _, s := range d {
+		s.OnSample(r)
+	}
+}
+
+//
+func (d SinkMulti) OnBatch(r *ResultScene) {
+	for _, s := range d {
+		s.OnBatch(r)
+	}
+}
+
+// 任一输出需要样本
+func (d SinkMulti) WantSamples() bool {
+	for _, s := range d {
+		if sinkWantSamples(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 写出全部可写出的, 返回第一个错误
+func (d SinkMulti) Flush() (err error) {
+	for _, s := range d {
+		if f, ok := s.(ResultSinkFlush); ok {
+			if _err := f.Flush(); _err != nil && err == nil {
+				err = _err
+			}
+		}
+	}
+	return
+}
+
+// 关闭全部, 返回第一个错误
+func (d SinkMulti) Close() (err error) {
+	for _, s := range d {
+		if _err := s.Close(); _err != nil && err == nil {
+			err = _err
+		}
+	}
+	return
+}
+
+//
+func (d SinkMulti) OnBatchStart(r *ResultScene) {
+	for _, s := range d {
+		if l, ok := s.(ResultSinkLive); ok {
+			l.OnBatchStart(r)
+		}
+	}
+}
+
+//
+func (d SinkMulti) OnConcurrency(add int64) {
+	for _, s := range d {
+		if l, ok := s.(ResultSinkLive); ok {
+			l.OnConcurrency(add)
+		}
+	}
+}
+
+// 创建异步输出并启动输出协程
+func NewSinkAsync(sink ResultSink, size int) (d *SinkAsync) {
+	d = &SinkAsync{Sink: sink, Size: size}
+	if d.Size <= 0 {
+		d.Size = DefaultSinkAsyncSize
+	}
+	d.cond = sync.NewCond(&d.lock)
+	d.idle = sync.NewCond(&d.lock)
+	d.space = sync.NewCond(&d.lock)
+	d.done = make(chan struct{})
+	go d.loop()
+	return
+}
+
+// 依次交给原输出
+func (d *SinkAsync) loop() {
+	defer close(d.done)
+	for {
+		d.lock.Lock()
+		d.busy = false
+		if len(d.queue) == 0 {
+			d.idle.Broadcast()
+		}
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 && d.closed {
+			d.lock.Unlock()
+			return
+		}
+		queue := d.queue
+		d.queue = nil
+		d.samples = 0
+		d.busy = true
+		d.lock.Unlock()
+		d.space.Broadcast()
+		for _, v := range queue {
+			switch r := v.(type) {
+			case *ResultSample:
+				d.Sink.OnSample(r)
+			case *ResultScene:
+				d.Sink.OnBatch(r)
+			}
+		}
+	}
+}
+
+// 入队
+func (d *SinkAsync) push(v interface{}, isSample bool) {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	if isSample {
+		for d.samples >= d.Size && !d.closed {
+			if d.Drop {
+				d.lock.Unlock()
+				atomic.AddInt64(&d.dropped, 1)
+				return
+			}
+			d.space.Wait()
+		}
+		if d.closed {
+			d.lock.Unlock()
+			return
+		}
+		d.samples += 1
+	}
+	d.queue = append(d.queue, v)
+	d.lock.Unlock()
+	d.cond.Signal()
+}
+
+// 样本入队, 队列满时等待, 设置Drop时丢弃
+func (d *SinkAsync) OnSample(r *ResultSample) {
+	d.push(r, true)
+}
+
+// 每轮结果入队, 不丢弃
+func (d *SinkAsync) OnBatch(r *ResultScene) {
+	d.push(r, false)
+}
+
+// 原输出是否需要样本
+func (d *SinkAsync) WantSamples() bool {
+	return sinkWantSamples(d.Sink)
+}
+
+// 等待队列输出完毕后写出原输出的缓冲, 不关闭
+func (d *SinkAsync) Flush() error {
+	d.lock.Lock()
+	for (len(d.queue) > 0 || d.busy) && !d.closed {
+		d.idle.Wait()
+	}
+	d.lock.Unlock()
+	if f, ok := d.Sink.(ResultSinkFlush); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// 等待队列输出完毕后关闭原输出
+func (d *SinkAsync) Close() error {
+	d.lock.Lock()
+	d.closed = true
+	d.lock.Unlock()
+	d.cond.Signal()
+	d.space.Broadcast()
+	<-d.done
+	return d.Sink.Close()
+}
+
+// 实时状态直接交给原输出
+func (d *SinkAsync) OnBatchStart(r *ResultScene) {
+	if l, ok := d.Sink.(ResultSinkLive); ok {
+		l.OnBatchStart(r)
+	}
+}
+
+//
+func (d *SinkAsync) OnConcurrency(add int64) {
+	if l, ok := d.Sink.(ResultSinkLive); ok {
+		l.OnConcurrency(add)
+	}
+}
+
+// 取已丢弃的样本数
+func (d *SinkAsync) GetDropped() int64 {
+	return atomic.LoadInt64(&d.dropped)
+}
+
+// 组合本次执行的结果输出: Metrics, Dashboard, Progress与cache同步更新, 其它输出异步; 未设置任何输出时同步写每轮日志, 不生成样本.
+// cache与原先一致, 每轮结果阻塞写入, 读取慢时场景等待而不丢弃
+func (s *Scene) newSink(cache chan *ResultScene) (ret SinkMulti) {
+	if s.Metrics != nil {
+		ret = append(ret, s.Metrics)
+	}
+	if s.Dashboard != nil {
+		ret = append(ret, s.Dashboard)
+	}
+	if s.Progress != nil {
+		ret = append(ret, s.Progress)
+	}
+	if s.Sink != nil {
+		if a, ok := s.Sink.(*SinkAsync); ok {
+			ret = append(ret, sinkKeep{a})
+		} else {
+			ret = append(ret, NewSinkAsync(sinkKeep{s.Sink}, 0))
+		}
+	}
+	if cache != nil {
+		ret = append(ret, NewSinkChan(cache, 0))
+	}
+	if s.Sink == nil && cache == nil {
+		ret = append(ret, &SinkLog{Log: s.Log})
+	}
+	return
+}
+
+// 执行结束: 等待异步输出完毕并关闭
+func (s *Scene) closeSink(sink SinkMulti) {
+	if err := sink.Close(); err != nil {
+		s.Log.Warnf(`[scene-sink] close: %v`, err)
+	}
+	for _, d := range sink {
+		if k, ok := d.(sinkKeep); ok {
+			d = k.ResultSink
+		}
+		if a, ok := d.(*SinkAsync); ok {
+			if a.GetDropped() > 0 {
+				s.Log.Warnf(`[scene-sink] %T dropped %d samples`, a.Sink, a.GetDropped())
+			}
+			if c, ok := a.Sink.(*SinkChan); ok && c.GetDropped() > 0 {
+				s.Log.Warnf(`[scene-sink] channel not drained, dropped %d batches`, c.GetDropped())
+			}
+		}
+	}
+}
+
+// 不关闭, 只写出缓冲
+func (d sinkKeep) Close() error {
+	if f, ok := d.ResultSink.(ResultSinkFlush); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// 原输出是否需要样本
+func (d sinkKeep) WantSamples() bool {
+	return sinkWantSamples(d.ResultSink)
+}
+
+// 实时状态交给原输出
+func (d sinkKeep) OnBatchStart(r *ResultScene) {
+	if l, ok := d.ResultSink.(ResultSinkLive); ok {
+		l.OnBatchStart(r)
+	}
+}
+
+//
+func (d sinkKeep) OnConcurrency(add int64) {
+	if l, ok := d.ResultSink.(ResultSinkLive); ok {
+		l.OnConcurrency(add)
+	}
+}
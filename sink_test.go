@@ -0,0 +1,169 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录收到的结果
+type testSink struct {
+	delay   time.Duration
+	samples []*ResultSample
+	batches []*ResultScene
+	closed  bool
+	lock    sync.Mutex
+}
+
+func (d *testSink) OnSample(r *ResultSample) {
+	time.Sleep(d.delay)
+	d.lock.Lock()
+	d.samples = append(d.samples, r)
+	d.lock.Unlock()
+}
+
+func (d *testSink) OnBatch(r *ResultScene) {
+	d.lock.Lock()
+	d.batches = append(d.batches, r)
+	d.lock.Unlock()
+}
+
+func (d *testSink) Close() error {
+	d.closed = true
+	return nil
+}
+
+// 测试多个输出与缓存通道同时使用
+func Test_SinkScene(t *testing.T) {
+	as := require.New(t)
+	var (
+		buf     bytes.Buffer
+		collect = new(testSink)
+		cache   = make(chan *ResultScene)
+		cached  []*ResultScene
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range cache {
+			time.Sleep(time.Millisecond * 20) // 读取慢时不丢弃
+			cached = append(cached, r)
+		}
+	}()
+	robot := NewRobot(&Robot{Name: "robot"})
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "a1"})))
+	as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "a2"})))
+	scene := NewScene(&Scene{
+		Name:         "sink",
+		DefaultRobot: robot,
+		Sink:         SinkMulti{collect, &SinkFile{Writer: &buf, Samples: true}},
+		Metrics:      NewSceneMetrics(nil),
+	})
+	scene.Log.SetLevel(2)
+	data, err := scene.RunSurge(&FormSurge{NumInit: 3, BatchMax: 2}, cache)
+	as.Nil(err)
+	as.Len(data, 2)
+	close(cache)
+	wg.Wait()
+	as.Equal(data, cached)
+
+	// 收集: Scene.Sink由创建方关闭
+	as.False(collect.closed)
+	as.Len(collect.samples, 12)
+	as.Len(collect.batches, 2)
+	as.Equal("sink", collect.batches[1].Scene)
+	as.Equal("a2", collect.samples[1].Action)
+
+	// 文件: 样本在所属轮结果之前
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(&buf)
+	)
+	for scanner.Scan() {
+		var v struct {
+			Type string `json:"type"`
+		}
+		as.Nil(json.Unmarshal(scanner.Bytes(), &v))
+		lines = append(lines, v.Type)
+	}
+	as.Len(lines, 14)
+	as.Equal("sample", lines[0])
+	as.Equal("batch", lines[6])
+	as.Equal("batch", lines[13])
+
+	// 同一场景再次执行仍写入同一文件, 关闭后的写入丢弃
+	filePath := filepath.Join(t.TempDir(), "sink.log")
+	file, err := NewSinkFile(filePath, false)
+	as.Nil(err)
+	scene.Sink = file
+	for i := 0; i < 2; i++ {
+		_, err = scene.RunSurge(&FormSurge{NumInit: 1, BatchMax: 1}, nil)
+		as.Nil(err)
+	}
+	as.Nil(file.Close())
+	file.OnBatch(&ResultScene{})
+	b, err := ioutil.ReadFile(filePath)
+	as.Nil(err)
+	as.Equal(2, bytes.Count(b, []byte(`"type":"batch"`)))
+}
+
+// 测试异步输出: 慢输出不阻塞, 队列满时等待, 设置Drop时丢弃样本, 不丢弃每轮结果
+func Test_SinkAsync(t *testing.T) {
+	as := require.New(t)
+
+	// 默认队列满时等待, 不丢弃
+	slow := &testSink{delay: time.Millisecond}
+	sink := NewSinkAsync(slow, 5)
+	for i := 0; i < 50; i++ {
+		sink.OnSample(&ResultSample{Step: i})
+	}
+	as.Nil(sink.Close())
+	as.Len(slow.samples, 50)
+	as.Zero(sink.GetDropped())
+
+	// 丢弃
+	slow = &testSink{delay: time.Millisecond * 20}
+	sink = NewSinkAsync(slow, 5)
+	sink.Drop = true
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		sink.OnSample(&ResultSample{Step: i})
+	}
+	sink.OnBatch(&ResultScene{Batch: 1})
+	as.True(time.Since(start) < time.Millisecond*20)
+	as.Nil(sink.Flush())
+	slow.lock.Lock()
+	as.Len(slow.batches, 1)
+	slow.lock.Unlock()
+	as.False(slow.closed)
+	as.Nil(sink.Close())
+	as.True(slow.closed)
+	as.True(sink.GetDropped() >= 40, sink.GetDropped())
+	as.EqualValues(50, int64(len(slow.samples))+sink.GetDropped())
+	as.Len(slow.batches, 1)
+
+	// 设置了超时的通道无人读取时超时后丢弃
+	c := NewSinkChan(make(chan *ResultScene), time.Millisecond*10)
+	c.OnBatch(&ResultScene{})
+	start = time.Now()
+	c.OnBatch(&ResultScene{})
+	as.True(time.Since(start) < time.Millisecond*10)
+	as.EqualValues(2, c.GetDropped())
+
+	// 默认的日志与缓存通道不需要样本, 执行中不生成
+	scene := NewScene(&Scene{Name: "sink"})
+	as.False(sinkWantSamples(scene.newSink(nil)))
+	as.False(sinkWantSamples(scene.newSink(make(chan *ResultScene))))
+	scene.Sink = NewSinkLog(scene.Log)
+	multi := scene.newSink(nil)
+	as.True(sinkWantSamples(multi))
+	scene.closeSink(multi)
+}
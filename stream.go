@@ -0,0 +1,22 @@
+package box
+
+import (
+	"sync"
+	"time"
+)
+
+// 流式统计中的本轮结果: 机器人完成后计入其中一个分片, 可由Scene.GetInterim随时读取
+type sceneStream struct {
+	shards []*streamShard // 分片, 未在执行时为空
+	report ResultScene    // 本轮执行参数与开始时间
+	last   *ResultScene   // 上一轮结果
+	lock   sync.Mutex     // 保护以上字段, 分片各自加锁
+}
+
+// 一个分片: 机器人按编号分散计入, 减少争用
+type streamShard struct {
+	part      *ResultPart // 分片结果
+	lastError error       // 最后完成的错误
+	lastAt    time.Time   // lastError的完成时间
+	lock      sync.Mutex  //
+}
@@ -0,0 +1,149 @@
+package box
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 本轮开始流式统计, 分片数与可用CPU数相关
+func (s *Scene) beginStream(report, last *ResultScene) (shards []*streamShard) {
+	for i := 0; i < runtime.GOMAXPROCS(0)*2; i++ {
+		shards = append(shards, &streamShard{part: NewResultPart(s.DefaultRobot.ActionArray, nil)})
+	}
+	c := &s.stream
+	c.lock.Lock()
+	c.shards = shards
+	c.report = *report
+	c.last = last
+	c.lock.Unlock()
+	return
+}
+
+// 本轮流式统计结束: 合并各分片
+func (s *Scene) endStream() (part *ResultPart, lastError error) {
+	c := &s.stream
+	c.lock.Lock()
+	shards := c.shards
+	c.shards = nil
+	c.last = nil
+	c.lock.Unlock()
+	part = NewResultPart(s.DefaultRobot.ActionArray, nil)
+	var lastAt time.Time
+	for _, d := range shards {
+		d.lock.Lock()
+		part.Merge(d.part)
+		if d.lastError != nil && (lastError == nil || !d.lastAt.Before(lastAt)) {
+			lastError, lastAt = d.lastError, d.lastAt
+		}
+		d.lock.Unlock()
+	}
+	return
+}
+
+// 计入一个完成的机器人
+func (d *streamShard) add(unit []*RobotActionResult) {
+	d.lock.Lock()
+	for i, r := range unit {
+		d.part.AddAction(i, r)
+		if r != nil && r.Status != ActionStatusNormal && r.Error != nil && (d.lastError == nil || !r.TimeFinish.Before(d.lastAt)) {
+			d.lastError, d.lastAt = r.Error, r.TimeFinish
+		}
+	}
+	d.part.AddUnit(unit)
+	d.lock.Unlock()
+}
+
+// 取本轮至今的统计, 仅流式统计的执行中有效, 否则返回空; 只含已完成的机器人
+func (s *Scene) GetInterim() (ret *ResultScene) {
+	c := &s.stream
+	c.lock.Lock()
+	if c.shards == nil {
+		c.lock.Unlock()
+		return
+	}
+	var (
+		r      = c.report
+		last   = c.last
+		shards = c.shards
+		part   = NewResultPart(s.DefaultRobot.ActionArray, nil)
+	)
+	c.lock.Unlock()
+	for _, d := range shards {
+		d.lock.Lock()
+		part.Merge(d.part)
+		d.lock.Unlock()
+	}
+	ret = &r
+	ret.TimeEnd = s.GetClock().Now()
+	ret.TimeRun = ret.TimeEnd.Sub(ret.TimeStart)
+	ret.statParts([]*ResultPart{part}, last)
+	return
+}
+
+// 流式执行一轮: 由一个协程按起始时间依次启动机器人, 机器人开始时创建, 完成全部动作后计入分片, 关闭并回收,
+// 不保留动作结果; 同时存在的机器人只有执行中的
+func (s *Scene) runBatchStream(form *FormScene, batch, batchRobot, serial int, report, last *ResultScene, sink ResultSink, count func(add int64)) (part *ResultPart, lastError error, err error) {
+	var (
+		category     = form.Category          // 测试类型
+		failFast     = form.FailFast          // true: 遇到错误终止1个机器人
+		periodAction = form.GetPeriodAction() // 接口调用周期
+		shards       = s.beginStream(report, last)
+		wg           sync.WaitGroup
+		clock        = s.GetClock()
+		start        = clock.Now()
+		remain       = 1.0                                        // 余下起始时间的上限, 按周期的比例
+		random       = s.newRand(int64(batch), int64(serial), -1) // 起始时间的随机数
+	)
+	for i := 0; i < batchRobot; i++ {
+		// 在时间周期内随机起始时间: 依次取n个均匀随机数排序后的值, 无需预先生成
+		at := start
+		if (category == SceneCateCapacity || category == SceneCateStable) && periodAction > 0 {
+			remain *= math.Pow(random.Float64(), 1/float64(batchRobot-i))
+			at = start.Add(time.Duration((1 - remain) * float64(periodAction)))
+			s.sleepControl(clock, at.Sub(clock.Now()))
+		}
+		// 开始时创建, 与runBatch一致创建失败时结束本轮并返回错误
+		robot, _err := s.DefaultRobot.Copy()
+		if _err != nil {
+			err = _err
+			break
+		}
+		var (
+			idx   = i
+			shard = shards[i%len(shards)]
+		)
+		wg.Add(1)
+		clockAdd(clock, 1)
+		go func() {
+			defer wg.Done()
+			defer clockAdd(clock, -1)
+			defer PanicRecover(s.Log)
+			robot.Serial = serial + idx
+			robot.Batch = batch
+			robot.Rand = s.newRand(int64(batch), int64(robot.Serial))
+			robot.ResultArray = make([]*RobotActionResult, len(robot.ActionArray))
+			robot.TimeCreate = clock.Now()
+			s.monitor.addLag(robot.TimeCreate.Sub(at))
+
+			// 顺序执行动作, 完成后计入
+			s.runRobot(robot, batch, failFast, sink, count, nil)
+			shard.add(robot.ResultArray)
+
+			// 回收
+			if _err := robot.Close(); _err != nil {
+				s.Log.Warnf(`[robot-close] %d-%d/%d`, batch, idx+1, batchRobot)
+			}
+			robot.ResultArray = nil
+		}()
+	}
+	clockAdd(clock, -1) // 调用者已登记
+	wg.Wait()
+	clockAdd(clock, 1)
+	part, lastError = s.endStream()
+	if err != nil {
+		part, lastError = nil, nil
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package box
+
+import (
+	"github.com/stretchr/testify/require"
+
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试流式统计: 与完整统计口径一致, 不保留机器人, 执行中可取中间统计
+func Test_SceneStreaming(t *testing.T) {
+	as := require.New(t)
+	var (
+		lock    sync.Mutex
+		interim *ResultScene
+		kept    int
+	)
+	newScene := func(streaming bool) *Scene {
+		robot := NewRobot(&Robot{Name: "robot"})
+		var scene *Scene
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{
+			Name: "login",
+			Fn: func(u *Robot, step, batch int, act *ActionOne) (ret interface{}, err error) {
+				time.Sleep(time.Millisecond * time.Duration(1+u.Serial%5))
+				if u.Serial%10 == 3 {
+					err = fmt.Errorf("robot %d", u.Serial)
+				}
+				if streaming && batch == 1 && u.Serial == 50 {
+					lock.Lock()
+					interim = scene.GetInterim()
+					kept = len(scene.RobotArray)
+					lock.Unlock()
+				}
+				return
+			},
+		})))
+		as.Nil(robot.AddAction(NewActionOne(&ActionOne{Name: "home"})))
+		scene = NewScene(&Scene{Name: "stream", DefaultRobot: robot, Streaming: streaming})
+		scene.Log.SetLevel(2)
+		return scene
+	}
+
+	var results [2][]*ResultScene
+	for i, streaming := range []bool{false, true} {
+		data, err := newScene(streaming).RunCapacity(&FormCapacity{NumInit: 100, NumStep: 100, BatchMax: 2, PeriodAction: 20, FailFast: true}, nil)
+		as.Nil(err)
+		as.Len(data, 2)
+		results[i] = data
+	}
+
+	// 计数一致, 耗时相近
+	for b := 0; b < 2; b++ {
+		full, stream := results[0][b], results[1][b]
+		as.Equal(full.BatchRobot, stream.BatchRobot)
+		as.Equal(full.FailRate, stream.FailRate)
+		as.Equal(0.1, stream.FailRate)
+		as.Equal(full.ErrText != "", stream.ErrText != "")
+		as.Len(stream.ActionArray, 2)
+		for i, a := range stream.ActionArray {
+			f := full.ActionArray[i]
+			as.Equal(f.Name, a.Name)
+			as.Equal(f.Count, a.Count)
+			as.Equal(f.Fail, a.Fail)
+			as.Equal(f.Skip, a.Skip)
+			as.Equal(f.FailRate, a.FailRate)
+		}
+		as.InEpsilon(float64(full.ActionArray[0].TimeP50), float64(stream.ActionArray[0].TimeP50), 0.5)
+		as.True(stream.ActionArray[0].TimeMax >= time.Millisecond*5)
+		as.True(stream.PerfTime90Avg > 0)
+		as.True(stream.Tps90Avg > 0)
+		as.True(stream.TotalTimeRun >= stream.TimeRun)
+	}
+
+	// 执行中的中间统计
+	lock.Lock()
+	defer lock.Unlock()
+	as.Equal(0, kept)
+	as.NotNil(interim)
+	as.Equal(2, interim.Batch)
+	as.Equal(200, interim.BatchRobot)
+	as.Len(interim.ActionArray, 2)
+	as.True(interim.ActionArray[0].Count > 0)
+	as.True(interim.ActionArray[0].Count < 200)
+	as.True(interim.TimeRun > 0)
+	as.True(interim.LastPerfAvg > 0)
+	as.Nil(NewScene(nil).GetInterim())
+}
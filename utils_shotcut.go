@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -241,3 +242,37 @@ func PubRandomCodeNum(length int) (ret string) {
 	}
 	return string(b)
 }
+
+// 按路径取json中的值: data.items.0.id
+func PubJsonPath(data interface{}, path string) (ret interface{}, ok bool) {
+	ret = data
+	if len(path) == 0 {
+		return ret, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := ret.(type) {
+		case map[string]interface{}:
+			if ret, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, _err := strconv.Atoi(key)
+			if _err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			ret = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return ret, true
+}
+
+// 按路径从json文本中取值
+func PubJsonPathBytes(b []byte, path string) (ret interface{}, ok bool) {
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, false
+	}
+	return PubJsonPath(data, path)
+}